@@ -0,0 +1,47 @@
+// Package audit builds Merkle trees which commit to the votes in a poll, so
+// that voters can check that their vote was included in its tally.
+package audit
+
+import "crypto/sha256"
+
+// Leaves and nodes are hashed with different prefixes, so that a node cannot
+// be presented as a leaf.
+const (
+	leafPrefix byte = 0
+	nodePrefix byte = 1
+)
+
+// LeafHash returns the hash of a leaf's data.
+func LeafHash(data []byte) [32]byte {
+	return sha256.Sum256(append([]byte{leafPrefix}, data...))
+}
+
+func nodeHash(left, right [32]byte) [32]byte {
+	data := append([]byte{nodePrefix}, left[:]...)
+	return sha256.Sum256(append(data, right[:]...))
+}
+
+// Root returns the Merkle root of a list of leaf hashes. Each level pairs
+// adjacent hashes, and an unpaired hash at the end of a level is carried up to
+// the next level unchanged. The root of an empty tree is the hash of no data.
+func Root(leaves [][32]byte) [32]byte {
+	if len(leaves) == 0 {
+		return sha256.Sum256(nil)
+	}
+
+	level := leaves
+	for len(level) > 1 {
+		var next [][32]byte
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+
+			next = append(next, nodeHash(level[i], level[i+1]))
+		}
+		level = next
+	}
+
+	return level[0]
+}
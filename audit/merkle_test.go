@@ -0,0 +1,31 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoot(t *testing.T) {
+	a := LeafHash([]byte("a"))
+	b := LeafHash([]byte("b"))
+	c := LeafHash([]byte("c"))
+
+	assert.Equal(t, sha256.Sum256(nil), Root(nil))
+
+	// a single leaf is its own root.
+	assert.Equal(t, a, Root([][32]byte{a}))
+
+	ab := nodeHash(a, b)
+	assert.Equal(t, ab, Root([][32]byte{a, b}))
+
+	// the unpaired leaf is carried up to be paired with the node above it.
+	assert.Equal(t, nodeHash(ab, c), Root([][32]byte{a, b, c}))
+
+	// order matters.
+	assert.NotEqual(t, Root([][32]byte{a, b}), Root([][32]byte{b, a}))
+
+	// leaves are hashed differently to nodes, so a node cannot be a leaf.
+	assert.NotEqual(t, LeafHash(append(a[:], b[:]...)), ab)
+}
@@ -0,0 +1,252 @@
+// Package auth logs users in with LNURL-auth, identifying them by the linking
+// key that their wallet signs login challenges with. Node operators can also
+// log in by signing a challenge with their node, identifying them by their
+// node's public key.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/carlaKC/lightning-poll/db"
+	"github.com/carlaKC/lightning-poll/lnd"
+	"github.com/carlaKC/lightning-poll/logging"
+	"github.com/pkg/errors"
+)
+
+var (
+	publicURL = flag.String("public_url", "http://localhost:8080", "URL that the "+
+		"server is reached at, which wallets call back to when logging in")
+	sessionExpiry = flag.Duration("session_expiry", time.Hour*24*30, "How long "+
+		"login sessions last before users must log in again")
+)
+
+const (
+	// challengeLength is the length of the k1 challenge that wallets sign.
+	challengeLength = 32
+
+	// challengeExpiry is how long a user has to sign a login challenge.
+	challengeExpiry = time.Minute * 10
+
+	// tokenLength is the length of the session token given to clients.
+	tokenLength = 32
+)
+
+var (
+	ErrChallengeNotFound = errors.New("Login challenge not found or expired")
+	ErrNotSigned         = errors.New("Login challenge has not been signed yet")
+	ErrNoSession         = errors.New("Not logged in")
+)
+
+// SessionExpiry returns how long login sessions last.
+func SessionExpiry() time.Duration {
+	return *sessionExpiry
+}
+
+// SecureCookies returns true if the server is reached over https, so that
+// session cookies should only be sent over https.
+func SecureCookies() bool {
+	return strings.HasPrefix(*publicURL, "https://")
+}
+
+type Backends interface {
+	GetConn() db.Conn
+	GetAuth() Repository
+	GetLND() lnd.Client
+}
+
+// Challenge is an LNURL-auth login challenge.
+type Challenge struct {
+	K1    string
+	LNURL string
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// NewChallenge creates a login challenge, returning its LNURL for a wallet to
+// sign. The wallet calls back to /lnurl/auth on the server's public URL.
+func NewChallenge(ctx context.Context, b Backends) (*Challenge, error) {
+	k1, err := randomHex(challengeLength)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := b.GetAuth().CreateChallenge(ctx, b.GetConn(), k1,
+		time.Now().Add(challengeExpiry)); err != nil {
+		return nil, err
+	}
+
+	callback := strings.TrimSuffix(*publicURL, "/") + "/lnurl/auth?" + url.Values{
+		"tag":    {"login"},
+		"k1":     {k1},
+		"action": {"login"},
+	}.Encode()
+
+	lnurl, err := EncodeLNURL(callback)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Challenge{K1: k1, LNURL: lnurl}, nil
+}
+
+// challengeKey returns the linking key that signed a challenge, which is
+// empty if it has not been signed. It returns ErrChallengeNotFound if the
+// challenge does not exist or has expired.
+func challengeKey(ctx context.Context, b Backends, h db.Handle, k1 string) (string, error) {
+	c, err := b.GetAuth().LookupChallenge(ctx, h, k1)
+	if err == db.ErrNotFound {
+		return "", ErrChallengeNotFound
+	} else if err != nil {
+		return "", err
+	}
+
+	if c.ExpiresAt.Before(time.Now()) {
+		return "", ErrChallengeNotFound
+	}
+
+	return c.LinkingKey, nil
+}
+
+// CompleteChallenge records that a wallet has signed a login challenge with its
+// linking key. It returns ErrInvalidSignature if the signature is not valid.
+func CompleteChallenge(ctx context.Context, b Backends, k1, sig, key string) error {
+	if _, err := challengeKey(ctx, b, b.GetConn(), k1); err != nil {
+		return err
+	}
+
+	if err := VerifySignature(k1, sig, key); err != nil {
+		return err
+	}
+
+	// a challenge that has already been signed cannot be signed again, so a
+	// challenge cannot be taken over by another key.
+	err := b.GetAuth().CompleteChallenge(ctx, b.GetConn(), k1, strings.ToLower(key))
+	if err == db.ErrUnexpectedRowCount {
+		return ErrChallengeNotFound
+	}
+
+	return err
+}
+
+// NodeMessage returns the message that node operators sign to log in with a
+// challenge, using lncli signmessage.
+func NodeMessage(k1 string) string {
+	return "lightning-poll login: " + k1
+}
+
+// CompleteNodeChallenge records that a node has signed a login challenge's
+// node message, identifying the user by the node's public key. Our node only
+// verifies signatures from nodes in its graph, so the signing node must have
+// public channels. It returns ErrInvalidSignature if the signature is not
+// valid.
+func CompleteNodeChallenge(ctx context.Context, b Backends, k1, signature string) error {
+	if _, err := challengeKey(ctx, b, b.GetConn(), k1); err != nil {
+		return err
+	}
+
+	pubkey, valid, err := b.GetLND().VerifyMessage(ctx, []byte(NodeMessage(k1)), signature)
+	if err != nil {
+		return err
+	}
+
+	if !valid {
+		return ErrInvalidSignature
+	}
+
+	err = b.GetAuth().CompleteChallenge(ctx, b.GetConn(), k1, pubkey)
+	if err == db.ErrUnexpectedRowCount {
+		return ErrChallengeNotFound
+	}
+
+	return err
+}
+
+// hashToken returns the ID that a session is stored with.
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// Login exchanges a signed challenge for a session, returning the session's
+// token and linking key. Each challenge can only be used to log in once. It
+// returns ErrNotSigned if the challenge has not been signed yet.
+func Login(ctx context.Context, b Backends, k1 string) (string, string, error) {
+	token, err := randomHex(tokenLength)
+	if err != nil {
+		return "", "", err
+	}
+
+	var linkingKey string
+	err = db.WithTx(ctx, b.GetConn(), func(tx db.Handle) error {
+		var err error
+		linkingKey, err = challengeKey(ctx, b, tx, k1)
+		if err != nil {
+			return err
+		}
+
+		if linkingKey == "" {
+			return ErrNotSigned
+		}
+
+		if err := b.GetAuth().DeleteChallenge(ctx, tx, k1); err == db.ErrUnexpectedRowCount {
+			return ErrChallengeNotFound
+		} else if err != nil {
+			return err
+		}
+
+		return b.GetAuth().CreateSession(ctx, tx, hashToken(token), linkingKey,
+			time.Now().Add(*sessionExpiry))
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	logging.From(ctx).Info("logged in", "linking_key", linkingKey)
+
+	return token, linkingKey, nil
+}
+
+// LookupSession returns the linking key of the session with the token
+// provided, or ErrNoSession if there is no such session or it has expired.
+func LookupSession(ctx context.Context, b Backends, token string) (string, error) {
+	if token == "" {
+		return "", ErrNoSession
+	}
+
+	s, err := b.GetAuth().LookupSession(ctx, b.GetConn(), hashToken(token))
+	if err == db.ErrNotFound {
+		return "", ErrNoSession
+	} else if err != nil {
+		return "", err
+	}
+
+	if s.ExpiresAt.Before(time.Now()) {
+		return "", ErrNoSession
+	}
+
+	return s.LinkingKey, nil
+}
+
+// Logout deletes the session with the token provided.
+func Logout(ctx context.Context, b Backends, token string) error {
+	err := b.GetAuth().DeleteSession(ctx, b.GetConn(), hashToken(token))
+	if err == db.ErrUnexpectedRowCount {
+		return ErrNoSession
+	}
+
+	return err
+}
@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/carlaKC/lightning-poll/db"
+	"github.com/carlaKC/lightning-poll/lnd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// nopConn begins transactions which do nothing, because in-memory
+// repositories ignore the handle that they are given.
+type nopConn struct {
+	db.Conn
+}
+
+type nopTx struct {
+	db.Handle
+}
+
+func (nopConn) BeginTx(context.Context, *sql.TxOptions) (db.Tx, error) {
+	return nopTx{}, nil
+}
+
+func (nopTx) Commit() error   { return nil }
+func (nopTx) Rollback() error { return nil }
+
+type memBackends struct {
+	auth Repository
+	lnd  *lnd.MockLND
+}
+
+func (m *memBackends) GetConn() db.Conn {
+	return nopConn{}
+}
+
+func (m *memBackends) GetAuth() Repository {
+	return m.auth
+}
+
+func (m *memBackends) GetLND() lnd.Client {
+	return m.lnd
+}
+
+// signCallback signs a challenge's LNURL like a wallet, and returns the
+// parameters of its callback.
+func signCallback(t *testing.T, key *btcec.PrivateKey, c *Challenge) url.Values {
+	callback, err := SignLNURL(key, c.LNURL)
+	require.NoError(t, err)
+
+	u, err := url.Parse(callback)
+	require.NoError(t, err)
+	return u.Query()
+}
+
+func TestLogin(t *testing.T) {
+	ctx := context.Background()
+	b := &memBackends{auth: NewMemRepository()}
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+
+	c, err := NewChallenge(ctx, b)
+	require.NoError(t, err)
+
+	// the challenge cannot be used to log in until it is signed.
+	_, _, err = Login(ctx, b, c.K1)
+	assert.Equal(t, ErrNotSigned, err)
+
+	params := signCallback(t, key, c)
+	assert.Equal(t, c.K1, params.Get("k1"))
+
+	err = CompleteChallenge(ctx, b, c.K1, params.Get("sig"), params.Get("key"))
+	require.NoError(t, err)
+
+	// once signed, another key cannot take over the challenge.
+	other, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	otherParams := signCallback(t, other, c)
+	err = CompleteChallenge(ctx, b, c.K1, otherParams.Get("sig"), otherParams.Get("key"))
+	assert.Equal(t, ErrChallengeNotFound, err)
+
+	token, linkingKey, err := Login(ctx, b, c.K1)
+	require.NoError(t, err)
+	assert.Equal(t, params.Get("key"), linkingKey)
+
+	// challenges can only be used to log in once.
+	_, _, err = Login(ctx, b, c.K1)
+	assert.Equal(t, ErrChallengeNotFound, err)
+
+	sessionKey, err := LookupSession(ctx, b, token)
+	require.NoError(t, err)
+	assert.Equal(t, linkingKey, sessionKey)
+
+	// sessions are stored by the hash of their token.
+	_, err = b.auth.LookupSession(ctx, nil, token)
+	assert.Equal(t, db.ErrNotFound, err)
+
+	require.NoError(t, Logout(ctx, b, token))
+	_, err = LookupSession(ctx, b, token)
+	assert.Equal(t, ErrNoSession, err)
+	assert.Equal(t, ErrNoSession, Logout(ctx, b, token))
+}
+
+func TestCompleteChallenge(t *testing.T) {
+	ctx := context.Background()
+	b := &memBackends{auth: NewMemRepository()}
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+
+	c, err := NewChallenge(ctx, b)
+	require.NoError(t, err)
+	params := signCallback(t, key, c)
+
+	// signatures of another challenge are rejected.
+	sig, linkingKey, err := SignChallenge(key, testK1)
+	require.NoError(t, err)
+	err = CompleteChallenge(ctx, b, c.K1, sig, linkingKey)
+	assert.Equal(t, ErrInvalidSignature, err)
+
+	err = CompleteChallenge(ctx, b, testK1, params.Get("sig"), params.Get("key"))
+	assert.Equal(t, ErrChallengeNotFound, err)
+
+	// expired challenges cannot be signed.
+	err = b.auth.CreateChallenge(ctx, nil, testK1, time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+	err = CompleteChallenge(ctx, b, testK1, sig, linkingKey)
+	assert.Equal(t, ErrChallengeNotFound, err)
+}
+
+func TestSessionExpiry(t *testing.T) {
+	ctx := context.Background()
+	b := &memBackends{auth: NewMemRepository()}
+
+	err := b.auth.CreateSession(ctx, nil, hashToken("expired"), "key", time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+	err = b.auth.CreateSession(ctx, nil, hashToken("active"), "key", time.Now().Add(time.Minute))
+	require.NoError(t, err)
+
+	_, err = LookupSession(ctx, b, "expired")
+	assert.Equal(t, ErrNoSession, err)
+
+	require.NoError(t, cleanup(ctx, b))
+	_, err = b.auth.LookupSession(ctx, nil, hashToken("expired"))
+	assert.Equal(t, db.ErrNotFound, err)
+
+	key, err := LookupSession(ctx, b, "active")
+	require.NoError(t, err)
+	assert.Equal(t, "key", key)
+}
+
+func TestNodeLogin(t *testing.T) {
+	ctx := context.Background()
+	b := &memBackends{
+		auth: NewMemRepository(),
+		lnd:  &lnd.MockLND{Pubkey: "node"},
+	}
+
+	c, err := NewChallenge(ctx, b)
+	require.NoError(t, err)
+
+	// signatures of another message are rejected.
+	sig, err := b.lnd.SignMessage(ctx, []byte(c.K1))
+	require.NoError(t, err)
+	assert.Equal(t, ErrInvalidSignature, CompleteNodeChallenge(ctx, b, c.K1, sig))
+
+	sig, err = b.lnd.SignMessage(ctx, []byte(NodeMessage(c.K1)))
+	require.NoError(t, err)
+	require.NoError(t, CompleteNodeChallenge(ctx, b, c.K1, sig))
+
+	_, key, err := Login(ctx, b, c.K1)
+	require.NoError(t, err)
+	assert.Equal(t, "node", key)
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/carlaKC/lightning-poll/health"
+	"github.com/carlaKC/lightning-poll/logging"
+)
+
+const (
+	cleanupLoop     = "auth/cleanup"
+	cleanupInterval = time.Hour
+)
+
+// StartLoops starts the background loops for auth, which stop once ctx is
+// canceled and the iteration in progress has finished, marking wg done.
+func StartLoops(ctx context.Context, wg *sync.WaitGroup, b Backends) {
+	health.RegisterLoop(cleanupLoop, cleanupInterval)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		cleanupForever(ctx, b)
+	}()
+}
+
+func cleanupForever(ctx context.Context, b Backends) {
+	for {
+		if err := cleanup(context.Background(), b); err != nil {
+			logging.From(ctx).Error("auth cleanup failed", "error", err)
+		} else {
+			health.Beat(cleanupLoop)
+		}
+
+		if !health.Wait(ctx, cleanupInterval) {
+			return
+		}
+	}
+}
+
+// cleanup deletes expired challenges and sessions, which can no longer be
+// used.
+func cleanup(ctx context.Context, b Backends) error {
+	now := time.Now()
+
+	challenges, err := b.GetAuth().DeleteExpiredChallenges(ctx, b.GetConn(), now)
+	if err != nil {
+		return err
+	}
+
+	sessions, err := b.GetAuth().DeleteExpiredSessions(ctx, b.GetConn(), now)
+	if err != nil {
+		return err
+	}
+
+	logging.From(ctx).Debug("deleted expired logins", "challenges", challenges,
+		"sessions", sessions)
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package challenges
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/carlaKC/lightning-poll/db"
+)
+
+var cols = "k1, created_at, expires_at, linking_key"
+
+type DBChallenge struct {
+	K1        string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+
+	// LinkingKey is the key that signed the challenge, which is empty until
+	// a wallet has signed it.
+	LinkingKey string
+}
+
+func Create(ctx context.Context, dbc db.Handle, k1 string, expiresAt time.Time) error {
+	r, err := dbc.ExecContext(ctx, "insert into auth_challenges (k1, created_at, "+
+		"expires_at) values (?, ?, ?)", k1, time.Now(), expiresAt)
+	if err != nil {
+		return err
+	}
+
+	return db.CheckRowsAffected(r, 1)
+}
+
+func Lookup(ctx context.Context, dbc db.Handle, k1 string) (*DBChallenge, error) {
+	var (
+		c   DBChallenge
+		key sql.NullString
+	)
+
+	err := dbc.QueryRowContext(ctx, "select "+cols+" from auth_challenges where k1=?", k1).
+		Scan(&c.K1, &c.CreatedAt, &c.ExpiresAt, &key)
+	if err == sql.ErrNoRows {
+		return nil, db.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	if key.Valid {
+		c.LinkingKey = key.String
+	}
+
+	return &c, nil
+}
+
+// Complete records the key that signed a challenge. A challenge can only be
+// signed once.
+func Complete(ctx context.Context, dbc db.Handle, k1, linkingKey string) error {
+	r, err := dbc.ExecContext(ctx, "update auth_challenges set linking_key=? where k1=? "+
+		"and linking_key is null", linkingKey, k1)
+	if err != nil {
+		return err
+	}
+
+	return db.CheckRowsAffected(r, 1)
+}
+
+func Delete(ctx context.Context, dbc db.Handle, k1 string) error {
+	r, err := dbc.ExecContext(ctx, "delete from auth_challenges where k1=?", k1)
+	if err != nil {
+		return err
+	}
+
+	return db.CheckRowsAffected(r, 1)
+}
+
+// DeleteExpired deletes challenges which expired before the time provided,
+// and returns the number deleted.
+func DeleteExpired(ctx context.Context, dbc db.Handle, before time.Time) (int64, error) {
+	r, err := dbc.ExecContext(ctx, "delete from auth_challenges where expires_at<?", before)
+	if err != nil {
+		return 0, err
+	}
+
+	return r.RowsAffected()
+}
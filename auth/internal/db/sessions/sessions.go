@@ -0,0 +1,63 @@
+package sessions
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/carlaKC/lightning-poll/db"
+)
+
+var cols = "id, linking_key, created_at, expires_at"
+
+// DBSession is a logged in session. Its ID is the hash of the token given to
+// the client, so that sessions cannot be taken over by reading the database.
+type DBSession struct {
+	ID         string
+	LinkingKey string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+}
+
+func Create(ctx context.Context, dbc db.Handle, id, linkingKey string, expiresAt time.Time) error {
+	r, err := dbc.ExecContext(ctx, "insert into sessions (id, linking_key, created_at, "+
+		"expires_at) values (?, ?, ?, ?)", id, linkingKey, time.Now(), expiresAt)
+	if err != nil {
+		return err
+	}
+
+	return db.CheckRowsAffected(r, 1)
+}
+
+func Lookup(ctx context.Context, dbc db.Handle, id string) (*DBSession, error) {
+	var s DBSession
+	err := dbc.QueryRowContext(ctx, "select "+cols+" from sessions where id=?", id).
+		Scan(&s.ID, &s.LinkingKey, &s.CreatedAt, &s.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, db.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+func Delete(ctx context.Context, dbc db.Handle, id string) error {
+	r, err := dbc.ExecContext(ctx, "delete from sessions where id=?", id)
+	if err != nil {
+		return err
+	}
+
+	return db.CheckRowsAffected(r, 1)
+}
+
+// DeleteExpired deletes sessions which expired before the time provided, and
+// returns the number deleted.
+func DeleteExpired(ctx context.Context, dbc db.Handle, before time.Time) (int64, error) {
+	r, err := dbc.ExecContext(ctx, "delete from sessions where expires_at<?", before)
+	if err != nil {
+		return 0, err
+	}
+
+	return r.RowsAffected()
+}
@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcutil/bech32"
+)
+
+// lnurlHRP is the human readable part of bech32 encoded LNURLs.
+const lnurlHRP = "lnurl"
+
+var (
+	ErrInvalidSignature = errors.New("auth: invalid signature")
+	ErrInvalidLNURL     = errors.New("auth: invalid lnurl")
+)
+
+// EncodeLNURL returns the bech32 encoding of a URL, which is how LNURLs are
+// shared with wallets.
+func EncodeLNURL(rawURL string) (string, error) {
+	data, err := bech32.ConvertBits([]byte(rawURL), 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+
+	lnurl, err := bech32.Encode(lnurlHRP, data)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.ToUpper(lnurl), nil
+}
+
+// DecodeLNURL returns the URL that an LNURL encodes.
+func DecodeLNURL(lnurl string) (string, error) {
+	hrp, data, err := bech32.DecodeNoLimit(strings.ToLower(lnurl))
+	if err != nil {
+		return "", err
+	}
+
+	if hrp != lnurlHRP {
+		return "", ErrInvalidLNURL
+	}
+
+	raw, err := bech32.ConvertBits(data, 5, 8, false)
+	if err != nil {
+		return "", err
+	}
+
+	return string(raw), nil
+}
+
+// VerifySignature checks that sig is a DER encoded signature of the challenge
+// k1 by the compressed linking key provided, all of which are hex encoded as
+// they are in LNURL-auth callbacks.
+func VerifySignature(k1, sig, key string) error {
+	challenge, err := hex.DecodeString(k1)
+	if err != nil || len(challenge) != challengeLength {
+		return ErrInvalidSignature
+	}
+
+	sigBytes, err := hex.DecodeString(sig)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	keyBytes, err := hex.DecodeString(key)
+	if err != nil || len(keyBytes) != btcec.PubKeyBytesLenCompressed {
+		return ErrInvalidSignature
+	}
+
+	signature, err := ecdsa.ParseDERSignature(sigBytes)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	pubkey, err := btcec.ParsePubKey(keyBytes)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	if !signature.Verify(challenge, pubkey) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// SignChallenge signs an LNURL-auth challenge the way that a wallet does,
+// returning the hex encoded signature and linking key. It is used to test
+// logins without a wallet.
+func SignChallenge(key *btcec.PrivateKey, k1 string) (string, string, error) {
+	challenge, err := hex.DecodeString(k1)
+	if err != nil || len(challenge) != challengeLength {
+		return "", "", fmt.Errorf("invalid challenge: %v", k1)
+	}
+
+	sig := ecdsa.Sign(key, challenge)
+	return hex.EncodeToString(sig.Serialize()),
+		hex.EncodeToString(key.PubKey().SerializeCompressed()), nil
+}
+
+// SignLNURL signs the challenge in an LNURL-auth LNURL, and returns the
+// callback URL that a wallet would request to log in.
+func SignLNURL(key *btcec.PrivateKey, lnurl string) (string, error) {
+	raw, err := DecodeLNURL(lnurl)
+	if err != nil {
+		return "", err
+	}
+
+	callback, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+
+	query := callback.Query()
+	if query.Get("tag") != "login" {
+		return "", ErrInvalidLNURL
+	}
+
+	sig, linkingKey, err := SignChallenge(key, query.Get("k1"))
+	if err != nil {
+		return "", err
+	}
+
+	query.Set("sig", sig)
+	query.Set("key", linkingKey)
+	callback.RawQuery = query.Encode()
+
+	return callback.String(), nil
+}
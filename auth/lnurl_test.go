@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testK1 = "e2af6254a8df433264fa23f67eb8188635d15ce883e8fc020989d5f82ae6f11e"
+
+func TestLNURL(t *testing.T) {
+	raw := "https://example.com/lnurl/auth?tag=login&k1=" + testK1
+
+	lnurl, err := EncodeLNURL(raw)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(lnurl, "LNURL1"))
+
+	decoded, err := DecodeLNURL(lnurl)
+	require.NoError(t, err)
+	assert.Equal(t, raw, decoded)
+
+	// wallets may share LNURLs in lower case.
+	decoded, err = DecodeLNURL(strings.ToLower(lnurl))
+	require.NoError(t, err)
+	assert.Equal(t, raw, decoded)
+
+	_, err = DecodeLNURL("lnbc1")
+	assert.Error(t, err)
+}
+
+func TestVerifySignature(t *testing.T) {
+	key, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+
+	sig, linkingKey, err := SignChallenge(key, testK1)
+	require.NoError(t, err)
+	assert.NoError(t, VerifySignature(testK1, sig, linkingKey))
+
+	other, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	otherSig, otherKey, err := SignChallenge(other, testK1)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		k1   string
+		sig  string
+		key  string
+	}{
+		{name: "other key", k1: testK1, sig: sig, key: otherKey},
+		{name: "other signature", k1: testK1, sig: otherSig, key: linkingKey},
+		{name: "other challenge", k1: strings.Repeat("00", 32), sig: sig, key: linkingKey},
+		{name: "short challenge", k1: "abcd", sig: sig, key: linkingKey},
+		{name: "invalid signature", k1: testK1, sig: "zz", key: linkingKey},
+		{name: "uncompressed key", k1: testK1, sig: sig,
+			key: "04" + linkingKey[2:] + linkingKey[2:]},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, ErrInvalidSignature, VerifySignature(test.k1, test.sig, test.key))
+		})
+	}
+}
+
+func TestSignLNURL(t *testing.T) {
+	key, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+
+	lnurl, err := EncodeLNURL("https://example.com/lnurl/auth?action=login&k1=" +
+		testK1 + "&tag=login")
+	require.NoError(t, err)
+
+	callback, err := SignLNURL(key, lnurl)
+	require.NoError(t, err)
+
+	u, err := url.Parse(callback)
+	require.NoError(t, err)
+	assert.Equal(t, "/lnurl/auth", u.Path)
+	assert.Equal(t, testK1, u.Query().Get("k1"))
+	assert.NoError(t, VerifySignature(testK1, u.Query().Get("sig"), u.Query().Get("key")))
+
+	// only login LNURLs are signed.
+	lnurl, err = EncodeLNURL("https://example.com/withdraw?k1=" + testK1)
+	require.NoError(t, err)
+	_, err = SignLNURL(key, lnurl)
+	assert.Equal(t, ErrInvalidLNURL, err)
+}
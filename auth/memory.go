@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	challenges_db "github.com/carlaKC/lightning-poll/auth/internal/db/challenges"
+	sessions_db "github.com/carlaKC/lightning-poll/auth/internal/db/sessions"
+	"github.com/carlaKC/lightning-poll/db"
+)
+
+// NewMemRepository returns an auth repository which stores challenges and
+// sessions in memory, for use in tests. The handle passed to its methods is
+// ignored, so changes are not rolled back with the transaction they are made
+// in.
+func NewMemRepository() Repository {
+	return &memAuth{
+		challenges: make(map[string]*challenges_db.DBChallenge),
+		sessions:   make(map[string]*sessions_db.DBSession),
+	}
+}
+
+type memAuth struct {
+	mu         sync.Mutex
+	challenges map[string]*challenges_db.DBChallenge
+	sessions   map[string]*sessions_db.DBSession
+}
+
+func (m *memAuth) CreateChallenge(_ context.Context, _ db.Handle, k1 string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.challenges[k1]; ok {
+		return db.ErrUnexpectedRowCount
+	}
+
+	m.challenges[k1] = &challenges_db.DBChallenge{
+		K1:        k1,
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+	return nil
+}
+
+func (m *memAuth) LookupChallenge(_ context.Context, _ db.Handle, k1 string) (*challenges_db.DBChallenge, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.challenges[k1]
+	if !ok {
+		return nil, db.ErrNotFound
+	}
+
+	challenge := *c
+	return &challenge, nil
+}
+
+func (m *memAuth) CompleteChallenge(_ context.Context, _ db.Handle, k1, linkingKey string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.challenges[k1]
+	if !ok || c.LinkingKey != "" {
+		return db.ErrUnexpectedRowCount
+	}
+
+	c.LinkingKey = linkingKey
+	return nil
+}
+
+func (m *memAuth) DeleteChallenge(_ context.Context, _ db.Handle, k1 string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.challenges[k1]; !ok {
+		return db.ErrUnexpectedRowCount
+	}
+
+	delete(m.challenges, k1)
+	return nil
+}
+
+func (m *memAuth) DeleteExpiredChallenges(_ context.Context, _ db.Handle, before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var n int64
+	for k1, c := range m.challenges {
+		if c.ExpiresAt.Before(before) {
+			delete(m.challenges, k1)
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+func (m *memAuth) CreateSession(_ context.Context, _ db.Handle, id, linkingKey string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.sessions[id]; ok {
+		return db.ErrUnexpectedRowCount
+	}
+
+	m.sessions[id] = &sessions_db.DBSession{
+		ID:         id,
+		LinkingKey: linkingKey,
+		CreatedAt:  time.Now(),
+		ExpiresAt:  expiresAt,
+	}
+	return nil
+}
+
+func (m *memAuth) LookupSession(_ context.Context, _ db.Handle, id string) (*sessions_db.DBSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.sessions[id]
+	if !ok {
+		return nil, db.ErrNotFound
+	}
+
+	session := *s
+	return &session, nil
+}
+
+func (m *memAuth) DeleteSession(_ context.Context, _ db.Handle, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.sessions[id]; !ok {
+		return db.ErrUnexpectedRowCount
+	}
+
+	delete(m.sessions, id)
+	return nil
+}
+
+func (m *memAuth) DeleteExpiredSessions(_ context.Context, _ db.Handle, before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var n int64
+	for id, s := range m.sessions {
+		if s.ExpiresAt.Before(before) {
+			delete(m.sessions, id)
+			n++
+		}
+	}
+
+	return n, nil
+}
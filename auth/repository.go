@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	challenges_db "github.com/carlaKC/lightning-poll/auth/internal/db/challenges"
+	sessions_db "github.com/carlaKC/lightning-poll/auth/internal/db/sessions"
+	"github.com/carlaKC/lightning-poll/db"
+)
+
+// Repository stores login challenges and sessions. Each method runs its
+// queries on the handle provided, so that they can be part of a transaction.
+type Repository interface {
+	CreateChallenge(ctx context.Context, h db.Handle, k1 string, expiresAt time.Time) error
+	LookupChallenge(ctx context.Context, h db.Handle, k1 string) (*challenges_db.DBChallenge, error)
+	CompleteChallenge(ctx context.Context, h db.Handle, k1, linkingKey string) error
+	DeleteChallenge(ctx context.Context, h db.Handle, k1 string) error
+	DeleteExpiredChallenges(ctx context.Context, h db.Handle, before time.Time) (int64, error)
+	CreateSession(ctx context.Context, h db.Handle, id, linkingKey string, expiresAt time.Time) error
+	LookupSession(ctx context.Context, h db.Handle, id string) (*sessions_db.DBSession, error)
+	DeleteSession(ctx context.Context, h db.Handle, id string) error
+	DeleteExpiredSessions(ctx context.Context, h db.Handle, before time.Time) (int64, error)
+}
+
+// NewSQLRepository returns an auth repository backed by a SQL database.
+func NewSQLRepository() Repository {
+	return sqlAuth{}
+}
+
+type sqlAuth struct{}
+
+func (sqlAuth) CreateChallenge(ctx context.Context, h db.Handle, k1 string, expiresAt time.Time) error {
+	return challenges_db.Create(ctx, h, k1, expiresAt)
+}
+
+func (sqlAuth) LookupChallenge(ctx context.Context, h db.Handle, k1 string) (*challenges_db.DBChallenge, error) {
+	return challenges_db.Lookup(ctx, h, k1)
+}
+
+func (sqlAuth) CompleteChallenge(ctx context.Context, h db.Handle, k1, linkingKey string) error {
+	return challenges_db.Complete(ctx, h, k1, linkingKey)
+}
+
+func (sqlAuth) DeleteChallenge(ctx context.Context, h db.Handle, k1 string) error {
+	return challenges_db.Delete(ctx, h, k1)
+}
+
+func (sqlAuth) DeleteExpiredChallenges(ctx context.Context, h db.Handle, before time.Time) (int64, error) {
+	return challenges_db.DeleteExpired(ctx, h, before)
+}
+
+func (sqlAuth) CreateSession(ctx context.Context, h db.Handle, id, linkingKey string, expiresAt time.Time) error {
+	return sessions_db.Create(ctx, h, id, linkingKey, expiresAt)
+}
+
+func (sqlAuth) LookupSession(ctx context.Context, h db.Handle, id string) (*sessions_db.DBSession, error) {
+	return sessions_db.Lookup(ctx, h, id)
+}
+
+func (sqlAuth) DeleteSession(ctx context.Context, h db.Handle, id string) error {
+	return sessions_db.Delete(ctx, h, id)
+}
+
+func (sqlAuth) DeleteExpiredSessions(ctx context.Context, h db.Handle, before time.Time) (int64, error) {
+	return sessions_db.DeleteExpired(ctx, h, before)
+}
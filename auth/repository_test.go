@@ -0,0 +1,124 @@
+package auth_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/carlaKC/lightning-poll/auth"
+	"github.com/carlaKC/lightning-poll/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// repo returns a handle and an empty repository to run a test against.
+type repo func(t *testing.T) (db.Handle, auth.Repository)
+
+func sqlRepo(t *testing.T) (db.Handle, auth.Repository) {
+	dbc := db.ConnectForTesting(t)
+	if dbc == nil {
+		t.FailNow()
+	}
+
+	return dbc, auth.NewSQLRepository()
+}
+
+func memRepo(t *testing.T) (db.Handle, auth.Repository) {
+	return nil, auth.NewMemRepository()
+}
+
+func TestSQLRepository(t *testing.T) {
+	testRepository(t, sqlRepo)
+}
+
+func TestMemRepository(t *testing.T) {
+	testRepository(t, memRepo)
+}
+
+// testRepository is a conformance suite which checks that every repository
+// implementation behaves the same way.
+func testRepository(t *testing.T, setup repo) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, h db.Handle, r auth.Repository)
+	}{
+		{name: "challenges", test: testChallenges},
+		{name: "sessions", test: testSessions},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h, r := setup(t)
+			test.test(t, h, r)
+		})
+	}
+}
+
+func testChallenges(t *testing.T, h db.Handle, r auth.Repository) {
+	ctx := context.Background()
+	expires := time.Now().Add(time.Minute)
+
+	require.NoError(t, r.CreateChallenge(ctx, h, "k1", expires))
+	assert.Error(t, r.CreateChallenge(ctx, h, "k1", expires))
+
+	c, err := r.LookupChallenge(ctx, h, "k1")
+	require.NoError(t, err)
+	assert.Equal(t, "k1", c.K1)
+	assert.Empty(t, c.LinkingKey)
+	assert.WithinDuration(t, expires, c.ExpiresAt, time.Second)
+
+	_, err = r.LookupChallenge(ctx, h, "other")
+	assert.Equal(t, db.ErrNotFound, err)
+
+	require.NoError(t, r.CompleteChallenge(ctx, h, "k1", "key"))
+
+	// challenges can only be completed once.
+	err = r.CompleteChallenge(ctx, h, "k1", "other")
+	assert.Equal(t, db.ErrUnexpectedRowCount, err)
+
+	c, err = r.LookupChallenge(ctx, h, "k1")
+	require.NoError(t, err)
+	assert.Equal(t, "key", c.LinkingKey)
+
+	require.NoError(t, r.DeleteChallenge(ctx, h, "k1"))
+	assert.Equal(t, db.ErrUnexpectedRowCount, r.DeleteChallenge(ctx, h, "k1"))
+
+	require.NoError(t, r.CreateChallenge(ctx, h, "expired", time.Now().Add(-time.Minute)))
+	require.NoError(t, r.CreateChallenge(ctx, h, "active", expires))
+
+	n, err := r.DeleteExpiredChallenges(ctx, h, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	_, err = r.LookupChallenge(ctx, h, "active")
+	assert.NoError(t, err)
+}
+
+func testSessions(t *testing.T, h db.Handle, r auth.Repository) {
+	ctx := context.Background()
+	expires := time.Now().Add(time.Hour)
+
+	require.NoError(t, r.CreateSession(ctx, h, "id", "key", expires))
+	assert.Error(t, r.CreateSession(ctx, h, "id", "key", expires))
+
+	s, err := r.LookupSession(ctx, h, "id")
+	require.NoError(t, err)
+	assert.Equal(t, "key", s.LinkingKey)
+	assert.WithinDuration(t, expires, s.ExpiresAt, time.Second)
+
+	_, err = r.LookupSession(ctx, h, "other")
+	assert.Equal(t, db.ErrNotFound, err)
+
+	require.NoError(t, r.DeleteSession(ctx, h, "id"))
+	assert.Equal(t, db.ErrUnexpectedRowCount, r.DeleteSession(ctx, h, "id"))
+
+	require.NoError(t, r.CreateSession(ctx, h, "expired", "key", time.Now().Add(-time.Minute)))
+	require.NoError(t, r.CreateSession(ctx, h, "active", "key", expires))
+
+	n, err := r.DeleteExpiredSessions(ctx, h, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	_, err = r.LookupSession(ctx, h, "active")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,79 @@
+// Command lnurlauth signs LNURL-auth login challenges like a wallet does, so
+// that logins can be tested locally without a wallet. It signs the LNURL
+// shown on the login page and calls the server back with its signature.
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/carlaKC/lightning-poll/auth"
+)
+
+var linkingKey = flag.String("key", "", "Hex encoded private key to log in "+
+	"with, a new key is generated if it is not set")
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: lnurlauth [flags] <lnurl>\n\nFlags:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	key, err := privateKey()
+	if err != nil {
+		log.Fatalf("could not load key: %v", err)
+	}
+
+	callback, err := auth.SignLNURL(key, flag.Arg(0))
+	if err != nil {
+		log.Fatalf("could not sign lnurl: %v", err)
+	}
+
+	resp, err := http.Get(callback)
+	if err != nil {
+		log.Fatalf("callback failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Fatalf("could not read response: %v", err)
+	}
+
+	fmt.Printf("Linking key: %x\n", key.PubKey().SerializeCompressed())
+	fmt.Printf("Response (%v): %s\n", resp.Status, body)
+}
+
+// privateKey returns the key set with --key, or generates one and prints it
+// so that the same identity can be used to log in again.
+func privateKey() (*btcec.PrivateKey, error) {
+	if *linkingKey != "" {
+		b, err := hex.DecodeString(*linkingKey)
+		if err != nil || len(b) != btcec.PrivKeyBytesLen {
+			return nil, fmt.Errorf("key must be %v hex encoded bytes", btcec.PrivKeyBytesLen)
+		}
+
+		key, _ := btcec.PrivKeyFromBytes(b)
+		return key, nil
+	}
+
+	key, err := btcec.NewPrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("Generated key: %x\n", key.Serialize())
+
+	return key, nil
+}
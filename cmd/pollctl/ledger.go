@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/carlaKC/lightning-poll/ledger"
+)
+
+// dateFormat is the format of the dates accepted by ledger commands, which
+// are interpreted as midnight UTC.
+const dateFormat = "2006-01-02"
+
+// revenue prints the fees earned by the operator which were recorded in a
+// range of dates, defaulting to all fees recorded so far.
+func revenue(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("revenue", flag.ContinueOnError)
+	from := fs.String("from", "", "First date to include, as YYYY-MM-DD, "+
+		"empty to include all earlier fees")
+	to := fs.String("to", "", "Date to stop at, as YYYY-MM-DD, "+
+		"empty to include all later fees")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	start, err := parseDate(*from, time.Unix(0, 0))
+	if err != nil {
+		return fmt.Errorf("invalid -from: %v", err)
+	}
+
+	end, err := parseDate(*to, time.Now().Add(time.Hour))
+	if err != nil {
+		return fmt.Errorf("invalid -to: %v", err)
+	}
+
+	sats, err := ledger.OperatorRevenue(ctx, e.GetConn(), start, end)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Operator revenue from %v to %v: %v sats\n", start.Format(dateFormat),
+		end.Format(dateFormat), sats)
+	return nil
+}
+
+// parseDate parses a date in dateFormat, returning def if it is empty.
+func parseDate(date string, def time.Time) (time.Time, error) {
+	if date == "" {
+		return def.UTC(), nil
+	}
+
+	return time.Parse(dateFormat, date)
+}
+
+// balances prints the ledger balance of each account, either for a single
+// poll or across all polls.
+func balances(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("balances", flag.ContinueOnError)
+	pollID := fs.Int64("poll", 0, "Poll to print balances for, 0 for all polls")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var (
+		sums map[string]int64
+		err  error
+	)
+	if *pollID != 0 {
+		sums, err = ledger.PollBalances(ctx, e.GetConn(), *pollID)
+	} else {
+		sums, err = ledger.Balances(ctx, e.GetConn())
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(sums) == 0 {
+		fmt.Println("No ledger entries found")
+		return nil
+	}
+
+	var accounts []string
+	for account := range sums {
+		accounts = append(accounts, account)
+	}
+	sort.Strings(accounts)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "ACCOUNT\tBALANCE")
+	for _, account := range accounts {
+		fmt.Fprintf(w, "%v\t%v\n", account, sums[account])
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,131 @@
+// Command pollctl provides administrative commands for the operator of a
+// lightning-poll server. It connects to the same database and LND node as
+// the server, and accepts the same flags to configure them.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/carlaKC/lightning-poll/db"
+	"github.com/carlaKC/lightning-poll/lnd"
+	"github.com/carlaKC/lightning-poll/polls"
+	"github.com/carlaKC/lightning-poll/votes"
+)
+
+type env struct {
+	conn    db.Conn
+	lnd     lnd.Client
+	polls   polls.PollRepository
+	options polls.OptionRepository
+	votes   votes.Repository
+}
+
+func (e *env) GetConn() db.Conn {
+	return e.conn
+}
+
+func (e *env) GetPolls() polls.PollRepository {
+	return e.polls
+}
+
+func (e *env) GetOptions() polls.OptionRepository {
+	return e.options
+}
+
+func (e *env) GetVotes() votes.Repository {
+	return e.votes
+}
+
+func (e *env) GetLND() lnd.Client {
+	return e.lnd
+}
+
+type command struct {
+	description string
+	run         func(ctx context.Context, e *env, args []string) error
+}
+
+var commands = map[string]command{
+	"balances": {
+		description: "Print ledger account balances for all polls, or a single -poll",
+		run:         balances,
+	},
+	"reconcile": {
+		description: "Compare votes and polls with LND and report discrepancies",
+		run:         reconcile,
+	},
+	"encrypt-preimages": {
+		description: "Encrypt vote preimages stored before preimages were encrypted",
+		run:         encryptPreimages,
+	},
+	"derive-preimage": {
+		description: "Print the preimage for a vote ID, derived from the preimage seed",
+		run:         derivePreimage,
+	},
+	"revenue": {
+		description: "Print the operator's fee revenue, optionally between -from and -to dates",
+		run:         revenue,
+	},
+	"retry-payout": {
+		description: "Retry the failed payouts of a poll which is stuck paying out",
+		run:         retryPayout,
+	},
+	"verify-receipt": {
+		description: "Check that a vote receipt was signed by our node",
+		run:         verifyReceipt,
+	},
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: pollctl [flags] <command> [args]\n\nCommands:\n")
+
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(flag.CommandLine.Output(), "  %-20s %v\n", name, commands[name].description)
+	}
+
+	fmt.Fprintf(flag.CommandLine.Output(), "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	dbc, err := db.Connect()
+	if err != nil {
+		log.Fatalf("could not connect to DB: %v", err)
+	}
+
+	lndCl, err := lnd.New()
+	if err != nil {
+		log.Fatalf("could not connect to LND: %v", err)
+	}
+
+	e := &env{
+		conn:    dbc,
+		lnd:     lndCl,
+		polls:   polls.NewSQLPollRepository(),
+		options: polls.NewSQLOptionRepository(),
+		votes:   votes.NewSQLRepository(),
+	}
+
+	if err := cmd.run(context.Background(), e, flag.Args()[1:]); err != nil {
+		log.Fatalf("%v: %v", flag.Arg(0), err)
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/carlaKC/lightning-poll/polls"
+)
+
+// retryPayout retries the failed payouts of a poll which is stuck paying out.
+func retryPayout(ctx context.Context, e *env, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: retry-payout <poll id>")
+	}
+
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid poll id: %v", err)
+	}
+
+	if err := polls.RetryPayout(ctx, e, id); err != nil {
+		return err
+	}
+
+	fmt.Println("Retried failed payouts")
+	return nil
+}
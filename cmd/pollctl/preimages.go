@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/carlaKC/lightning-poll/votes"
+)
+
+func encryptPreimages(ctx context.Context, e *env, args []string) error {
+	if err := votes.CheckPreimageKey(); err != nil {
+		return err
+	}
+
+	n, err := votes.EncryptPreimages(ctx, e)
+	if err != nil {
+		return fmt.Errorf("encrypted %v preimages before failing: %v", n, err)
+	}
+
+	fmt.Printf("Encrypted %v preimages\n", n)
+	return nil
+}
+
+// derivePreimage prints the preimage for a vote, so that it can be settled
+// manually if its database row has been lost.
+func derivePreimage(ctx context.Context, e *env, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: derive-preimage <vote id>")
+	}
+
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid vote id: %v", err)
+	}
+
+	preimage, err := votes.DerivePreimage(id)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(hex.EncodeToString(preimage))
+	return nil
+}
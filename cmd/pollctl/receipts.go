@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/carlaKC/lightning-poll/votes"
+)
+
+// verifyReceipt checks that a vote receipt was signed by our node, and prints
+// the vote's outcome.
+func verifyReceipt(ctx context.Context, e *env, args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: verify-receipt <message> <signature>")
+	}
+
+	receipt, err := votes.ParseReceipt(args[0], args[1])
+	if err != nil {
+		return err
+	}
+
+	if err := votes.VerifyReceipt(ctx, e, receipt); err != nil {
+		return err
+	}
+
+	fmt.Printf("Receipt is valid, signed by %v\n", receipt.Pubkey)
+	fmt.Printf("Poll %v, option %v, payment hash %v\n", receipt.PollID, receipt.OptionID,
+		receipt.PaymentHash)
+	fmt.Printf("Vote %v\n", receipt.Outcome)
+
+	return nil
+}
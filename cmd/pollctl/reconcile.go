@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/carlaKC/lightning-poll/polls"
+)
+
+var repair = flag.Bool("repair", false, "Repair discrepancies that are safe to fix "+
+	"automatically. Only use when the server's background loops are stopped.")
+
+func reconcile(ctx context.Context, e *env, args []string) error {
+	discrepancies, err := polls.Reconcile(ctx, e, *repair)
+	if err != nil {
+		return err
+	}
+
+	if len(discrepancies) == 0 {
+		fmt.Println("No discrepancies found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tID\tSAFE\tREPAIRED\tDESCRIPTION")
+	for _, d := range discrepancies {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", d.Kind, d.ID, d.Safe, d.Repaired,
+			d.Description)
+	}
+
+	return w.Flush()
+}
@@ -6,14 +6,20 @@ import (
 	"flag"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/XSAM/otelsql"
 	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
 )
 
-var pollDB = flag.String("poll_db", "mysql://root@unix("+SockFile+")/polls?", "Polls DB URI")
+var pollDB = flag.String("poll_db", "mysql://root@unix("+SockFile+")/polls?", "Polls DB URI, either mysql:// or postgres://")
 var db_test_base = flag.String("db_test_base", "mysql://root@unix("+SockFile+")/", "Database file")
 
 var SockFile = getSocketFile()
@@ -27,63 +33,104 @@ func getSocketFile() string {
 	return sock
 }
 
-func Connect() (*sql.DB, error) {
-	dbc, err := ConnectWithURI(*pollDB)
-	if err != nil {
-		return nil, err
-	}
-	return dbc, nil
+// Connect connects to the database given by the poll_db flag.
+func Connect() (Conn, error) {
+	return ConnectWithURI(*pollDB)
 }
 
-func ConnectWithURI(uri string) (*sql.DB, error) {
-	dbc, err := connect(uri)
+// ConnectWithURI connects to a MySQL database if uri has the mysql:// prefix,
+// or a Postgres database if it has the postgres:// prefix.
+func ConnectWithURI(uri string) (Conn, error) {
+	dbc, d, err := connect(uri)
 	if err != nil {
 		return nil, err
 	}
 
-	return dbc, nil
+	return newConn(dbc, d), nil
 }
 
-func connect(connectStr string) (*sql.DB, error) {
-	const prefix = "mysql://"
-	if !strings.HasPrefix(connectStr, prefix) {
-		return nil, errors.New("db: URI is missing mysql:// prefix")
-	}
-	connectStr = connectStr[len(prefix):]
+func connect(connectStr string) (*sql.DB, dialect, error) {
+	const (
+		mysqlPrefix    = "mysql://"
+		postgresPrefix = "postgres://"
+	)
+
+	var (
+		driver string
+		d      dialect
+		system attribute.KeyValue
+	)
+	switch {
+	case strings.HasPrefix(connectStr, mysqlPrefix):
+		connectStr = connectStr[len(mysqlPrefix):]
+
+		if connectStr[len(connectStr)-1] != '?' {
+			connectStr += "&"
+		}
+		connectStr += "parseTime=true&collation=utf8mb4_general_ci"
+
+		driver, d, system = "mysql", dialectMySQL, semconv.DBSystemMySQL
 
-	if connectStr[len(connectStr)-1] != '?' {
-		connectStr += "&"
+	case strings.HasPrefix(connectStr, postgresPrefix):
+		// the postgres driver accepts URIs as they are.
+		driver, d, system = "postgres", dialectPostgres, semconv.DBSystemPostgreSQL
+
+	default:
+		return nil, 0, errors.New("db: URI is missing mysql:// or postgres:// prefix")
 	}
-	connectStr += "parseTime=true&collation=utf8mb4_general_ci"
 
-	dbc, err := sql.Open("mysql", connectStr)
+	// queries are traced so that slow requests can be attributed to the DB.
+	dbc, err := otelsql.Open(driver, connectStr, otelsql.WithAttributes(system))
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	dbc.SetMaxOpenConns(100)
 	dbc.SetMaxIdleConns(50)
 	dbc.SetConnMaxLifetime(time.Minute)
 
-	return dbc, nil
+	return dbc, d, nil
 }
 
-func ConnectForTesting(t *testing.T) *sql.DB {
-	return connectAndResetForTesting(
-		t, "/src/lightning-poll/db/schema.sql")
+// ConnectForTesting connects to the test database and creates the tables in
+// the schema for its dialect, which is read from this package's directory.
+// The test database is named test, and is found at the DB_TEST_BASE
+// environment variable or db_test_base flag.
+func ConnectForTesting(t *testing.T) Conn {
+	_, file, _, _ := runtime.Caller(0)
+	return connectAndResetForTesting(t, filepath.Dir(file))
+}
+
+// schemaFiles are the names of the schema for each dialect.
+var schemaFiles = map[dialect]string{
+	dialectMySQL:    "schema.sql",
+	dialectPostgres: "schema_postgres.sql",
+}
+
+// sessionSetup are statements run on test connections for each dialect.
+var sessionSetup = map[dialect][]string{
+	dialectMySQL: {
+		"set time_zone='+00:00';",
+		"set sql_mode=if(@@version<'5.7', 'STRICT_TRANS_TABLES,NO_ENGINE_SUBSTITUTION', @@sql_mode);",
+	},
+	dialectPostgres: {
+		"set time zone 'UTC';",
+	},
 }
 
 func connectAndResetForTesting(
-	t *testing.T, schemaPath string) *sql.DB {
+	t *testing.T, schemaDir string) Conn {
 
 	uri := os.Getenv("DB_TEST_BASE")
 	if uri == "" {
 		uri = *db_test_base
 	}
 
-	uri += "test?"
+	// the test database name goes before any parameters in the base URI.
+	base, params, _ := strings.Cut(uri, "?")
+	uri = base + "test?" + params
 
-	dbc, err := connect(uri)
+	dbc, d, err := connect(uri)
 	if err != nil {
 		t.Fatalf("connect error: %v", err)
 		return nil
@@ -93,15 +140,13 @@ func connectAndResetForTesting(
 	// introduce concurrency issues.
 	dbc.SetMaxOpenConns(1)
 
-	if _, err := dbc.Exec("set time_zone='+00:00';"); err != nil {
-		t.Errorf("Error setting time_zone: %v", err)
-	}
-	_, err = dbc.Exec("set sql_mode=if(@@version<'5.7', 'STRICT_TRANS_TABLES,NO_ENGINE_SUBSTITUTION', @@sql_mode);")
-	if err != nil {
-		t.Errorf("Error setting strict mode: %v", err)
+	for _, q := range sessionSetup[d] {
+		if _, err := dbc.Exec(q); err != nil {
+			t.Errorf("Error setting up session: %v", err)
+		}
 	}
 
-	schema, err := ioutil.ReadFile(os.Getenv("GOPATH") + schemaPath)
+	schema, err := ioutil.ReadFile(filepath.Join(schemaDir, schemaFiles[d]))
 	if err != nil {
 		t.Errorf("Error reading schema: %s", err.Error())
 		return nil
@@ -126,5 +171,5 @@ func connectAndResetForTesting(
 		}
 	}
 
-	return dbc
+	return newConn(dbc, d)
 }
@@ -0,0 +1,140 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+)
+
+// Handle runs queries. It is implemented by both connections and
+// transactions, so that queries can be run in a transaction or on their own.
+type Handle interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// Tx is a handle which runs queries in a transaction.
+type Tx interface {
+	Handle
+	Commit() error
+	Rollback() error
+}
+
+// Conn is a handle to a database which can begin transactions.
+type Conn interface {
+	Handle
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (Tx, error)
+	PingContext(ctx context.Context) error
+}
+
+// dialect is the SQL dialect spoken by a database.
+type dialect int
+
+const (
+	dialectMySQL dialect = iota
+	dialectPostgres
+)
+
+// bound runs queries on a handle, first rewriting their placeholders for the
+// handle's dialect. Queries are written with MySQL's ? placeholders.
+type bound struct {
+	h       Handle
+	dialect dialect
+}
+
+func (b bound) bind(query string) string {
+	if b.dialect != dialectPostgres {
+		return query
+	}
+
+	return rebindPostgres(query)
+}
+
+func (b bound) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return b.h.ExecContext(ctx, b.bind(query), args...)
+}
+
+func (b bound) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return b.h.QueryContext(ctx, b.bind(query), args...)
+}
+
+func (b bound) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return b.h.QueryRowContext(ctx, b.bind(query), args...)
+}
+
+// rebindPostgres replaces ? placeholders with Postgres' numbered $n
+// placeholders, leaving question marks in quoted strings unchanged.
+func rebindPostgres(query string) string {
+	var (
+		sb     strings.Builder
+		n      int
+		quoted bool
+	)
+	for _, c := range query {
+		switch {
+		case c == '\'':
+			quoted = !quoted
+		case c == '?' && !quoted:
+			n++
+			sb.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		sb.WriteRune(c)
+	}
+
+	return sb.String()
+}
+
+type conn struct {
+	bound
+	db *sql.DB
+}
+
+func newConn(dbc *sql.DB, d dialect) Conn {
+	return &conn{bound: bound{h: dbc, dialect: d}, db: dbc}
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts *sql.TxOptions) (Tx, error) {
+	tx, err := c.db.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &transaction{bound: bound{h: tx, dialect: c.dialect}, tx: tx}, nil
+}
+
+func (c *conn) PingContext(ctx context.Context) error {
+	return c.db.PingContext(ctx)
+}
+
+type transaction struct {
+	bound
+	tx *sql.Tx
+}
+
+func (t *transaction) Commit() error {
+	return t.tx.Commit()
+}
+
+func (t *transaction) Rollback() error {
+	return t.tx.Rollback()
+}
+
+// WithTx runs fn in a transaction, which is committed if fn succeeds and
+// rolled back if it returns an error. Queries in fn must use the transaction
+// provided rather than the connection, or they will not be part of it.
+func WithTx(ctx context.Context, c Conn, fn func(tx Handle) error) error {
+	tx, err := c.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
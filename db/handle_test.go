@@ -0,0 +1,83 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeTx struct {
+	Handle
+	committed  bool
+	rolledBack bool
+}
+
+func (f *fakeTx) Commit() error {
+	f.committed = true
+	return nil
+}
+
+func (f *fakeTx) Rollback() error {
+	if !f.committed {
+		f.rolledBack = true
+	}
+	return nil
+}
+
+type fakeConn struct {
+	Conn
+	tx *fakeTx
+}
+
+func (f *fakeConn) BeginTx(ctx context.Context, opts *sql.TxOptions) (Tx, error) {
+	f.tx = new(fakeTx)
+	return f.tx, nil
+}
+
+func TestWithTx(t *testing.T) {
+	ctx := context.Background()
+	conn := new(fakeConn)
+
+	err := WithTx(ctx, conn, func(tx Handle) error {
+		assert.Equal(t, conn.tx, tx)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.True(t, conn.tx.committed)
+	assert.False(t, conn.tx.rolledBack)
+
+	testErr := errors.New("failed")
+	err = WithTx(ctx, conn, func(tx Handle) error {
+		return testErr
+	})
+	assert.Equal(t, testErr, err)
+	assert.False(t, conn.tx.committed)
+	assert.True(t, conn.tx.rolledBack)
+}
+
+func TestRebindPostgres(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{
+			query:    "select id from polls",
+			expected: "select id from polls",
+		},
+		{
+			query:    "update polls set status=? where id=? and status=?",
+			expected: "update polls set status=$1 where id=$2 and status=$3",
+		},
+		{
+			query:    "select id from polls where question='why?' and id=?",
+			expected: "select id from polls where question='why?' and id=$1",
+		},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, rebindPostgres(test.query))
+	}
+}
@@ -0,0 +1,126 @@
+create table polls(
+  id bigint not null,
+  status smallint not null,
+  created_at timestamptz not null,
+  expires_at timestamptz not null,
+  question text not null,
+  expiry_seconds bigint not null,
+  repay_scheme smallint not null,
+  vote_sats bigint not null,
+  fee_sats bigint not null default 0,
+  fee_percent bigint not null default 0,
+  payout_invoice text,
+  email varchar(255),
+  audit_root varchar(64),
+  audit_signature text,
+  creator_key varchar(66),
+  one_vote_per_identity boolean not null default false,
+  visibility smallint not null,
+  slug varchar(32) not null,
+  access_code_hash varchar(255),
+
+  primary key(id),
+  unique(slug)
+);
+
+create index polls_listing on polls(status, visibility, expires_at);
+
+create table poll_options(
+  id bigint not null,
+  poll_id bigint not null,
+  value text not null,
+
+  primary key(id)
+);
+
+create index poll_options_poll on poll_options(poll_id);
+
+create table poll_tags(
+  tag varchar(32) not null,
+  poll_id bigint not null,
+
+  primary key(tag, poll_id)
+);
+
+create table poll_terms(
+  term varchar(64) not null,
+  poll_id bigint not null,
+
+  primary key(term, poll_id)
+);
+
+create table votes(
+  id bigint not null,
+  created_at timestamptz not null,
+  expires_at timestamptz not null,
+  closes_at timestamptz not null,
+  poll_id bigint not null,
+  option_id bigint not null,
+  pay_req  text not null,
+  payment_hash varchar(64) not null,
+  preimage bytea not null,
+  settle_index bigint,
+  settle_amount bigint,
+  status smallint not null,
+  cancel_reason text,
+  voter_key varchar(66),
+  identity varchar(66),
+
+  primary key(id),
+  unique(poll_id, identity)
+);
+
+create index votes_poll_status on votes(poll_id, status);
+
+create table vote_changes(
+  id bigint not null,
+  vote_id bigint not null,
+  created_at timestamptz not null,
+  from_option_id bigint not null,
+  to_option_id bigint not null,
+
+  primary key(id)
+);
+
+create table payout_recipients(
+  id bigint not null,
+  poll_id bigint not null,
+  position bigint not null,
+  share_percent bigint not null,
+  payout_invoice text not null,
+  status smallint not null,
+  amount_sats bigint,
+  remainder_sats bigint,
+  payment_hash varchar(64),
+
+  primary key(id)
+);
+
+create table ledger_entries(
+  id bigint not null,
+  created_at timestamptz not null,
+  transaction_id bigint not null,
+  poll_id bigint not null,
+  account smallint not null,
+  amount bigint not null,
+
+  primary key(id)
+);
+
+create table auth_challenges(
+  k1 varchar(64) not null,
+  created_at timestamptz not null,
+  expires_at timestamptz not null,
+  linking_key varchar(66),
+
+  primary key(k1)
+);
+
+create table sessions(
+  id varchar(64) not null,
+  linking_key varchar(66) not null,
+  created_at timestamptz not null,
+  expires_at timestamptz not null,
+
+  primary key(id)
+);
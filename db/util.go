@@ -9,7 +9,7 @@ func CheckRowsAffected(r sql.Result, expectedRows int64) error {
 	if err != nil {
 		return err
 	}
-	if n != 1 {
+	if n != expectedRows {
 		return ErrUnexpectedRowCount
 	}
 	return nil
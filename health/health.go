@@ -0,0 +1,114 @@
+// Package health reports whether the server is alive, and whether it is ready
+// to serve requests given the state of its database, LND node and background
+// loops.
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/carlaKC/lightning-poll/db"
+	"github.com/carlaKC/lightning-poll/lnd"
+	"github.com/gin-gonic/gin"
+)
+
+// checkTimeout bounds the time spent checking each dependency, so that probes
+// fail rather than hang when a dependency is unresponsive.
+const checkTimeout = time.Second * 5
+
+const (
+	StatusOK       = "ok"
+	StatusDegraded = "degraded"
+)
+
+var errNotSynced = errors.New("lnd is not synced to chain")
+
+type Backends interface {
+	GetConn() db.Conn
+	GetLND() lnd.Client
+}
+
+// Check is the result of checking a single dependency.
+type Check struct {
+	Status      string     `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+}
+
+// Report is the readiness of the server, with a breakdown of each check.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]*Check `json:"checks"`
+}
+
+// Ready checks the server's dependencies and background loops. The report is
+// degraded if any of its checks are.
+func Ready(ctx context.Context, b Backends) *Report {
+	report := &Report{
+		Status: StatusOK,
+		Checks: checkLoops(time.Now()),
+	}
+	report.Checks["db"] = newCheck(checkDB(ctx, b))
+	report.Checks["lnd"] = newCheck(checkLND(ctx, b))
+
+	for _, check := range report.Checks {
+		if check.Status != StatusOK {
+			report.Status = StatusDegraded
+		}
+	}
+
+	return report
+}
+
+func newCheck(err error) *Check {
+	if err != nil {
+		return &Check{Status: StatusDegraded, Error: err.Error()}
+	}
+
+	return &Check{Status: StatusOK}
+}
+
+func checkDB(ctx context.Context, b Backends) error {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	return b.GetConn().PingContext(ctx)
+}
+
+func checkLND(ctx context.Context, b Backends) error {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	info, err := b.GetLND().GetInfo(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !info.SyncedToChain {
+		return errNotSynced
+	}
+
+	return nil
+}
+
+// Healthz reports that the process is alive and able to serve requests.
+func Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": StatusOK})
+}
+
+// Readyz returns a handler which reports the readiness of the server, with a
+// non-200 status if it is degraded.
+func Readyz(b Backends) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report := Ready(c.Request.Context(), b)
+
+		status := http.StatusOK
+		if report.Status != StatusOK {
+			status = http.StatusServiceUnavailable
+		}
+
+		c.JSON(status, report)
+	}
+}
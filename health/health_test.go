@@ -0,0 +1,66 @@
+package health
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/carlaKC/lightning-poll/lnd"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckLoops(t *testing.T) {
+	RegisterLoop("fresh", time.Minute)
+	RegisterLoop("stale", time.Minute)
+	Beat("unregistered")
+
+	loopsMu.Lock()
+	loops["stale"].lastSuccess = time.Now().Add(-time.Minute * 4)
+	loopsMu.Unlock()
+
+	checks := checkLoops(time.Now())
+	require.Len(t, checks, 2)
+	require.Equal(t, StatusOK, checks["loop:fresh"].Status)
+	require.Equal(t, StatusDegraded, checks["loop:stale"].Status)
+
+	Beat("stale")
+	checks = checkLoops(time.Now())
+	require.Equal(t, StatusOK, checks["loop:stale"].Status)
+}
+
+type unsyncedLND struct {
+	lnd.MockLND
+}
+
+func (u *unsyncedLND) GetInfo(ctx context.Context) (*lnrpc.GetInfoResponse, error) {
+	return &lnrpc.GetInfoResponse{SyncedToChain: false}, nil
+}
+
+type testBackends struct {
+	Backends
+	lnd lnd.Client
+}
+
+func (tb *testBackends) GetLND() lnd.Client {
+	return tb.lnd
+}
+
+func TestCheckLND(t *testing.T) {
+	ctx := context.Background()
+
+	err := checkLND(ctx, &testBackends{lnd: &lnd.MockLND{}})
+	require.NoError(t, err)
+
+	err = checkLND(ctx, &testBackends{lnd: &unsyncedLND{}})
+	require.Equal(t, errNotSynced, err)
+}
+
+func TestWait(t *testing.T) {
+	require.True(t, Wait(context.Background(), time.Millisecond))
+
+	// loops stop straight away once they are canceled.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.False(t, Wait(ctx, time.Hour))
+}
@@ -0,0 +1,79 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// staleIntervals is the number of intervals a background loop may go without
+// a successful iteration before it is reported as unhealthy, so that a single
+// slow or failed iteration does not mark the server as degraded.
+const staleIntervals = 3
+
+type loop struct {
+	interval    time.Duration
+	lastSuccess time.Time
+}
+
+var (
+	loopsMu sync.Mutex
+	loops   = make(map[string]*loop)
+)
+
+// RegisterLoop registers a background loop which is expected to complete an
+// iteration successfully every interval. The loop is given until a few
+// intervals after it is registered to complete its first iteration.
+func RegisterLoop(name string, interval time.Duration) {
+	loopsMu.Lock()
+	defer loopsMu.Unlock()
+
+	loops[name] = &loop{interval: interval, lastSuccess: time.Now()}
+}
+
+// Beat records a successful iteration of a registered background loop.
+func Beat(name string) {
+	loopsMu.Lock()
+	defer loopsMu.Unlock()
+
+	if l, ok := loops[name]; ok {
+		l.lastSuccess = time.Now()
+	}
+}
+
+// Wait waits for a background loop's interval before its next iteration,
+// returning false as soon as ctx is canceled, when the loop should stop.
+// Iterations are not run with ctx, so that shutting down waits for the
+// iteration in progress rather than interrupting it.
+func Wait(ctx context.Context, interval time.Duration) bool {
+	t := time.NewTimer(interval)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// checkLoops returns the status of every registered loop at the time provided.
+func checkLoops(now time.Time) map[string]*Check {
+	loopsMu.Lock()
+	defer loopsMu.Unlock()
+
+	checks := make(map[string]*Check, len(loops))
+	for name, l := range loops {
+		last := l.lastSuccess
+		check := &Check{Status: StatusOK, LastSuccess: &last}
+
+		if now.Sub(last) > staleIntervals*l.interval {
+			check.Status = StatusDegraded
+			check.Error = "no successful iteration since " + last.UTC().Format(time.RFC3339)
+		}
+
+		checks["loop:"+name] = check
+	}
+
+	return checks
+}
@@ -0,0 +1,147 @@
+package entries
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/carlaKC/lightning-poll/db"
+	"github.com/carlaKC/lightning-poll/ledger/internal/types"
+)
+
+var cols = "id, created_at, transaction_id, poll_id, account, amount"
+
+var ErrUnbalanced = errors.New("Ledger entries do not balance")
+
+type row interface {
+	Scan(dest ...interface{}) error
+}
+
+// Entry is a single leg of a ledger transaction.
+type Entry struct {
+	Account types.Account
+	Amount  int64
+}
+
+// CreateTransaction records a set of entries which must balance to zero. All
+// of the entries are inserted in a single statement so that a transaction is
+// never partially recorded.
+func CreateTransaction(ctx context.Context, dbc db.Handle, pollID int64, entries []Entry) (int64, error) {
+	var total int64
+	for _, e := range entries {
+		total += e.Amount
+	}
+	if len(entries) < 2 || total != 0 {
+		return 0, ErrUnbalanced
+	}
+
+	txID := rand.Int63()
+	now := time.Now()
+
+	var (
+		values []string
+		args   []interface{}
+	)
+	for _, e := range entries {
+		values = append(values, "(?, ?, ?, ?, ?, ?)")
+		args = append(args, rand.Int63(), now, txID, pollID, e.Account, e.Amount)
+	}
+
+	r, err := dbc.ExecContext(ctx, "insert into ledger_entries ("+cols+") values "+
+		strings.Join(values, ", "), args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return txID, db.CheckRowsAffected(r, int64(len(entries)))
+}
+
+type DBEntry struct {
+	ID            int64
+	CreatedAt     time.Time
+	TransactionID int64
+	PollID        int64
+	Account       types.Account
+	Amount        int64
+}
+
+func scan(r row) (entry DBEntry, err error) {
+	err = r.Scan(&entry.ID, &entry.CreatedAt, &entry.TransactionID, &entry.PollID,
+		&entry.Account, &entry.Amount)
+	if err != nil {
+		return entry, err
+	}
+
+	return entry, nil
+}
+
+func list(ctx context.Context, dbc db.Handle, query string, args ...interface{}) (entries []*DBEntry, err error) {
+	rows, err := dbc.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		entry, err := scan(rows)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, &entry)
+	}
+
+	return entries, rows.Err()
+}
+
+func ListByPoll(ctx context.Context, dbc db.Handle, pollID int64) ([]*DBEntry, error) {
+	return list(ctx, dbc, "select "+cols+" from ledger_entries where poll_id=?", pollID)
+}
+
+// SumByAccount returns the balance of an account for entries created in the
+// range [from, to).
+func SumByAccount(ctx context.Context, dbc db.Handle, account types.Account, from, to time.Time) (int64, error) {
+	row := dbc.QueryRowContext(ctx, "select coalesce(sum(amount), 0) from ledger_entries "+
+		"where account=? and created_at>=? and created_at<?", account, from, to)
+
+	var sum int64
+	if err := row.Scan(&sum); err != nil {
+		return 0, err
+	}
+
+	return sum, nil
+}
+
+func sumGrouped(ctx context.Context, dbc db.Handle, query string, args ...interface{}) (map[types.Account]int64, error) {
+	rows, err := dbc.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sums := make(map[types.Account]int64)
+	for rows.Next() {
+		var (
+			account types.Account
+			sum     int64
+		)
+		if err := rows.Scan(&account, &sum); err != nil {
+			return nil, err
+		}
+		sums[account] = sum
+	}
+
+	return sums, rows.Err()
+}
+
+// SumByPoll returns the balance of each account for a poll.
+func SumByPoll(ctx context.Context, dbc db.Handle, pollID int64) (map[types.Account]int64, error) {
+	return sumGrouped(ctx, dbc, "select account, coalesce(sum(amount), 0) from ledger_entries "+
+		"where poll_id=? group by account", pollID)
+}
+
+// SumAll returns the balance of each account across all polls.
+func SumAll(ctx context.Context, dbc db.Handle) (map[types.Account]int64, error) {
+	return sumGrouped(ctx, dbc, "select account, coalesce(sum(amount), 0) from ledger_entries "+
+		"group by account")
+}
@@ -0,0 +1,98 @@
+package entries_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/carlaKC/lightning-poll/db"
+	"github.com/carlaKC/lightning-poll/ledger/internal/db/entries"
+	"github.com/carlaKC/lightning-poll/ledger/internal/types"
+	"github.com/stretchr/testify/assert"
+)
+
+var testPollID = int64(54678)
+
+func setup(t *testing.T) (context.Context, db.Conn) {
+	return context.Background(), db.ConnectForTesting(t)
+}
+
+func TestCreateTransaction(t *testing.T) {
+	ctx, dbc := setup(t)
+
+	_, err := entries.CreateTransaction(ctx, dbc, testPollID, []entries.Entry{
+		{Account: types.AccountCreatorPayable, Amount: 10},
+		{Account: types.AccountOperatorRevenue, Amount: -10},
+	})
+	assert.NoError(t, err)
+
+	eList, err := entries.ListByPoll(ctx, dbc, testPollID)
+	assert.NoError(t, err)
+	assert.Len(t, eList, 2)
+	assert.Equal(t, eList[0].TransactionID, eList[1].TransactionID)
+}
+
+func TestCreateTransactionUnbalanced(t *testing.T) {
+	ctx, dbc := setup(t)
+
+	_, err := entries.CreateTransaction(ctx, dbc, testPollID, []entries.Entry{
+		{Account: types.AccountCreatorPayable, Amount: 10},
+		{Account: types.AccountOperatorRevenue, Amount: -9},
+	})
+	assert.Equal(t, entries.ErrUnbalanced, err)
+
+	_, err = entries.CreateTransaction(ctx, dbc, testPollID, nil)
+	assert.Equal(t, entries.ErrUnbalanced, err)
+}
+
+func TestSumByAccount(t *testing.T) {
+	ctx, dbc := setup(t)
+
+	for i := 0; i < 2; i++ {
+		_, err := entries.CreateTransaction(ctx, dbc, testPollID, []entries.Entry{
+			{Account: types.AccountCreatorPayable, Amount: 10},
+			{Account: types.AccountOperatorRevenue, Amount: -10},
+		})
+		assert.NoError(t, err)
+	}
+
+	now := time.Now()
+	sum, err := entries.SumByAccount(ctx, dbc, types.AccountOperatorRevenue,
+		now.Add(time.Hour*-1), now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-20), sum)
+
+	sum, err = entries.SumByAccount(ctx, dbc, types.AccountOperatorRevenue,
+		now.Add(time.Hour), now.Add(time.Hour*2))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), sum)
+}
+
+func TestSumByPoll(t *testing.T) {
+	ctx, dbc := setup(t)
+
+	_, err := entries.CreateTransaction(ctx, dbc, testPollID, []entries.Entry{
+		{Account: types.AccountNode, Amount: 10},
+		{Account: types.AccountVoteLiability, Amount: -10},
+	})
+	assert.NoError(t, err)
+	_, err = entries.CreateTransaction(ctx, dbc, int64(3454), []entries.Entry{
+		{Account: types.AccountNode, Amount: 5},
+		{Account: types.AccountVoteLiability, Amount: -5},
+	})
+	assert.NoError(t, err)
+
+	sums, err := entries.SumByPoll(ctx, dbc, testPollID)
+	assert.NoError(t, err)
+	assert.Equal(t, map[types.Account]int64{
+		types.AccountNode:          10,
+		types.AccountVoteLiability: -10,
+	}, sums)
+
+	sums, err = entries.SumAll(ctx, dbc)
+	assert.NoError(t, err)
+	assert.Equal(t, map[types.Account]int64{
+		types.AccountNode:          15,
+		types.AccountVoteLiability: -15,
+	}, sums)
+}
@@ -0,0 +1,31 @@
+package types
+
+// Account is a ledger account. Entries are signed, with debits recorded as
+// positive amounts and credits as negative amounts.
+type Account int
+
+var (
+	AccountUnknown         Account = 0
+	AccountCreatorPayable  Account = 1
+	AccountOperatorRevenue Account = 2
+	AccountNode            Account = 3
+	AccountVoteLiability   Account = 4
+	AccountRoutingFees     Account = 5
+	accountSentinel        Account = 6
+)
+
+func (a Account) Valid() bool {
+	return a > AccountUnknown && a < accountSentinel
+}
+
+var strings = map[Account]string{
+	AccountCreatorPayable:  "CREATOR_PAYABLE",
+	AccountOperatorRevenue: "OPERATOR_REVENUE",
+	AccountNode:            "NODE",
+	AccountVoteLiability:   "VOTE_LIABILITY",
+	AccountRoutingFees:     "ROUTING_FEES",
+}
+
+func (a Account) String() string {
+	return strings[a]
+}
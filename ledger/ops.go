@@ -0,0 +1,130 @@
+package ledger
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/carlaKC/lightning-poll/db"
+	entries_db "github.com/carlaKC/lightning-poll/ledger/internal/db/entries"
+	"github.com/carlaKC/lightning-poll/ledger/internal/types"
+	"github.com/pkg/errors"
+)
+
+var ErrPollNotBalanced = errors.New("Closed poll's ledger does not net to zero")
+
+// record writes a balanced transaction which moves amount from the credit
+// account to the debit account. Zero amounts are not recorded.
+func record(ctx context.Context, dbc db.Handle, pollID int64, debit, credit types.Account,
+	amount int64) error {
+
+	if amount == 0 {
+		return nil
+	}
+
+	_, err := entries_db.CreateTransaction(ctx, dbc, pollID, []entries_db.Entry{
+		{Account: debit, Amount: amount},
+		{Account: credit, Amount: -amount},
+	})
+	return err
+}
+
+// RecordVoteAccepted records a vote's hold invoice being accepted by our node.
+// The funds are held on behalf of the voter until the poll closes.
+func RecordVoteAccepted(ctx context.Context, dbc db.Handle, pollID, amount int64) error {
+	return record(ctx, dbc, pollID, types.AccountNode, types.AccountVoteLiability, amount)
+}
+
+// RecordVoteSettled records a vote being settled, which makes the funds held
+// for the voter payable to the poll's recipients.
+func RecordVoteSettled(ctx context.Context, dbc db.Handle, pollID, amount int64) error {
+	return record(ctx, dbc, pollID, types.AccountVoteLiability, types.AccountCreatorPayable, amount)
+}
+
+// RecordVoteCanceled records a vote's hold invoice being canceled, refunding
+// the voter.
+func RecordVoteCanceled(ctx context.Context, dbc db.Handle, pollID, amount int64) error {
+	return record(ctx, dbc, pollID, types.AccountVoteLiability, types.AccountNode, amount)
+}
+
+// RecordOperatorFee records the fee charged by the operator for a poll, which
+// is deducted from the amount paid out to the poll's recipients.
+func RecordOperatorFee(ctx context.Context, dbc db.Handle, pollID, amount int64) error {
+	return record(ctx, dbc, pollID, types.AccountCreatorPayable, types.AccountOperatorRevenue, amount)
+}
+
+// RecordPayout records a payment to one of a poll's recipients.
+func RecordPayout(ctx context.Context, dbc db.Handle, pollID, amount int64) error {
+	return record(ctx, dbc, pollID, types.AccountCreatorPayable, types.AccountNode, amount)
+}
+
+// RecordRoutingFee records the routing fee paid by our node to send a payout.
+func RecordRoutingFee(ctx context.Context, dbc db.Handle, pollID, amount int64) error {
+	return record(ctx, dbc, pollID, types.AccountRoutingFees, types.AccountNode, amount)
+}
+
+// OperatorRevenue returns the total fees earned by the operator for fees
+// recorded in the range [from, to).
+func OperatorRevenue(ctx context.Context, dbc db.Handle, from, to time.Time) (int64, error) {
+	sum, err := entries_db.SumByAccount(ctx, dbc, types.AccountOperatorRevenue, from, to)
+	if err != nil {
+		return 0, err
+	}
+
+	// revenue is recorded as a credit, so its balance is negative.
+	return -sum, nil
+}
+
+// PollBalances returns the balance of each account for a single poll, keyed
+// by account name.
+func PollBalances(ctx context.Context, dbc db.Handle, pollID int64) (map[string]int64, error) {
+	sums, err := entries_db.SumByPoll(ctx, dbc, pollID)
+	if err != nil {
+		return nil, err
+	}
+
+	return byName(sums), nil
+}
+
+// Balances returns the balance of each account across all polls, keyed by
+// account name.
+func Balances(ctx context.Context, dbc db.Handle) (map[string]int64, error) {
+	sums, err := entries_db.SumAll(ctx, dbc)
+	if err != nil {
+		return nil, err
+	}
+
+	return byName(sums), nil
+}
+
+func byName(sums map[types.Account]int64) map[string]int64 {
+	balances := make(map[string]int64)
+	for account, sum := range sums {
+		balances[account.String()] = sum
+	}
+
+	return balances
+}
+
+// CheckPollClosed checks that the ledger for a poll that has been paid out
+// nets to zero: its entries balance, every vote has either been refunded or
+// settled and everything payable has been paid out.
+func CheckPollClosed(ctx context.Context, dbc db.Handle, pollID int64) error {
+	sums, err := entries_db.SumByPoll(ctx, dbc, pollID)
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	for _, sum := range sums {
+		total += sum
+	}
+
+	if total != 0 || sums[types.AccountVoteLiability] != 0 ||
+		sums[types.AccountCreatorPayable] != 0 {
+		return errors.Wrap(ErrPollNotBalanced, fmt.Sprintf("poll %v balances: %v",
+			pollID, byName(sums)))
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package ledger_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/carlaKC/lightning-poll/db"
+	"github.com/carlaKC/lightning-poll/ledger"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+var testPollID = int64(68768)
+
+func setup(t *testing.T) (context.Context, db.Conn) {
+	return context.Background(), db.ConnectForTesting(t)
+}
+
+func TestCheckPollClosed(t *testing.T) {
+	ctx, dbc := setup(t)
+
+	// two votes are accepted, one is refunded and the other settled
+	assert.NoError(t, ledger.RecordVoteAccepted(ctx, dbc, testPollID, 100))
+	assert.NoError(t, ledger.RecordVoteAccepted(ctx, dbc, testPollID, 100))
+	assert.NoError(t, ledger.RecordVoteCanceled(ctx, dbc, testPollID, 100))
+	assert.NoError(t, ledger.RecordVoteSettled(ctx, dbc, testPollID, 100))
+
+	// the poll has not been paid out yet
+	err := ledger.CheckPollClosed(ctx, dbc, testPollID)
+	assert.Equal(t, ledger.ErrPollNotBalanced, errors.Cause(err))
+
+	assert.NoError(t, ledger.RecordOperatorFee(ctx, dbc, testPollID, 10))
+	assert.NoError(t, ledger.RecordPayout(ctx, dbc, testPollID, 90))
+	assert.NoError(t, ledger.RecordRoutingFee(ctx, dbc, testPollID, 1))
+
+	assert.NoError(t, ledger.CheckPollClosed(ctx, dbc, testPollID))
+
+	balances, err := ledger.PollBalances(ctx, dbc, testPollID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-10), balances["OPERATOR_REVENUE"])
+	assert.Equal(t, int64(1), balances["ROUTING_FEES"])
+	assert.Equal(t, int64(9), balances["NODE"])
+
+	revenue, err := ledger.OperatorRevenue(ctx, dbc, time.Now().Add(-time.Hour),
+		time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), revenue)
+}
+
+func TestBalances(t *testing.T) {
+	ctx, dbc := setup(t)
+
+	// one vote is accepted for each of two polls, and one is settled.
+	otherPollID := testPollID + 1
+	assert.NoError(t, ledger.RecordVoteAccepted(ctx, dbc, testPollID, 100))
+	assert.NoError(t, ledger.RecordVoteAccepted(ctx, dbc, otherPollID, 50))
+	assert.NoError(t, ledger.RecordVoteSettled(ctx, dbc, otherPollID, 50))
+
+	balances, err := ledger.Balances(ctx, dbc)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{
+		"NODE":            150,
+		"VOTE_LIABILITY":  -100,
+		"CREATOR_PAYABLE": -50,
+	}, balances)
+
+	balances, err = ledger.PollBalances(ctx, dbc, otherPollID)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{
+		"NODE":            50,
+		"VOTE_LIABILITY":  0,
+		"CREATOR_PAYABLE": -50,
+	}, balances)
+}
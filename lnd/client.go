@@ -2,19 +2,22 @@ package lnd
 
 import (
 	"context"
-	"crypto/rand"
-	"crypto/sha256"
 	"encoding/hex"
 	"flag"
 	"io/ioutil"
-	"log"
+	"time"
 
+	"github.com/carlaKC/lightning-poll/logging"
 	"github.com/lightningnetwork/lnd/lnrpc"
 	"github.com/lightningnetwork/lnd/lnrpc/invoicesrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 var (
@@ -25,26 +28,32 @@ var (
 
 type Client interface {
 	AddInvoice(ctx context.Context, amount, expirySeconds int64, note string) (*lnrpc.Invoice, error)
-	AddHoldInvoice(ctx context.Context, amount, expirySeconds int64, note string) (*HoldInvoice, error)
+	AddHoldInvoice(ctx context.Context, hash []byte, amount, expirySeconds int64, cltvExpiry uint64, note string) (*HoldInvoice, error)
 	CancelHoldInvoice(ctx context.Context, hash string) error
 	SettleHoldInvoice(ctx context.Context, preimage []byte) error
 	LookupInvoice(ctx context.Context, paymentHash string) (*lnrpc.Invoice, error)
 	SubscribeInvoice(ctx context.Context, id int64, paymentHash string) (invoicesrpc.Invoices_SubscribeSingleInvoiceClient, error)
 	DecodePaymentRequest(ctx context.Context, request string) (*lnrpc.PayReq, error)
 	SendPaymentSync(ctx context.Context, payReq string, amount int64) (*lnrpc.SendResponse, error)
+	LookupPayment(ctx context.Context, paymentHash string) (*lnrpc.Payment, error)
+	GetInfo(ctx context.Context) (*lnrpc.GetInfoResponse, error)
+	SignMessage(ctx context.Context, msg []byte) (string, error)
+	VerifyMessage(ctx context.Context, msg []byte, signature string) (string, bool, error)
 }
 
+var ErrPaymentNotFound = errors.New("Payment not found")
+
 type client struct {
 	rpcConn       *grpc.ClientConn
 	rpcClient     lnrpc.LightningClient
 	invoiceClient invoicesrpc.InvoicesClient
+	routerClient  routerrpc.RouterClient
 	macaroon      string
 }
 
 type HoldInvoice struct {
-	Preimage []byte
-	PayHash  string
-	PayReq   string
+	PayHash string
+	PayReq  string
 }
 
 // New returns a grpc client which connects to LND's rpc server.
@@ -75,18 +84,22 @@ func (cl *client) connect(address, cert, serverNameOverride string) error {
 		return err
 	}
 
-	conn, err := grpc.Dial(address, grpc.WithTransportCredentials(creds))
+	conn, err := grpc.Dial(address, grpc.WithTransportCredentials(creds),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()))
 	if err != nil {
 		return errors.Wrap(err, "grpc.Dial error")
 	}
 	cl.rpcConn = conn
 	cl.rpcClient = lnrpc.NewLightningClient(conn)
 	cl.invoiceClient = invoicesrpc.NewInvoicesClient(conn)
+	cl.routerClient = routerrpc.NewRouterClient(conn)
 
 	return nil
 }
 
 func (cl *client) AddInvoice(ctx context.Context, amount, expirySeconds int64, note string) (*lnrpc.Invoice, error) {
+	defer observeRPC("AddInvoice", time.Now())
+
 	inv := &lnrpc.Invoice{
 		Value:  amount,
 		Expiry: expirySeconds,
@@ -103,31 +116,35 @@ func (cl *client) AddInvoice(ctx context.Context, amount, expirySeconds int64, n
 	return inv, nil
 }
 
-func (cl *client) AddHoldInvoice(ctx context.Context, amount, expirySeconds int64, note string) (*HoldInvoice, error) {
-	var paymentPreimage [32]byte
-	rand.Read(paymentPreimage[:])
-	paymentHash := sha256.Sum256(paymentPreimage[:])
+// AddHoldInvoice adds a hold invoice for the payment hash provided, which
+// requires that HTLCs paying it have a final CLTV delta of at least cltvExpiry
+// blocks. The caller is responsible for the preimage used to settle it.
+func (cl *client) AddHoldInvoice(ctx context.Context, hash []byte, amount, expirySeconds int64,
+	cltvExpiry uint64, note string) (*HoldInvoice, error) {
+	defer observeRPC("AddHoldInvoice", time.Now())
 
 	resp, err := cl.invoiceClient.AddHoldInvoice(
 		cl.macaroonCtx(ctx),
 		&invoicesrpc.AddHoldInvoiceRequest{
-			Value:  amount,
-			Expiry: expirySeconds,
-			Hash:   paymentHash[:],
-			Memo:   note,
+			Value:      amount,
+			Expiry:     expirySeconds,
+			Hash:       hash,
+			Memo:       note,
+			CltvExpiry: cltvExpiry,
 		})
 	if err != nil {
 		return nil, err
 	}
 
 	return &HoldInvoice{
-		Preimage: paymentPreimage[:],
-		PayHash:  hex.EncodeToString(paymentHash[:]),
-		PayReq:   resp.PaymentRequest,
+		PayHash: hex.EncodeToString(hash),
+		PayReq:  resp.PaymentRequest,
 	}, nil
 }
 
 func (cl *client) CancelHoldInvoice(ctx context.Context, hash string) error {
+	defer observeRPC("CancelHoldInvoice", time.Now())
+
 	hashBytes, err := hex.DecodeString(hash)
 	if err != nil {
 		return err
@@ -142,6 +159,8 @@ func (cl *client) CancelHoldInvoice(ctx context.Context, hash string) error {
 }
 
 func (cl *client) SettleHoldInvoice(ctx context.Context, preimage []byte) error {
+	defer observeRPC("SettleHoldInvoice", time.Now())
+
 	_, err := cl.invoiceClient.SettleInvoice(
 		cl.macaroonCtx(ctx),
 		&invoicesrpc.SettleInvoiceMsg{Preimage: preimage},
@@ -150,6 +169,8 @@ func (cl *client) SettleHoldInvoice(ctx context.Context, preimage []byte) error
 }
 
 func (cl *client) LookupInvoice(ctx context.Context, paymentHash string) (*lnrpc.Invoice, error) {
+	defer observeRPC("LookupInvoice", time.Now())
+
 	return cl.rpcClient.LookupInvoice(
 		cl.macaroonCtx(ctx),
 		&lnrpc.PaymentHash{
@@ -158,7 +179,9 @@ func (cl *client) LookupInvoice(ctx context.Context, paymentHash string) (*lnrpc
 }
 
 func (cl *client) SubscribeInvoice(ctx context.Context, id int64, paymentHash string) (invoicesrpc.Invoices_SubscribeSingleInvoiceClient, error) {
-	log.Printf("lnd: SubscribeInvoice connecting for invoice: %v", id)
+	defer observeRPC("SubscribeInvoice", time.Now())
+
+	logging.From(ctx).Debug("subscribing to invoice", "invoice_id", id)
 
 	hash, err := hex.DecodeString(paymentHash)
 	if err != nil {
@@ -173,6 +196,8 @@ func (cl *client) SubscribeInvoice(ctx context.Context, id int64, paymentHash st
 }
 
 func (cl *client) DecodePaymentRequest(ctx context.Context, request string) (*lnrpc.PayReq, error) {
+	defer observeRPC("DecodePaymentRequest", time.Now())
+
 	return cl.rpcClient.DecodePayReq(
 		cl.macaroonCtx(ctx),
 		&lnrpc.PayReqString{
@@ -182,6 +207,8 @@ func (cl *client) DecodePaymentRequest(ctx context.Context, request string) (*ln
 }
 
 func (cl *client) SendPaymentSync(ctx context.Context, payReq string, amount int64) (*lnrpc.SendResponse, error) {
+	defer observeRPC("SendPaymentSync", time.Now())
+
 	return cl.rpcClient.SendPaymentSync(
 		cl.macaroonCtx(ctx),
 		&lnrpc.SendRequest{
@@ -189,3 +216,72 @@ func (cl *client) SendPaymentSync(ctx context.Context, payReq string, amount int
 			Amt:            amount,
 		})
 }
+
+// LookupPayment returns the payment that our node made to a payment hash,
+// including payments that are still in flight or have failed. Payments are
+// tracked by their hash, and the first update is their current state, so the
+// stream is closed once it has been received.
+func (cl *client) LookupPayment(ctx context.Context, paymentHash string) (*lnrpc.Payment, error) {
+	defer observeRPC("LookupPayment", time.Now())
+
+	hash, err := hex.DecodeString(paymentHash)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := cl.routerClient.TrackPaymentV2(
+		cl.macaroonCtx(ctx),
+		&routerrpc.TrackPaymentRequest{
+			PaymentHash: hash,
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	payment, err := stream.Recv()
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrPaymentNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return payment, nil
+}
+
+func (cl *client) GetInfo(ctx context.Context) (*lnrpc.GetInfoResponse, error) {
+	defer observeRPC("GetInfo", time.Now())
+
+	return cl.rpcClient.GetInfo(cl.macaroonCtx(ctx), &lnrpc.GetInfoRequest{})
+}
+
+// SignMessage signs a message with our node's identity key, returning the
+// zbase32 encoded signature.
+func (cl *client) SignMessage(ctx context.Context, msg []byte) (string, error) {
+	defer observeRPC("SignMessage", time.Now())
+
+	resp, err := cl.rpcClient.SignMessage(cl.macaroonCtx(ctx),
+		&lnrpc.SignMessageRequest{Msg: msg})
+	if err != nil {
+		return "", err
+	}
+
+	return resp.Signature, nil
+}
+
+// VerifyMessage checks a signature produced by SignMessage, returning the
+// public key of the node which signed the message and whether the signature
+// is valid.
+func (cl *client) VerifyMessage(ctx context.Context, msg []byte, signature string) (string, bool, error) {
+	defer observeRPC("VerifyMessage", time.Now())
+
+	resp, err := cl.rpcClient.VerifyMessage(cl.macaroonCtx(ctx),
+		&lnrpc.VerifyMessageRequest{Msg: msg, Signature: signature})
+	if err != nil {
+		return "", false, err
+	}
+
+	return resp.Pubkey, resp.Valid, nil
+}
@@ -0,0 +1,25 @@
+package lnd
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var rpcLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "main",
+	Subsystem: "lnd",
+	Name:      "rpc_duration_seconds",
+	Help:      "Latency of calls to LND by method.",
+	Buckets:   prometheus.ExponentialBuckets(0.005, 2, 14),
+}, []string{"method"})
+
+func init() {
+	prometheus.MustRegister(rpcLatency)
+}
+
+// observeRPC records the latency of a call to LND which started at start. It
+// is intended to be deferred at the start of each call.
+func observeRPC(method string, start time.Time) {
+	rpcLatency.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
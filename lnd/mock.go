@@ -2,7 +2,6 @@ package lnd
 
 import (
 	"context"
-	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
 	"errors"
@@ -14,25 +13,49 @@ import (
 
 type MockLND struct {
 	Client
+
+	// Invoices are returned by LookupInvoice, keyed by payment hash.
+	Invoices map[string]*lnrpc.Invoice
+
+	// BlockHeight is returned by GetInfo.
+	BlockHeight uint32
+
+	// Canceled records the payment hashes passed to CancelHoldInvoice.
+	Canceled []string
+
+	// Pubkey is returned by GetInfo, and signs messages.
+	Pubkey string
+
+	// HoldInvoiceErr is returned by AddHoldInvoice, if it is set.
+	HoldInvoiceErr error
+
+	// PayReqs are returned by DecodePaymentRequest, keyed by payment
+	// request. Unknown payment requests decode to an empty PayReq.
+	PayReqs map[string]*lnrpc.PayReq
 }
 
 func (m *MockLND) AddInvoice(ctx context.Context, amount, expirySeconds int64, note string) (*lnrpc.Invoice, error) {
 	return &lnrpc.Invoice{PaymentRequest: "test pay req"}, nil
 }
 
-func (m *MockLND) AddHoldInvoice(ctx context.Context, amount, expirySeconds int64, note string) (*HoldInvoice, error) {
-	var paymentPreimage [32]byte
-	rand.Read(paymentPreimage[:])
-	hash := sha256.Sum256(paymentPreimage[:])
+func (m *MockLND) AddHoldInvoice(ctx context.Context, hash []byte, amount, expirySeconds int64,
+	cltvExpiry uint64, note string) (*HoldInvoice, error) {
+
+	if m.HoldInvoiceErr != nil {
+		return nil, m.HoldInvoiceErr
+	}
 
 	return &HoldInvoice{
-		Preimage: paymentPreimage[:],
-		PayHash:  hex.EncodeToString(hash[:]),
-		PayReq:   "pay req",
+		PayHash: hex.EncodeToString(hash),
+		PayReq:  "pay req",
 	}, nil
 }
 
 func (m *MockLND) DecodePaymentRequest(ctx context.Context, request string) (*lnrpc.PayReq, error) {
+	if req, ok := m.PayReqs[request]; ok {
+		return req, nil
+	}
+
 	return new(lnrpc.PayReq), nil
 }
 
@@ -47,3 +70,44 @@ func (s *subscribeClient) Recv() (*lnrpc.Invoice, error) {
 func (m *MockLND) SubscribeInvoice(ctx context.Context, id int64, paymentHash string) (invoicesrpc.Invoices_SubscribeSingleInvoiceClient, error) {
 	return &subscribeClient{}, nil
 }
+
+func (m *MockLND) LookupInvoice(ctx context.Context, paymentHash string) (*lnrpc.Invoice, error) {
+	inv, ok := m.Invoices[paymentHash]
+	if !ok {
+		return nil, errors.New("invoice not found")
+	}
+
+	return inv, nil
+}
+
+func (m *MockLND) GetInfo(ctx context.Context) (*lnrpc.GetInfoResponse, error) {
+	return &lnrpc.GetInfoResponse{
+		BlockHeight:    m.BlockHeight,
+		SyncedToChain:  true,
+		IdentityPubkey: m.Pubkey,
+	}, nil
+}
+
+func (m *MockLND) CancelHoldInvoice(ctx context.Context, hash string) error {
+	m.Canceled = append(m.Canceled, hash)
+	return nil
+}
+
+// mockSignature returns a signature over msg by pubkey.
+func mockSignature(pubkey string, msg []byte) string {
+	sig := sha256.Sum256(append([]byte(pubkey), msg...))
+	return hex.EncodeToString(sig[:])
+}
+
+func (m *MockLND) SignMessage(ctx context.Context, msg []byte) (string, error) {
+	return mockSignature(m.Pubkey, msg), nil
+}
+
+// VerifyMessage only recognizes signatures made by the mock's own pubkey.
+func (m *MockLND) VerifyMessage(ctx context.Context, msg []byte, signature string) (string, bool, error) {
+	if signature != mockSignature(m.Pubkey, msg) {
+		return "", false, nil
+	}
+
+	return m.Pubkey, true, nil
+}
@@ -0,0 +1,82 @@
+// Package logging provides structured, levelled logging. Loggers are carried
+// in a context so that fields such as the request, poll and vote IDs that
+// are added as an operation progresses are included in every log it writes.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+var (
+	logLevel = flag.String("log_level", "info", "Minimum level of logs to output: debug, info, warn or error")
+	logJSON  = flag.Bool("log_json", false, "Output logs as JSON rather than text")
+)
+
+// Field names shared across packages so that logs can be searched for every
+// entry relating to a single request, poll or vote.
+const (
+	FieldRequestID   = "request_id"
+	FieldPollID      = "poll_id"
+	FieldVoteID      = "vote_id"
+	FieldPaymentHash = "payment_hash"
+	FieldTraceID     = "trace_id"
+)
+
+type loggerKey struct{}
+
+// Init configures the default logger using the log_level and log_json flags.
+// It must be called after flags have been parsed.
+func Init() error {
+	return initWithWriter(os.Stderr)
+}
+
+func initWithWriter(w io.Writer) error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.ToUpper(*logLevel))); err != nil {
+		return fmt.Errorf("invalid log level %v: %v", *logLevel, err)
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler = slog.NewTextHandler(w, opts)
+	if *logJSON {
+		handler = slog.NewJSONHandler(w, opts)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// From returns the logger carried by a context, or the default logger if the
+// context does not have one.
+func From(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+
+	return slog.Default()
+}
+
+// With returns a context carrying a logger which includes the key value pairs
+// provided as fields, in addition to any fields already in the context.
+func With(ctx context.Context, args ...interface{}) context.Context {
+	return context.WithValue(ctx, loggerKey{}, From(ctx).With(args...))
+}
+
+// NewRequestID returns a random ID which identifies a single request.
+func NewRequestID() string {
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return "unknown"
+	}
+
+	return hex.EncodeToString(id[:])
+}
@@ -0,0 +1,43 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWith(t *testing.T) {
+	*logJSON = true
+	defer func() { *logJSON = false }()
+
+	var buf bytes.Buffer
+	assert.NoError(t, initWithWriter(&buf))
+
+	ctx := With(context.Background(), FieldRequestID, "abc")
+	ctx = With(ctx, FieldPollID, int64(1))
+	From(ctx).Info("test message", FieldVoteID, int64(2))
+
+	var entry map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "test message", entry["msg"])
+	assert.Equal(t, "abc", entry[FieldRequestID])
+	assert.Equal(t, float64(1), entry[FieldPollID])
+	assert.Equal(t, float64(2), entry[FieldVoteID])
+}
+
+func TestInitLevel(t *testing.T) {
+	defer func() { *logLevel = "info" }()
+
+	*logLevel = "warn"
+	var buf bytes.Buffer
+	assert.NoError(t, initWithWriter(&buf))
+
+	From(context.Background()).Info("not logged")
+	assert.Equal(t, 0, buf.Len())
+
+	*logLevel = "verbose"
+	assert.Error(t, initWithWriter(&buf))
+}
@@ -0,0 +1,48 @@
+package logging
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader is the header used to propagate request IDs. If a request
+// arrives with this header set its value is used, otherwise a new ID is
+// generated. The ID is always returned in the response.
+const RequestIDHeader = "X-Request-ID"
+
+// Middleware adds a request ID to each request's context, so that it is
+// included in all logs written while handling the request, and logs the
+// outcome of the request.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		id := c.GetHeader(RequestIDHeader)
+		if id == "" || len(id) > 64 {
+			id = NewRequestID()
+		}
+		c.Header(RequestIDHeader, id)
+
+		ctx := With(c.Request.Context(), FieldRequestID, id)
+
+		// include the request's trace ID, if it is traced, so that logs can be
+		// found from a slow span.
+		if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+			ctx = With(ctx, FieldTraceID, sc.TraceID().String())
+		}
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		logger := From(ctx).With("method", c.Request.Method, "path",
+			c.Request.URL.Path, "status", c.Writer.Status(), "duration",
+			time.Since(start))
+		if len(c.Errors) != 0 {
+			logger.Error("request failed", "error", c.Errors.String())
+			return
+		}
+		logger.Info("request handled")
+	}
+}
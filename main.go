@@ -1,29 +1,82 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/carlaKC/lightning-poll/auth"
 	"github.com/carlaKC/lightning-poll/db"
 	"github.com/carlaKC/lightning-poll/lnd"
+	"github.com/carlaKC/lightning-poll/logging"
+	"github.com/carlaKC/lightning-poll/metrics"
 	"github.com/carlaKC/lightning-poll/polls"
+	"github.com/carlaKC/lightning-poll/tracing"
 	"github.com/carlaKC/lightning-poll/votes"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
 var router *gin.Engine
 
+// shutdownTimeout is how long in flight requests, background loops and
+// unexported traces are given to finish when the server is stopped.
+const shutdownTimeout = time.Second * 30
+
 var baseTemplates = flag.String("templates_base",
 	"/Users/carla/personal/src/github.com/carlaKC", "location of templates")
 
+var (
+	voteIPLimit = flag.Int("vote_ip_limit", 10, "Maximum number of votes per minute "+
+		"from a single IP address, 0 for no limit")
+	votePollLimit = flag.Int("vote_poll_limit", 60, "Maximum number of votes per minute "+
+		"for a single poll, 0 for no limit")
+	accessIPLimit = flag.Int("access_ip_limit", 10, "Maximum number of access code "+
+		"attempts per minute from a single IP address, 0 for no limit")
+	accessPollLimit = flag.Int("access_poll_limit", 30, "Maximum number of access code "+
+		"attempts per minute for a single poll, 0 for no limit")
+
+	// trustedProxies are the only proxies whose X-Forwarded-For headers are
+	// used for client IPs, so that clients cannot pick their own IP to get
+	// around per IP rate limits.
+	trustedProxies = flag.String("trusted_proxies", "", "Comma separated IPs or "+
+		"CIDRs of reverse proxies to trust for client IPs, empty to use the remote address")
+)
+
 func main() {
 	flag.Parse()
 
+	if err := logging.Init(); err != nil {
+		log.Fatalf("could not initialize logging: %v", err)
+	}
+
+	shutdownTracing, err := tracing.Init(context.Background())
+	if err != nil {
+		log.Fatalf("could not initialize tracing: %v", err)
+	}
+
 	// Set the router as the default one provided by Gin
 	router = gin.Default()
+	if err := router.SetTrustedProxies(splitList(*trustedProxies)); err != nil {
+		log.Fatalf("invalid trusted proxies: %v", err)
+	}
+	router.Use(otelgin.Middleware(tracing.ServiceName))
+	router.Use(logging.Middleware())
+	router.Use(metrics.Middleware())
 
 	router.LoadHTMLGlob(*baseTemplates + "/lightning-poll/templates/*")
 
+	if err := votes.CheckPreimageSecrets(); err != nil {
+		log.Fatalf("could not load preimage secrets: %v", err)
+	}
+
 	dbc, err := db.Connect()
 	if err != nil {
 		log.Fatalf("could not connect to DB: %v", err)
@@ -33,15 +86,83 @@ func main() {
 	if err != nil {
 		log.Fatalf("could not connect to LND: %v", err)
 	}
-	env := &Env{db: dbc, lnd: lndCl}
+	env := newEnv(dbc, lndCl)
 
-	votes.StartLoops(env)
-	polls.StartLoops(env)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// background loops stop when the server is shutting down, once their
+	// iteration in progress has finished.
+	var loops sync.WaitGroup
+	votes.StartLoops(ctx, &loops, env)
+	polls.StartLoops(ctx, &loops, env)
+	auth.StartLoops(ctx, &loops, env)
+
+	go func() {
+		if err := metrics.Serve(); err != nil {
+			log.Fatalf("could not serve metrics: %v", err)
+		}
+	}()
 
 	// Initialize the routes
 	initializeRoutes(env)
 
 	// Start serving the application
-	router.Run()
+	srv := &http.Server{Addr: listenAddress(), Handler: router}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("could not serve: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	logging.From(ctx).Info("shutting down")
+
+	// requests and background loops are finished before traces are flushed,
+	// so that their spans are exported.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logging.From(ctx).Error("could not shut down server", "error", err)
+	}
+
+	loopsDone := make(chan struct{})
+	go func() {
+		loops.Wait()
+		close(loopsDone)
+	}()
+
+	select {
+	case <-loopsDone:
+	case <-shutdownCtx.Done():
+		logging.From(ctx).Error("background loops did not stop", "error", shutdownCtx.Err())
+	}
+
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		logging.From(ctx).Error("could not flush traces", "error", err)
+	}
+}
+
+// listenAddress returns the address to serve on, which is the PORT
+// environment variable or 8080 like gin's default.
+func listenAddress() string {
+	if port := os.Getenv("PORT"); port != "" {
+		return ":" + port
+	}
+
+	return ":8080"
+}
+
+// splitList splits a comma separated flag value, returning nil if it is empty.
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
 
+	return list
 }
@@ -0,0 +1,70 @@
+// Package metrics serves the Prometheus metrics registered by each of the
+// lightning-poll subsystems, and instruments HTTP requests.
+package metrics
+
+import (
+	"flag"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var metricsAddress = flag.String("metrics_address", ":9090", "Address to serve "+
+	"Prometheus metrics on, metrics are not served if empty")
+
+var httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "main",
+	Subsystem: "http",
+	Name:      "requests_total",
+	Help:      "Count of HTTP requests by method, route and status code.",
+}, []string{"method", "route", "code"})
+
+var httpLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "main",
+	Subsystem: "http",
+	Name:      "request_duration_seconds",
+	Help:      "Latency of HTTP requests by method and route.",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"method", "route"})
+
+func init() {
+	prometheus.MustRegister(httpRequests)
+	prometheus.MustRegister(httpLatency)
+}
+
+// Middleware records the count and latency of HTTP requests. Requests are
+// labelled by their route rather than their path so that the number of label
+// values is bounded.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		httpRequests.WithLabelValues(c.Request.Method, route,
+			strconv.Itoa(c.Writer.Status())).Inc()
+		httpLatency.WithLabelValues(c.Request.Method, route).Observe(
+			time.Since(start).Seconds())
+	}
+}
+
+// Serve serves metrics on the configured metrics address. It blocks until the
+// listener fails, and returns immediately if no address is configured.
+func Serve() error {
+	if *metricsAddress == "" {
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	return http.ListenAndServe(*metricsAddress, mux)
+}
@@ -0,0 +1,96 @@
+package polls
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+
+	"github.com/carlaKC/lightning-poll/db"
+	ext_types "github.com/carlaKC/lightning-poll/types"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrAccessDenied = errors.New("This poll is private, please enter its access code")
+
+// slugLength is the number of random bytes in a poll's slug, which is hex
+// encoded so that it fits in the slug column.
+const slugLength = 16
+
+// newSlug returns a random slug for a poll, which identifies it in URLs
+// without revealing its ID or how many polls there are.
+func newSlug() (string, error) {
+	b := make([]byte, slugLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// accessCodeHash returns the bcrypt hash of a private poll's access code, which
+// is slow to compute so that stolen hashes are expensive to brute force.
+func accessCodeHash(code string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+// accessToken returns the token that remembers a client which entered a
+// private poll's access code. It is derived from the code's randomly salted
+// hash, so it cannot be guessed and is cheap to check on every request,
+// leaving codes to be checked only where attempts are rate limited.
+func accessToken(codeHash string) string {
+	token := sha256.Sum256([]byte("lightning-poll access:" + codeHash))
+	return hex.EncodeToString(token[:])
+}
+
+// UnlockPoll checks the access code entered for the poll with the slug
+// provided, returning the token that grants access to it if the code is
+// correct and ErrAccessDenied otherwise. Polls that are not private have no
+// access code and an empty token.
+func UnlockPoll(ctx context.Context, b Backends, slug, accessCode string) (string, error) {
+	dbPoll, err := b.GetPolls().LookupBySlug(ctx, b.GetConn(), slug)
+	if err == db.ErrNotFound {
+		return "", ErrPollNotFound
+	} else if err != nil {
+		return "", err
+	}
+
+	if dbPoll.Visibility != ext_types.VisibilityPrivate {
+		return "", nil
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(dbPoll.AccessCodeHash), []byte(accessCode))
+	if err != nil {
+		return "", ErrAccessDenied
+	}
+
+	return accessToken(dbPoll.AccessCodeHash), nil
+}
+
+// LookupBySlug returns the poll with the slug provided. Private polls are only
+// returned if the access token provided was issued by UnlockPoll for the
+// poll, otherwise ErrAccessDenied is returned.
+func LookupBySlug(ctx context.Context, b Backends, slug, token string) (*Poll, error) {
+	dbPoll, err := b.GetPolls().LookupBySlug(ctx, b.GetConn(), slug)
+	if err == db.ErrNotFound {
+		return nil, ErrPollNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	if dbPoll.Visibility == ext_types.VisibilityPrivate {
+		expected := accessToken(dbPoll.AccessCodeHash)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+			return nil, ErrAccessDenied
+		}
+	}
+
+	return LookupPoll(ctx, b, dbPoll.ID)
+}
@@ -0,0 +1,34 @@
+package polls
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestNewSlug(t *testing.T) {
+	slug, err := newSlug()
+	require.NoError(t, err)
+	assert.Len(t, slug, slugLength*2)
+
+	other, err := newSlug()
+	require.NoError(t, err)
+	assert.NotEqual(t, slug, other)
+}
+
+func TestAccessCodeHash(t *testing.T) {
+	hash, err := accessCodeHash("code")
+	require.NoError(t, err)
+	require.NoError(t, bcrypt.CompareHashAndPassword([]byte(hash), []byte("code")))
+	assert.Error(t, bcrypt.CompareHashAndPassword([]byte(hash), []byte("other")))
+
+	// hashes are salted, so polls with the same code have different hashes
+	// and tokens.
+	other, err := accessCodeHash("code")
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, other)
+	assert.NotEqual(t, accessToken(hash), accessToken(other))
+	assert.Equal(t, accessToken(hash), accessToken(hash))
+}
@@ -0,0 +1,99 @@
+package polls
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/carlaKC/lightning-poll/votes"
+	"github.com/pkg/errors"
+)
+
+var ErrNoAudit = errors.New("Poll has no audit, audits are available once a poll has closed")
+
+// Audit is a public record of the votes in a closed poll. Entries are sorted
+// by payment hash, and MerkleRoot is the root of their leaves that was
+// committed to when the poll closed. Signature is the zbase32 signature of
+// Message by the node with public key Pubkey, made when the poll closed.
+type Audit struct {
+	PollID     int64               `json:"poll_id"`
+	Question   string              `json:"question"`
+	Options    []*AuditOption      `json:"options"`
+	Votes      []*votes.AuditEntry `json:"votes"`
+	MerkleRoot string              `json:"merkle_root"`
+	Message    string              `json:"message"`
+	Signature  string              `json:"signature"`
+	Pubkey     string              `json:"pubkey"`
+}
+
+// AuditMessage returns the message that our node signs to commit to a poll's
+// audit root.
+func AuditMessage(pollID int64, root string) string {
+	return fmt.Sprintf("lightning-poll audit root: poll=%v root=%v", pollID, root)
+}
+
+// AuditOption is an option in a poll's audit, with its tally.
+type AuditOption struct {
+	ID    int64  `json:"id"`
+	Value string `json:"value"`
+	Votes int64  `json:"votes"`
+}
+
+// GetAudit returns the audit for a closed poll, revealing the preimages of
+// settled votes. It returns ErrNoAudit if the poll has not committed to an
+// audit root.
+func GetAudit(ctx context.Context, b Backends, id int64) (*Audit, error) {
+	poll, err := b.GetPolls().Lookup(ctx, b.GetConn(), id)
+	if err != nil {
+		return nil, err
+	}
+
+	if poll.AuditRoot == "" {
+		return nil, ErrNoAudit
+	}
+
+	entries, err := votes.AuditVotes(ctx, b, id, true)
+	if err != nil {
+		return nil, err
+	}
+
+	// the votes should not change after the poll is closed, so we refuse to
+	// publish an audit which does not match its committed root.
+	if root := votes.AuditRoot(entries); root != poll.AuditRoot {
+		return nil, errors.Errorf("audit root %v does not match committed root %v",
+			root, poll.AuditRoot)
+	}
+
+	options, err := b.GetOptions().ListByPoll(ctx, b.GetConn(), id)
+	if err != nil {
+		return nil, err
+	}
+
+	tally := make(map[int64]int64)
+	for _, e := range entries {
+		tally[e.OptionID]++
+	}
+
+	info, err := b.GetLND().GetInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	audit := &Audit{
+		PollID:     poll.ID,
+		Question:   poll.Question,
+		Votes:      entries,
+		MerkleRoot: poll.AuditRoot,
+		Message:    AuditMessage(poll.ID, poll.AuditRoot),
+		Signature:  poll.AuditSignature,
+		Pubkey:     info.IdentityPubkey,
+	}
+	for _, o := range options {
+		audit.Options = append(audit.Options, &AuditOption{
+			ID:    o.ID,
+			Value: o.Value,
+			Votes: tally[o.ID],
+		})
+	}
+
+	return audit, nil
+}
@@ -1,41 +1,146 @@
 package polls
 
 import (
-	"fmt"
-	"log"
+	"sync"
 	"time"
 
+	"github.com/carlaKC/lightning-poll/db"
+	"github.com/carlaKC/lightning-poll/health"
+	"github.com/carlaKC/lightning-poll/ledger"
+	"github.com/carlaKC/lightning-poll/logging"
 	poll_db "github.com/carlaKC/lightning-poll/polls/internal/db/polls"
 	"github.com/carlaKC/lightning-poll/polls/internal/types"
+	"github.com/carlaKC/lightning-poll/tracing"
 	"github.com/carlaKC/lightning-poll/votes"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/net/context"
 )
 
-func StartLoops(b Backends) {
-	go closePollsForever(b)
-	go updateMetricsForever(b)
+// Names and intervals of the background loops, which report their successful
+// iterations to the health package.
+const (
+	closePollsLoop = "polls/close"
+	reconcileLoop  = "polls/reconcile"
+	metricsLoop    = "polls/metrics"
+
+	closePollsInterval = time.Minute
+	reconcileInterval  = time.Minute * 10
+	metricsInterval    = time.Minute
+)
+
+// StartLoops starts the background loops for polls, which stop once ctx is
+// canceled and the iteration in progress has finished, marking wg done.
+func StartLoops(ctx context.Context, wg *sync.WaitGroup, b Backends) {
+	health.RegisterLoop(closePollsLoop, closePollsInterval)
+	health.RegisterLoop(metricsLoop, metricsInterval)
+	health.RegisterLoop(reconcileLoop, reconcileInterval)
+
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		closePollsForever(ctx, b)
+	}()
+	go func() {
+		defer wg.Done()
+		updateMetricsForever(ctx, b)
+	}()
+	go func() {
+		defer wg.Done()
+		reconcileForever(ctx, b)
+	}()
+}
+
+func reconcileForever(ctx context.Context, b Backends) {
+	for {
+		if err := reconcile(context.Background(), b); err != nil {
+			logging.From(ctx).Error("reconcile failed", "error", err)
+		} else {
+			health.Beat(reconcileLoop)
+		}
+
+		if !health.Wait(ctx, reconcileInterval) {
+			return
+		}
+	}
+}
+
+// reconcile repairs any safe discrepancies between our database and LND, and
+// reports the ones that need manual investigation.
+func reconcile(ctx context.Context, b Backends) error {
+	closeMu.Lock()
+	defer closeMu.Unlock()
+
+	discrepancies, err := Reconcile(ctx, b, true)
+	if err != nil {
+		return err
+	}
+
+	unresolved := make(map[string]int)
+	for _, d := range discrepancies {
+		logger := logging.From(ctx).With("kind", d.Kind, "id", d.ID, "safe", d.Safe,
+			"description", d.Description)
+
+		if d.Repaired {
+			logger.Info("reconcile repaired discrepancy")
+			reconcileRepaired.WithLabelValues(d.Kind).Inc()
+			continue
+		}
+
+		logger.Warn("reconcile found unresolved discrepancy")
+		unresolved[d.Kind]++
+	}
+
+	for _, kind := range []string{"vote", "poll"} {
+		reconcileUnresolved.WithLabelValues(kind).Set(float64(unresolved[kind]))
+	}
+
+	return nil
 }
 
-func closePollsForever(b Backends) {
+func closePollsForever(ctx context.Context, b Backends) {
 	for {
 		if err := closePolls(b); err != nil {
-			log.Printf("polls/ops: closePollsForever error: %v", err)
+			logging.From(ctx).Error("close polls failed", "error", err)
+		} else {
+			health.Beat(closePollsLoop)
+		}
+
+		if !health.Wait(ctx, closePollsInterval) {
+			return
 		}
-		time.Sleep(time.Minute * 1)
 	}
 }
 
+// closeMu prevents reconciliation from running while polls are being closed,
+// because closing polls is expected to leave votes and payouts temporarily out
+// of sync with LND.
+var closeMu sync.Mutex
+
 func closePolls(b Backends) error {
+	closeMu.Lock()
+	defer closeMu.Unlock()
+
 	ctx := context.Background()
 
-	polls, err := poll_db.ListExpired(ctx, b.GetDB())
+	polls, err := b.GetPolls().ListExpired(ctx, b.GetConn())
 	if err != nil {
 		return err
 	}
 
-	for _, poll := range polls {
-		if err := ClosePoll(ctx, b, poll); err != nil {
-			return err
+	// polls which failed part way through closing are left closed, and are
+	// closed again so that their remaining votes are released.
+	closed, err := b.GetPolls().ListByStatus(ctx, b.GetConn(), types.PollStatusClosed)
+	if err != nil {
+		return err
+	}
+
+	for _, poll := range append(closed, polls...) {
+		pollCtx := logging.With(ctx, logging.FieldPollID, poll.ID)
+
+		// a poll which fails to close is left for reconciliation, so we log
+		// the error and continue to close other polls.
+		if err := ClosePoll(pollCtx, b, poll); err != nil {
+			logging.From(pollCtx).Error("close poll failed", "error", err)
 		}
 	}
 
@@ -45,50 +150,103 @@ func closePolls(b Backends) error {
 // closePoll initiates the poll closing process
 // - update the poll to closed, so that it cannot receive any more votes
 // - return payments to voters, according to the chosen repayment scheme
-// - pay the creator the total remaining
-func ClosePoll(ctx context.Context, b Backends, poll *poll_db.DBPoll) error {
-	if err := poll_db.UpdateStatus(ctx, b.GetDB(), poll.ID, types.PollStatusCreated,
-		types.PollStatusClosed); err != nil {
+// - deduct the operator's fee, commit to the poll's votes and update the poll to released
+// - pay the creator and any other recipients their share of the total remaining
+//
+// Polls which are already closed resume from returning payments, because only
+// the votes which have not been released yet are released.
+func ClosePoll(ctx context.Context, b Backends, poll *poll_db.DBPoll) (err error) {
+	ctx, span := tracing.Start(ctx, "polls.ClosePoll")
+	span.SetAttributes(attribute.Int64(logging.FieldPollID, poll.ID))
+	defer tracing.End(span, &err)
+
+	if poll.Status == types.PollStatusClosed {
+		logging.From(ctx).Info("resuming close of poll")
+	} else if err := b.GetPolls().UpdateStatus(ctx, b.GetConn(), poll.ID,
+		types.PollStatusCreated, types.PollStatusClosed); err != nil {
 		return err
 	}
 
-	// all votes have been released, update poll's status
-	if err := poll_db.UpdateStatus(ctx, b.GetDB(), poll.ID, types.PollStatusClosed,
-		types.PollStatusReleased); err != nil {
+	settled, err := votes.ReleaseVotesForPoll(ctx, b, poll.ID, poll.RepayScheme.GetScheme())
+	if err != nil {
 		return err
 	}
 
-	amount, err := votes.ReleaseVotesForPoll(ctx, b, poll.ID, poll.RepayScheme.GetScheme())
+	// deduct the fee that the poll was created with before paying out the
+	// poll's recipients
+	fee := pollFee(poll).Calculate(settled)
+	amount := settled - fee
+
+	// the votes are final once they have been released, so we commit to them
+	// for the poll's audit.
+	entries, err := votes.AuditVotes(ctx, b, poll.ID, false)
 	if err != nil {
 		return err
 	}
 
-	// the poll creator does not need to be paid out.
-	if amount == 0 {
-		log.Printf("polls/ops: poll %v has no balance to pay out", poll.ID)
-		return poll_db.UpdateStatus(ctx, b.GetDB(), poll.ID, types.PollStatusReleased,
-			types.PollStatusPaidOut)
-	}
-
-	// update to paying out to prevent double sending if sync send payment fails
-	if err := poll_db.UpdateStatus(ctx, b.GetDB(), poll.ID, types.PollStatusReleased,
-		types.PollStatusPayingOut); err != nil {
+	// the root is signed with our node's key, so that anyone can check that
+	// it was committed to by us and has not been rewritten since.
+	root := votes.AuditRoot(entries)
+	signature, err := b.GetLND().SignMessage(ctx, []byte(AuditMessage(poll.ID, root)))
+	if err != nil {
 		return err
 	}
 
-	resp, err := b.GetLND().SendPaymentSync(ctx, poll.PayoutInvoice, amount)
+	// all votes have been released, so the poll's status is updated along with
+	// its fee and audit root so that they are recorded exactly once. If there
+	// is a balance to pay out, the poll is updated to paying out to prevent
+	// double sending if sync send payment fails.
+	err = db.WithTx(ctx, b.GetConn(), func(tx db.Handle) error {
+		if err := b.GetPolls().UpdateStatus(ctx, tx, poll.ID, types.PollStatusClosed,
+			types.PollStatusReleased); err != nil {
+			return err
+		}
+
+		if err := b.GetPolls().SetAuditRoot(ctx, tx, poll.ID, root, signature); err != nil {
+			return err
+		}
+
+		if err := ledger.RecordOperatorFee(ctx, tx, poll.ID, fee); err != nil {
+			return err
+		}
+
+		next := types.PollStatusPayingOut
+		if amount == 0 {
+			next = types.PollStatusPaidOut
+		}
+
+		return b.GetPolls().UpdateStatus(ctx, tx, poll.ID, types.PollStatusReleased, next)
+	})
 	if err != nil {
 		return err
 	}
-	if resp.PaymentError != "" {
-		return fmt.Errorf("polls/ops: closePoll %v error: %v", poll.ID, resp.PaymentError)
+
+	if fee > 0 {
+		logging.From(ctx).Info("charged operator fee", "fee", fee)
+	}
+
+	// the poll creator does not need to be paid out.
+	if amount == 0 {
+		logging.From(ctx).Info("poll has no balance to pay out")
+		return nil
+	}
+
+	if err := payRecipients(ctx, b, poll, amount); err != nil {
+		return err
 	}
 
 	// poll has been paid out, update to final state
-	if err := poll_db.UpdateStatus(ctx, b.GetDB(), poll.ID, types.PollStatusPayingOut,
+	if err := b.GetPolls().UpdateStatus(ctx, b.GetConn(), poll.ID, types.PollStatusPayingOut,
 		types.PollStatusPaidOut); err != nil {
 		return err
 	}
 
+	// the poll has been closed successfully, so an unbalanced ledger is logged
+	// for investigation rather than failing the close.
+	if err := ledger.CheckPollClosed(ctx, b.GetConn(), poll.ID); err != nil {
+		logging.From(ctx).Error("closed poll ledger check failed", "error", err)
+	}
+
+	logging.From(ctx).Info("poll closed", "settled", settled, "paid_out", amount)
 	return nil
 }
@@ -0,0 +1,54 @@
+package polls
+
+import (
+	"flag"
+
+	poll_db "github.com/carlaKC/lightning-poll/polls/internal/db/polls"
+)
+
+var (
+	operatorFeeSats    = flag.Int64("operator_fee_sats", 0, "Flat fee in satoshis deducted from each poll payout")
+	operatorFeePercent = flag.Int64("operator_fee_percent", 0, "Percentage of settled votes deducted from each poll payout")
+)
+
+// Fee is the service fee charged by the operator when a poll is paid out.
+type Fee struct {
+	FlatSats int64
+	Percent  int64
+}
+
+// GetOperatorFee returns the fee that the operator is currently charging, which
+// new polls are charged.
+func GetOperatorFee() Fee {
+	return Fee{
+		FlatSats: *operatorFeeSats,
+		Percent:  *operatorFeePercent,
+	}
+}
+
+// Calculate returns the fee due on a payout of amount. The fee is rounded
+// down and never exceeds the amount being paid out.
+func (f Fee) Calculate(amount int64) int64 {
+	fee := f.FlatSats + amount*f.Percent/100
+	if fee > amount {
+		return amount
+	}
+	if fee < 0 {
+		return 0
+	}
+
+	return fee
+}
+
+// Charged returns true if the operator charges any fee.
+func (f Fee) Charged() bool {
+	return f.FlatSats > 0 || f.Percent > 0
+}
+
+// pollFee returns the fee that a poll was charged when it was created.
+func pollFee(poll *poll_db.DBPoll) Fee {
+	return Fee{
+		FlatSats: poll.FeeSats,
+		Percent:  poll.FeePercent,
+	}
+}
@@ -0,0 +1,24 @@
+package polls
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeeCalculate(t *testing.T) {
+	// no fee charged
+	assert.Equal(t, int64(0), Fee{}.Calculate(1000))
+
+	// flat fee only
+	assert.Equal(t, int64(10), Fee{FlatSats: 10}.Calculate(1000))
+
+	// percentage fee is rounded down
+	assert.Equal(t, int64(10), Fee{Percent: 1}.Calculate(1099))
+
+	// flat and percentage fees are combined
+	assert.Equal(t, int64(60), Fee{FlatSats: 10, Percent: 5}.Calculate(1000))
+
+	// fee never exceeds the payout
+	assert.Equal(t, int64(5), Fee{FlatSats: 10}.Calculate(5))
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"math/rand"
+	"strings"
 
 	"github.com/carlaKC/lightning-poll/db"
 )
@@ -14,9 +15,10 @@ type row interface {
 	Scan(dest ...interface{}) error
 }
 
-func Create(ctx context.Context, dbc *sql.DB, pollID int64, value string) (int64, error) {
+func Create(ctx context.Context, dbc db.Handle, pollID int64, value string) (int64, error) {
 	id := rand.Int63()
-	r, err := dbc.ExecContext(ctx, "insert into poll_options set id=?, poll_id=?, value=?", id, pollID, value)
+	r, err := dbc.ExecContext(ctx, "insert into poll_options (id, poll_id, value) "+
+		"values (?, ?, ?)", id, pollID, value)
 	if err != nil {
 		return 0, err
 	}
@@ -39,7 +41,7 @@ func scan(r row) (option DBOption, err error) {
 	return option, nil
 }
 
-func list(ctx context.Context, dbc *sql.DB, query string, args ...interface{}) (options []*DBOption, err error) {
+func list(ctx context.Context, dbc db.Handle, query string, args ...interface{}) (options []*DBOption, err error) {
 	rows, err := dbc.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
@@ -56,6 +58,36 @@ func list(ctx context.Context, dbc *sql.DB, query string, args ...interface{}) (
 	return options, rows.Err()
 }
 
-func ListByPoll(ctx context.Context, dbc *sql.DB, pollID int64) ([]*DBOption, error) {
+func ListByPoll(ctx context.Context, dbc db.Handle, pollID int64) ([]*DBOption, error) {
 	return list(ctx, dbc, "select "+cols+" from poll_options where poll_id=?", pollID)
 }
+
+// ListByPolls returns the options of all of the polls provided in a single
+// query, so that listing polls does not need a query for each of them.
+func ListByPolls(ctx context.Context, dbc db.Handle, pollIDs []int64) ([]*DBOption, error) {
+	if len(pollIDs) == 0 {
+		return nil, nil
+	}
+
+	args := make([]interface{}, len(pollIDs))
+	for i, id := range pollIDs {
+		args[i] = id
+	}
+
+	return list(ctx, dbc, "select "+cols+" from poll_options where poll_id in ("+
+		strings.TrimSuffix(strings.Repeat("?, ", len(pollIDs)), ", ")+")", args...)
+}
+
+// LookupInPoll returns an option if it belongs to the poll provided, and
+// db.ErrNotFound otherwise.
+func LookupInPoll(ctx context.Context, dbc db.Handle, pollID, id int64) (*DBOption, error) {
+	row := dbc.QueryRowContext(ctx, "select "+cols+" from poll_options where id=? "+
+		"and poll_id=?", id, pollID)
+	opt, err := scan(row)
+	if err == sql.ErrNoRows {
+		return nil, db.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &opt, nil
+}
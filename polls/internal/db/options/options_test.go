@@ -2,7 +2,6 @@ package options_test
 
 import (
 	"context"
-	"database/sql"
 	"testing"
 
 	"github.com/carlaKC/lightning-poll/db"
@@ -15,7 +14,7 @@ var (
 	testValue  = "yes"
 )
 
-func setup(t *testing.T) (context.Context, *sql.DB) {
+func setup(t *testing.T) (context.Context, db.Conn) {
 	return context.Background(), db.ConnectForTesting(t)
 }
 
@@ -46,3 +45,21 @@ func TestListByPoll(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Len(t, opts, 1)
 }
+
+func TestLookupInPoll(t *testing.T) {
+	ctx, dbc := setup(t)
+
+	id, err := options.Create(ctx, dbc, testPollID, testValue)
+	assert.NoError(t, err)
+
+	tx, err := dbc.BeginTx(ctx, nil)
+	assert.NoError(t, err)
+	defer tx.Rollback()
+
+	opt, err := options.LookupInPoll(ctx, tx, testPollID, id)
+	assert.NoError(t, err)
+	assert.Equal(t, testValue, opt.Value)
+
+	_, err = options.LookupInPoll(ctx, tx, testPollID+1, id)
+	assert.Equal(t, db.ErrNotFound, err)
+}
@@ -3,7 +3,9 @@ package polls
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"math/rand"
+	"strings"
 	"time"
 
 	"github.com/carlaKC/lightning-poll/db"
@@ -11,25 +13,35 @@ import (
 	ext_types "github.com/carlaKC/lightning-poll/types"
 )
 
-var cols = "id, status, created_at,expires_at, question, expiry_seconds, repay_scheme, vote_sats, payout_invoice"
+var cols = "id, status, created_at,expires_at, question, expiry_seconds, repay_scheme, vote_sats, fee_sats, fee_percent, payout_invoice, audit_root, audit_signature, creator_key, one_vote_per_identity, visibility, slug, access_code_hash"
 
 type row interface {
 	Scan(dest ...interface{}) error
 }
 
-func Create(ctx context.Context, dbc *sql.DB, question, payoutInvoice, email string,
-	repayScheme ext_types.RepayScheme, expirySeconds, voteSats int64) (int64, error) {
+// Create adds a poll. The creator key is the linking key of the user who
+// created the poll, which is empty if they were not logged in. The slug
+// identifies the poll in URLs, and the access code hash is only set for
+// private polls.
+func Create(ctx context.Context, dbc db.Handle, question, payoutInvoice, email, creatorKey string,
+	repayScheme ext_types.RepayScheme, expirySeconds, voteSats, feeSats, feePercent int64,
+	oneVotePerIdentity bool, visibility ext_types.Visibility, slug,
+	accessCodeHash string) (int64, error) {
 
 	id := rand.Int63()
 	nullEmail := sql.NullString{String: email, Valid: email != ""}
+	nullKey := sql.NullString{String: creatorKey, Valid: creatorKey != ""}
+	nullHash := sql.NullString{String: accessCodeHash, Valid: accessCodeHash != ""}
 	expires := time.Duration(expirySeconds)
 	now := time.Now()
 
-	r, err := dbc.ExecContext(ctx, "insert into polls set id=?, status=?, "+
-		"created_at=?, expires_at=?, question=?, expiry_seconds=?, repay_scheme=?, "+
-		"vote_sats=?, payout_invoice=?, email=?", id, types.PollStatusCreated, now,
-		now.Add(time.Second*expires), question, expirySeconds,
-		repayScheme, voteSats, payoutInvoice, nullEmail)
+	r, err := dbc.ExecContext(ctx, "insert into polls (id, status, created_at, "+
+		"expires_at, question, expiry_seconds, repay_scheme, vote_sats, fee_sats, "+
+		"fee_percent, payout_invoice, email, creator_key, one_vote_per_identity, "+
+		"visibility, slug, access_code_hash) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, "+
+		"?, ?, ?, ?, ?)", id, types.PollStatusCreated, now, now.Add(time.Second*expires),
+		question, expirySeconds, repayScheme, voteSats, feeSats, feePercent, payoutInvoice,
+		nullEmail, nullKey, oneVotePerIdentity, visibility, slug, nullHash)
 	if err != nil {
 		return 0, err
 	}
@@ -47,25 +59,74 @@ type DBPoll struct {
 	RepayScheme   ext_types.RepayScheme
 	VoteSats      int64
 	PayoutInvoice string
+
+	// FeeSats and FeePercent are the operator's fee when the poll was
+	// created, which is charged when it is paid out.
+	FeeSats    int64
+	FeePercent int64
+
+	// AuditRoot is the Merkle root of the poll's votes, which is set when the
+	// poll is closed along with our node's signature of it.
+	AuditRoot      string
+	AuditSignature string
+
+	// CreatorKey is the linking key of the poll's creator, if they were
+	// logged in.
+	CreatorKey string
+
+	// OneVotePerIdentity is true if voters must be logged in to vote, and
+	// can only have one vote in the poll.
+	OneVotePerIdentity bool
+
+	Visibility ext_types.Visibility
+
+	// Slug is the unguessable identifier of the poll in URLs.
+	Slug string
+
+	// AccessCodeHash is the salted hash of a private poll's access code.
+	AccessCodeHash string
 }
 
-func scan(r row) (poll DBPoll, err error) {
-	var invoice sql.NullString
+// scan reads a poll from a row, followed by any extra columns selected after
+// the poll's columns.
+func scan(r row, extra ...interface{}) (poll DBPoll, err error) {
+	var invoice, auditRoot, auditSignature, creatorKey, accessCodeHash sql.NullString
 
-	err = r.Scan(&poll.ID, &poll.Status, &poll.CreatedAt, &poll.ExpiresAt, &poll.Question,
-		&poll.ExpirySeconds, &poll.RepayScheme, &poll.VoteSats, &invoice)
+	dest := []interface{}{&poll.ID, &poll.Status, &poll.CreatedAt, &poll.ExpiresAt,
+		&poll.Question, &poll.ExpirySeconds, &poll.RepayScheme, &poll.VoteSats,
+		&poll.FeeSats, &poll.FeePercent, &invoice,
+		&auditRoot, &auditSignature, &creatorKey, &poll.OneVotePerIdentity, &poll.Visibility, &poll.Slug,
+		&accessCodeHash}
+
+	err = r.Scan(append(dest, extra...)...)
 	if err != nil {
 		return poll, err
 	}
 
+	if accessCodeHash.Valid {
+		poll.AccessCodeHash = accessCodeHash.String
+	}
+
 	if invoice.Valid {
 		poll.PayoutInvoice = invoice.String
 	}
 
+	if auditRoot.Valid {
+		poll.AuditRoot = auditRoot.String
+	}
+
+	if auditSignature.Valid {
+		poll.AuditSignature = auditSignature.String
+	}
+
+	if creatorKey.Valid {
+		poll.CreatorKey = creatorKey.String
+	}
+
 	return poll, nil
 }
 
-func list(ctx context.Context, dbc *sql.DB, query string, args ...interface{}) (polls []*DBPoll, err error) {
+func list(ctx context.Context, dbc db.Handle, query string, args ...interface{}) (polls []*DBPoll, err error) {
 	rows, err := dbc.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
@@ -82,7 +143,7 @@ func list(ctx context.Context, dbc *sql.DB, query string, args ...interface{}) (
 	return polls, rows.Err()
 }
 
-func Lookup(ctx context.Context, dbc *sql.DB, id int64) (*DBPoll, error) {
+func Lookup(ctx context.Context, dbc db.Handle, id int64) (*DBPoll, error) {
 	row := dbc.QueryRowContext(ctx, "select "+cols+" from polls where id=?", id)
 	poll, err := scan(row)
 	if err == sql.ErrNoRows {
@@ -93,11 +154,49 @@ func Lookup(ctx context.Context, dbc *sql.DB, id int64) (*DBPoll, error) {
 	return &poll, nil
 }
 
-func ListByStatus(ctx context.Context, dbc *sql.DB, status types.PollStatus) ([]*DBPoll, error) {
+// LookupForUpdate returns a poll and, when run in a transaction, locks it until
+// the transaction completes so that its status cannot change in the meantime.
+func LookupForUpdate(ctx context.Context, dbc db.Handle, id int64) (*DBPoll, error) {
+	row := dbc.QueryRowContext(ctx, "select "+cols+" from polls where id=? for update", id)
+	poll, err := scan(row)
+	if err == sql.ErrNoRows {
+		return nil, db.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &poll, nil
+}
+
+// LookupBySlug returns the poll with the slug provided.
+func LookupBySlug(ctx context.Context, dbc db.Handle, slug string) (*DBPoll, error) {
+	row := dbc.QueryRowContext(ctx, "select "+cols+" from polls where slug=?", slug)
+	poll, err := scan(row)
+	if err == sql.ErrNoRows {
+		return nil, db.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &poll, nil
+}
+
+func ListByStatus(ctx context.Context, dbc db.Handle, status types.PollStatus) ([]*DBPoll, error) {
 	return list(ctx, dbc, "select "+cols+" from polls where status=?", status)
 }
 
-func UpdateStatus(ctx context.Context, dbc *sql.DB, id int64, fromStatus, toStatus types.PollStatus) error {
+// ListByStatusAndVisibility returns the polls in a status which have the
+// visibility provided.
+func ListByStatusAndVisibility(ctx context.Context, dbc db.Handle, status types.PollStatus,
+	visibility ext_types.Visibility) ([]*DBPoll, error) {
+	return list(ctx, dbc, "select "+cols+" from polls where status=? and visibility=?",
+		status, visibility)
+}
+
+// ListByCreator returns the polls created by the linking key provided.
+func ListByCreator(ctx context.Context, dbc db.Handle, creatorKey string) ([]*DBPoll, error) {
+	return list(ctx, dbc, "select "+cols+" from polls where creator_key=?", creatorKey)
+}
+
+func UpdateStatus(ctx context.Context, dbc db.Handle, id int64, fromStatus, toStatus types.PollStatus) error {
 	r, err := dbc.ExecContext(ctx, "update polls set status=? where id=? and "+
 		"status=?", toStatus, id, fromStatus)
 	if err != nil {
@@ -115,8 +214,248 @@ func UpdateStatus(ctx context.Context, dbc *sql.DB, id int64, fromStatus, toStat
 	return nil
 }
 
+// SetAuditRoot sets a poll's audit root and its signature. Roots are committed
+// to once, so an error is returned if the poll already has one.
+func SetAuditRoot(ctx context.Context, dbc db.Handle, id int64, root, signature string) error {
+	r, err := dbc.ExecContext(ctx, "update polls set audit_root=?, audit_signature=? "+
+		"where id=? and audit_root is null", root, signature, id)
+	if err != nil {
+		return err
+	}
+
+	return db.CheckRowsAffected(r, 1)
+}
+
+// CountByStatus returns the number of polls in each status.
+func CountByStatus(ctx context.Context, dbc db.Handle) (map[types.PollStatus]int64, error) {
+	rows, err := dbc.QueryContext(ctx, "select status, count(*) from polls group by status")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[types.PollStatus]int64)
+	for rows.Next() {
+		var (
+			status types.PollStatus
+			count  int64
+		)
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, err
+		}
+		counts[status] = count
+	}
+
+	return counts, rows.Err()
+}
+
 // ListExpired returns a list of created votes which have expired
-func ListExpired(ctx context.Context, dbc *sql.DB) ([]*DBPoll, error) {
+func ListExpired(ctx context.Context, dbc db.Handle) ([]*DBPoll, error) {
 	return list(ctx, dbc, "select "+cols+" from polls where expires_at<now() "+
 		"and status=?", types.PollStatusCreated)
 }
+
+// Sort orders a listing of polls.
+type Sort int
+
+const (
+	// SortClosesAt lists the polls which close soonest first.
+	SortClosesAt Sort = iota
+
+	// SortTotalSats lists the polls with the most satoshis paid for counted
+	// votes first.
+	SortTotalSats
+
+	// SortVoteCount lists the polls with the most counted votes first.
+	SortVoteCount
+)
+
+// orderBy is the order clause of each sort. Ties are broken by close time and
+// ID so that pages are stable.
+var orderBy = map[Sort]string{
+	SortClosesAt:  "expires_at, id",
+	SortTotalSats: "listed_sats desc, expires_at, id",
+	SortVoteCount: "listed_votes desc, expires_at, id",
+}
+
+// ListFilter selects a page of polls to list.
+type ListFilter struct {
+	Statuses   []types.PollStatus
+	Visibility ext_types.Visibility
+
+	// Terms matches polls which have a search term starting with each of
+	// them. All polls are matched if it is empty.
+	Terms []string
+
+	// Tag matches polls which have it. All polls are matched if it is empty.
+	Tag string
+
+	Sort   Sort
+	Offset int64
+	Limit  int64
+
+	// CountedVotes are the statuses of votes which count towards a poll's
+	// totals.
+	CountedVotes []int
+}
+
+// DBPollSummary is a listed poll, with the totals of its counted votes.
+type DBPollSummary struct {
+	DBPoll
+	VoteCount int64
+	TotalSats int64
+}
+
+// placeholders returns n comma separated placeholders.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// escapeLike escapes the wildcards in a like pattern, using the default
+// backslash escape character.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// ListPage returns a page of polls matching the filter provided, along with
+// the totals of their counted votes. When polls are sorted by their totals,
+// votes are totalled in the same query for the polls which match the filter.
+// Otherwise the page is selected first, and only its polls are totalled.
+func ListPage(ctx context.Context, dbc db.Handle, f ListFilter) ([]*DBPollSummary, error) {
+	if len(f.Statuses) == 0 || len(f.CountedVotes) == 0 {
+		return nil, nil
+	}
+
+	order, ok := orderBy[f.Sort]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort: %v", f.Sort)
+	}
+
+	where, whereArgs := listWhere(f)
+
+	if f.Sort == SortClosesAt {
+		dbPolls, err := list(ctx, dbc, "select "+cols+" from polls where "+where+
+			" order by "+order+" limit ? offset ?", append(whereArgs, f.Limit, f.Offset)...)
+		if err != nil {
+			return nil, err
+		}
+
+		return withTotals(ctx, dbc, dbPolls, f.CountedVotes)
+	}
+
+	var args []interface{}
+	for _, s := range f.CountedVotes {
+		args = append(args, s)
+	}
+	args = append(args, whereArgs...)
+	args = append(args, whereArgs...)
+	args = append(args, f.Limit, f.Offset)
+
+	// totals are coalesced before they are sorted, because MySQL and Postgres
+	// sort nulls differently.
+	query := "select " + cols + ", coalesce(vote_count, 0) as listed_votes, " +
+		"coalesce(total_sats, 0) as listed_sats from polls left join (select " +
+		"votes.poll_id, count(*) as vote_count, coalesce(sum(votes.settle_amount), 0) " +
+		"as total_sats from votes join polls on polls.id=votes.poll_id where " +
+		"votes.status in (" + placeholders(len(f.CountedVotes)) + ") and " + where +
+		" group by votes.poll_id) totals on totals.poll_id=polls.id where " + where +
+		" order by " + order + " limit ? offset ?"
+
+	rows, err := dbc.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var polls []*DBPollSummary
+	for rows.Next() {
+		var summary DBPollSummary
+		summary.DBPoll, err = scan(rows, &summary.VoteCount, &summary.TotalSats)
+		if err != nil {
+			return nil, err
+		}
+		polls = append(polls, &summary)
+	}
+
+	return polls, rows.Err()
+}
+
+// listWhere returns the conditions that select the polls matching a filter,
+// and their arguments.
+func listWhere(f ListFilter) (string, []interface{}) {
+	var args []interface{}
+	for _, s := range f.Statuses {
+		args = append(args, s)
+	}
+	args = append(args, f.Visibility)
+
+	where := "polls.status in (" + placeholders(len(f.Statuses)) + ") and " +
+		"polls.visibility=?"
+
+	for _, term := range f.Terms {
+		where += " and exists (select 1 from poll_terms where " +
+			"poll_terms.poll_id=polls.id and poll_terms.term like ?)"
+		args = append(args, escapeLike(term)+"%")
+	}
+
+	if f.Tag != "" {
+		where += " and exists (select 1 from poll_tags where poll_tags.poll_id=polls.id " +
+			"and poll_tags.tag=?)"
+		args = append(args, f.Tag)
+	}
+
+	return where, args
+}
+
+// withTotals totals the counted votes of the polls provided in a single query.
+func withTotals(ctx context.Context, dbc db.Handle, dbPolls []*DBPoll,
+	countedVotes []int) ([]*DBPollSummary, error) {
+
+	if len(dbPolls) == 0 {
+		return nil, nil
+	}
+
+	var args []interface{}
+	for _, p := range dbPolls {
+		args = append(args, p.ID)
+	}
+	for _, s := range countedVotes {
+		args = append(args, s)
+	}
+
+	rows, err := dbc.QueryContext(ctx, "select poll_id, count(*), "+
+		"coalesce(sum(settle_amount), 0) from votes where poll_id in ("+
+		placeholders(len(dbPolls))+") and status in ("+placeholders(len(countedVotes))+
+		") group by poll_id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	totals := make(map[int64]*DBPollSummary)
+	for rows.Next() {
+		var (
+			id      int64
+			summary DBPollSummary
+		)
+		if err := rows.Scan(&id, &summary.VoteCount, &summary.TotalSats); err != nil {
+			return nil, err
+		}
+		totals[id] = &summary
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	polls := make([]*DBPollSummary, 0, len(dbPolls))
+	for _, p := range dbPolls {
+		summary, ok := totals[p.ID]
+		if !ok {
+			summary = &DBPollSummary{}
+		}
+		summary.DBPoll = *p
+		polls = append(polls, summary)
+	}
+
+	return polls, nil
+}
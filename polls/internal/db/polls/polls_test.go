@@ -2,14 +2,18 @@ package polls_test
 
 import (
 	"context"
-	"database/sql"
+	"fmt"
+	"math/rand"
 	"testing"
 
 	"github.com/carlaKC/lightning-poll/db"
+	"github.com/carlaKC/lightning-poll/polls/internal/db/options"
 	"github.com/carlaKC/lightning-poll/polls/internal/db/polls"
+	"github.com/carlaKC/lightning-poll/polls/internal/db/terms"
 	"github.com/carlaKC/lightning-poll/polls/internal/types"
 	ext_types "github.com/carlaKC/lightning-poll/types"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var (
@@ -21,28 +25,47 @@ var (
 	testUser     = int64(123)
 )
 
-func setup(t *testing.T) (context.Context, *sql.DB) {
+// newSlug returns a unique slug for a test poll.
+func newSlug() string {
+	return fmt.Sprintf("%x", rand.Int63())
+}
+
+func setup(t *testing.T) (context.Context, db.Conn) {
 	return context.Background(), db.ConnectForTesting(t)
 }
 
 func TestCreate(t *testing.T) {
 	ctx, dbc := setup(t)
-	_, err := polls.Create(ctx, dbc, testQuestion, testInvoice, "", testRepay, testExpiry, testVoteSats)
+	_, err := polls.Create(ctx, dbc, testQuestion, testInvoice, "", "", testRepay, testExpiry, testVoteSats, 0, 0, false, ext_types.VisibilityPublic, newSlug(), "")
 	assert.NoError(t, err)
 }
 
 func TestLookup(t *testing.T) {
 	ctx, dbc := setup(t)
-	id, err := polls.Create(ctx, dbc, testQuestion, testInvoice, "", testRepay, testExpiry, testVoteSats)
+	id, err := polls.Create(ctx, dbc, testQuestion, testInvoice, "", "", testRepay, testExpiry, testVoteSats, 0, 0, false, ext_types.VisibilityPublic, newSlug(), "")
 	assert.NoError(t, err)
 
 	_, err = polls.Lookup(ctx, dbc, id)
 	assert.NoError(t, err)
 }
 
+func TestLookupForUpdate(t *testing.T) {
+	ctx, dbc := setup(t)
+	id, err := polls.Create(ctx, dbc, testQuestion, testInvoice, "", "", testRepay, testExpiry, testVoteSats, 0, 0, false, ext_types.VisibilityPublic, newSlug(), "")
+	assert.NoError(t, err)
+
+	tx, err := dbc.BeginTx(ctx, nil)
+	assert.NoError(t, err)
+	defer tx.Rollback()
+
+	poll, err := polls.LookupForUpdate(ctx, tx, id)
+	assert.NoError(t, err)
+	assert.Equal(t, types.PollStatusCreated, poll.Status)
+}
+
 func TestListByStatus(t *testing.T) {
 	ctx, dbc := setup(t)
-	_, err := polls.Create(ctx, dbc, testQuestion, testInvoice, "", testRepay, testExpiry, testVoteSats)
+	_, err := polls.Create(ctx, dbc, testQuestion, testInvoice, "", "", testRepay, testExpiry, testVoteSats, 0, 0, false, ext_types.VisibilityPublic, newSlug(), "")
 	assert.NoError(t, err)
 
 	pList, err := polls.ListByStatus(ctx, dbc, types.PollStatusCreated)
@@ -56,7 +79,7 @@ func TestListByStatus(t *testing.T) {
 
 func TestUpdateStatus(t *testing.T) {
 	ctx, dbc := setup(t)
-	id, err := polls.Create(ctx, dbc, testQuestion, testInvoice, "", testRepay, testExpiry, testVoteSats)
+	id, err := polls.Create(ctx, dbc, testQuestion, testInvoice, "", "", testRepay, testExpiry, testVoteSats, 0, 0, false, ext_types.VisibilityPublic, newSlug(), "")
 	assert.NoError(t, err)
 
 	err = polls.UpdateStatus(ctx, dbc, id, types.PollStatusCreated, types.PollStatusClosed)
@@ -65,3 +88,108 @@ func TestUpdateStatus(t *testing.T) {
 	err = polls.UpdateStatus(ctx, dbc, id, types.PollStatusClosed, types.PollStatusClosed)
 	assert.Equal(t, db.ErrUnexpectedRowCount, err)
 }
+
+func TestCountByStatus(t *testing.T) {
+	ctx, dbc := setup(t)
+
+	counts, err := polls.CountByStatus(ctx, dbc)
+	assert.NoError(t, err)
+	assert.Len(t, counts, 0)
+
+	id, err := polls.Create(ctx, dbc, testQuestion, testInvoice, "", "", testRepay, testExpiry, testVoteSats, 0, 0, false, ext_types.VisibilityPublic, newSlug(), "")
+	assert.NoError(t, err)
+	_, err = polls.Create(ctx, dbc, testQuestion, testInvoice, "", "", testRepay, testExpiry, testVoteSats, 0, 0, false, ext_types.VisibilityPublic, newSlug(), "")
+	assert.NoError(t, err)
+
+	err = polls.UpdateStatus(ctx, dbc, id, types.PollStatusCreated, types.PollStatusClosed)
+	assert.NoError(t, err)
+
+	counts, err = polls.CountByStatus(ctx, dbc)
+	assert.NoError(t, err)
+	assert.Equal(t, map[types.PollStatus]int64{
+		types.PollStatusCreated: 1,
+		types.PollStatusClosed:  1,
+	}, counts)
+}
+
+// createVote inserts a vote directly, because votes are stored by the votes
+// package.
+func createVote(t *testing.T, dbc db.Conn, pollID, optionID, amount int64, status int) {
+	_, err := dbc.ExecContext(context.Background(), "insert into votes (id, created_at, "+
+		"expires_at, poll_id, option_id, pay_req, payment_hash, preimage, settle_amount, "+
+		"status) values (?, now(), now(), ?, ?, '', '', '', ?, ?)", rand.Int63(), pollID,
+		optionID, amount, status)
+	require.NoError(t, err)
+}
+
+func TestListPage(t *testing.T) {
+	ctx, dbc := setup(t)
+
+	few, err := polls.Create(ctx, dbc, testQuestion, testInvoice, "", "", testRepay, testExpiry, testVoteSats, 0, 0, false, ext_types.VisibilityPublic, newSlug(), "")
+	require.NoError(t, err)
+	many, err := polls.Create(ctx, dbc, testQuestion, testInvoice, "", "", testRepay, testExpiry+10, testVoteSats, 0, 0, false, ext_types.VisibilityPublic, newSlug(), "")
+	require.NoError(t, err)
+	none, err := polls.Create(ctx, dbc, testQuestion, testInvoice, "", "", testRepay, testExpiry+20, testVoteSats, 0, 0, false, ext_types.VisibilityPublic, newSlug(), "")
+	require.NoError(t, err)
+
+	option, err := options.Create(ctx, dbc, few, "Cheese")
+	require.NoError(t, err)
+	require.NoError(t, terms.Create(ctx, dbc, few, "cheese"))
+	createVote(t, dbc, few, option, 500, 3)
+
+	option, err = options.Create(ctx, dbc, many, "ham")
+	require.NoError(t, err)
+	createVote(t, dbc, many, option, 100, 3)
+	createVote(t, dbc, many, option, 100, 3)
+	// uncounted votes are not totalled.
+	createVote(t, dbc, many, option, 1000, 6)
+
+	filter := polls.ListFilter{
+		Statuses:     []types.PollStatus{types.PollStatusCreated},
+		Visibility:   ext_types.VisibilityPublic,
+		Sort:         polls.SortTotalSats,
+		Limit:        10,
+		CountedVotes: []int{3},
+	}
+
+	list, err := polls.ListPage(ctx, dbc, filter)
+	require.NoError(t, err)
+	require.Len(t, list, 3)
+	assert.Equal(t, []int64{few, many, none}, []int64{list[0].ID, list[1].ID, list[2].ID})
+	assert.Equal(t, int64(500), list[0].TotalSats)
+	assert.Equal(t, int64(1), list[0].VoteCount)
+	assert.Equal(t, int64(200), list[1].TotalSats)
+	assert.Equal(t, int64(2), list[1].VoteCount)
+	assert.Equal(t, int64(0), list[2].TotalSats)
+
+	filter.Sort = polls.SortVoteCount
+	list, err = polls.ListPage(ctx, dbc, filter)
+	require.NoError(t, err)
+	require.Len(t, list, 3)
+	assert.Equal(t, []int64{many, few, none}, []int64{list[0].ID, list[1].ID, list[2].ID})
+
+	// searches match the start of terms, and polls are totalled after the
+	// page is selected when they are sorted by close time.
+	filter.Terms = []string{"chee"}
+	filter.Sort = polls.SortClosesAt
+	list, err = polls.ListPage(ctx, dbc, filter)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, few, list[0].ID)
+	assert.Equal(t, int64(500), list[0].TotalSats)
+	assert.Equal(t, int64(1), list[0].VoteCount)
+
+	// wildcards are matched literally.
+	filter.Terms = []string{"%"}
+	list, err = polls.ListPage(ctx, dbc, filter)
+	require.NoError(t, err)
+	assert.Empty(t, list)
+
+	filter.Terms = nil
+	list, err = polls.ListPage(ctx, dbc, filter)
+	require.NoError(t, err)
+	require.Len(t, list, 3)
+	assert.Equal(t, []int64{few, many, none}, []int64{list[0].ID, list[1].ID, list[2].ID})
+	assert.Equal(t, int64(200), list[1].TotalSats)
+	assert.Equal(t, int64(0), list[2].TotalSats)
+}
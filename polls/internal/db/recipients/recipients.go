@@ -0,0 +1,113 @@
+package recipients
+
+import (
+	"context"
+	"database/sql"
+	"math/rand"
+
+	"github.com/carlaKC/lightning-poll/db"
+	"github.com/carlaKC/lightning-poll/polls/internal/types"
+)
+
+var cols = "id, poll_id, position, share_percent, payout_invoice, status, amount_sats, remainder_sats, payment_hash"
+
+type row interface {
+	Scan(dest ...interface{}) error
+}
+
+// Create adds a payout recipient for a poll. Position determines the order in
+// which recipients are paid, the poll creator is always at position 0.
+func Create(ctx context.Context, dbc db.Handle, pollID, position, sharePercent int64,
+	payoutInvoice string) (int64, error) {
+
+	id := rand.Int63()
+	r, err := dbc.ExecContext(ctx, "insert into payout_recipients (id, poll_id, position, "+
+		"share_percent, payout_invoice, status) values (?, ?, ?, ?, ?, ?)", id, pollID, position,
+		sharePercent, payoutInvoice, types.PayoutStatusCreated)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, db.CheckRowsAffected(r, 1)
+}
+
+type DBRecipient struct {
+	ID            int64
+	PollID        int64
+	Position      int64
+	SharePercent  int64
+	PayoutInvoice string
+	Status        types.PayoutStatus
+	AmountSats    int64
+	RemainderSats int64
+	PaymentHash   string
+}
+
+func scan(r row) (recipient DBRecipient, err error) {
+	var amount, remainder sql.NullInt64
+	var hash sql.NullString
+
+	err = r.Scan(&recipient.ID, &recipient.PollID, &recipient.Position, &recipient.SharePercent,
+		&recipient.PayoutInvoice, &recipient.Status, &amount, &remainder, &hash)
+	if err != nil {
+		return recipient, err
+	}
+
+	if amount.Valid {
+		recipient.AmountSats = amount.Int64
+	}
+	if remainder.Valid {
+		recipient.RemainderSats = remainder.Int64
+	}
+	if hash.Valid {
+		recipient.PaymentHash = hash.String
+	}
+
+	return recipient, nil
+}
+
+func list(ctx context.Context, dbc db.Handle, query string, args ...interface{}) (recipients []*DBRecipient, err error) {
+	rows, err := dbc.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		recipient, err := scan(rows)
+		if err != nil {
+			return recipients, err
+		}
+		recipients = append(recipients, &recipient)
+	}
+
+	return recipients, rows.Err()
+}
+
+// ListByPoll returns the recipients for a poll, ordered by position.
+func ListByPoll(ctx context.Context, dbc db.Handle, pollID int64) ([]*DBRecipient, error) {
+	return list(ctx, dbc, "select "+cols+" from payout_recipients where poll_id=? "+
+		"order by position", pollID)
+}
+
+// StartPayout records the amount that a recipient is being paid and moves
+// them into the paying out state so that they are not paid twice.
+func StartPayout(ctx context.Context, dbc db.Handle, id, amount, remainder int64, paymentHash string) error {
+	r, err := dbc.ExecContext(ctx, "update payout_recipients set status=?, amount_sats=?, "+
+		"remainder_sats=?, payment_hash=? where id=? and status=?", types.PayoutStatusPayingOut,
+		amount, remainder, paymentHash, id, types.PayoutStatusCreated)
+	if err != nil {
+		return err
+	}
+
+	return db.CheckRowsAffected(r, 1)
+}
+
+func UpdateStatus(ctx context.Context, dbc db.Handle, id int64, fromStatus, toStatus types.PayoutStatus) error {
+	r, err := dbc.ExecContext(ctx, "update payout_recipients set status=? where id=? and "+
+		"status=?", toStatus, id, fromStatus)
+	if err != nil {
+		return err
+	}
+
+	return db.CheckRowsAffected(r, 1)
+}
@@ -0,0 +1,79 @@
+package recipients_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/carlaKC/lightning-poll/db"
+	"github.com/carlaKC/lightning-poll/polls/internal/db/recipients"
+	"github.com/carlaKC/lightning-poll/polls/internal/types"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testPollID  = int64(54678)
+	testInvoice = "lnsb100n1pwfm4pwpp5dn7dgk3h98yqr9lxs79g98tkwl36gxhck6j66n23teftyuje9avqdq8w3jhxaqcqzysxqzfvyhv6jv007k4c05v5xhz2flzjs08j44z02yjex6qp0hrqd4f5sw794jwrhzhfztqkrzprnt755dd6w0zv0cpq5hjgvasr2j4vnhxawygp7v9z5x"
+	testPayHash = "b168b765e28fa49a88991f36e27ffe4cd7dd330baba25752ddad90ef7cb013e6"
+)
+
+func setup(t *testing.T) (context.Context, db.Conn) {
+	return context.Background(), db.ConnectForTesting(t)
+}
+
+func TestCreate(t *testing.T) {
+	ctx, dbc := setup(t)
+
+	_, err := recipients.Create(ctx, dbc, testPollID, 0, 100, testInvoice)
+	assert.NoError(t, err)
+}
+
+func TestListByPoll(t *testing.T) {
+	ctx, dbc := setup(t)
+
+	_, err := recipients.Create(ctx, dbc, testPollID, 1, 20, testInvoice)
+	assert.NoError(t, err)
+	_, err = recipients.Create(ctx, dbc, testPollID, 0, 80, testInvoice)
+	assert.NoError(t, err)
+	_, err = recipients.Create(ctx, dbc, int64(3454), 0, 100, testInvoice)
+	assert.NoError(t, err)
+
+	rList, err := recipients.ListByPoll(ctx, dbc, testPollID)
+	assert.NoError(t, err)
+	assert.Len(t, rList, 2)
+	assert.Equal(t, int64(0), rList[0].Position)
+	assert.Equal(t, int64(80), rList[0].SharePercent)
+}
+
+func TestStartPayout(t *testing.T) {
+	ctx, dbc := setup(t)
+
+	id, err := recipients.Create(ctx, dbc, testPollID, 0, 100, testInvoice)
+	assert.NoError(t, err)
+
+	err = recipients.StartPayout(ctx, dbc, id, 101, 1, testPayHash)
+	assert.NoError(t, err)
+
+	err = recipients.StartPayout(ctx, dbc, id, 101, 1, testPayHash)
+	assert.Equal(t, db.ErrUnexpectedRowCount, err)
+
+	rList, err := recipients.ListByPoll(ctx, dbc, testPollID)
+	assert.NoError(t, err)
+	assert.Len(t, rList, 1)
+	assert.Equal(t, types.PayoutStatusPayingOut, rList[0].Status)
+	assert.Equal(t, int64(101), rList[0].AmountSats)
+	assert.Equal(t, int64(1), rList[0].RemainderSats)
+	assert.Equal(t, testPayHash, rList[0].PaymentHash)
+}
+
+func TestUpdateStatus(t *testing.T) {
+	ctx, dbc := setup(t)
+
+	id, err := recipients.Create(ctx, dbc, testPollID, 0, 100, testInvoice)
+	assert.NoError(t, err)
+
+	err = recipients.UpdateStatus(ctx, dbc, id, types.PayoutStatusCreated, types.PayoutStatusFailed)
+	assert.NoError(t, err)
+
+	err = recipients.UpdateStatus(ctx, dbc, id, types.PayoutStatusCreated, types.PayoutStatusFailed)
+	assert.Equal(t, db.ErrUnexpectedRowCount, err)
+}
@@ -0,0 +1,119 @@
+package tags
+
+import (
+	"context"
+	"strings"
+
+	"github.com/carlaKC/lightning-poll/db"
+	"github.com/carlaKC/lightning-poll/polls/internal/types"
+	ext_types "github.com/carlaKC/lightning-poll/types"
+)
+
+var cols = "tag, poll_id"
+
+type row interface {
+	Scan(dest ...interface{}) error
+}
+
+// Create tags a poll.
+func Create(ctx context.Context, dbc db.Handle, pollID int64, tag string) error {
+	r, err := dbc.ExecContext(ctx, "insert into poll_tags (tag, poll_id) values (?, ?)",
+		tag, pollID)
+	if err != nil {
+		return err
+	}
+
+	return db.CheckRowsAffected(r, 1)
+}
+
+type DBTag struct {
+	Tag    string
+	PollID int64
+}
+
+func scan(r row) (tag DBTag, err error) {
+	err = r.Scan(&tag.Tag, &tag.PollID)
+	return tag, err
+}
+
+func list(ctx context.Context, dbc db.Handle, query string, args ...interface{}) (tags []*DBTag, err error) {
+	rows, err := dbc.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		tag, err := scan(rows)
+		if err != nil {
+			return tags, err
+		}
+		tags = append(tags, &tag)
+	}
+
+	return tags, rows.Err()
+}
+
+// ListByPolls returns the tags of all of the polls provided in a single query,
+// ordered by tag.
+func ListByPolls(ctx context.Context, dbc db.Handle, pollIDs []int64) ([]*DBTag, error) {
+	if len(pollIDs) == 0 {
+		return nil, nil
+	}
+
+	args := make([]interface{}, len(pollIDs))
+	for i, id := range pollIDs {
+		args[i] = id
+	}
+
+	return list(ctx, dbc, "select "+cols+" from poll_tags where poll_id in ("+
+		strings.TrimSuffix(strings.Repeat("?, ", len(pollIDs)), ", ")+") order by tag",
+		args...)
+}
+
+// DBTotals totals the polls with a tag which have the same status.
+type DBTotals struct {
+	Status    types.PollStatus
+	Polls     int64
+	VoteCount int64
+	TotalSats int64
+}
+
+// Totals returns the number of polls with a tag and visibility for each
+// status, along with the number and sum of their votes which have one of the
+// counted statuses.
+func Totals(ctx context.Context, dbc db.Handle, tag string, visibility ext_types.Visibility,
+	countedVotes []int) ([]*DBTotals, error) {
+
+	if len(countedVotes) == 0 {
+		return nil, nil
+	}
+
+	var args []interface{}
+	for _, s := range countedVotes {
+		args = append(args, s)
+	}
+	args = append(args, tag, visibility)
+
+	rows, err := dbc.QueryContext(ctx, "select polls.status, count(*), "+
+		"coalesce(sum(vote_count), 0), coalesce(sum(total_sats), 0) from polls "+
+		"join poll_tags on poll_tags.poll_id=polls.id left join (select poll_id, "+
+		"count(*) as vote_count, coalesce(sum(settle_amount), 0) as total_sats from votes "+
+		"where status in ("+strings.TrimSuffix(strings.Repeat("?, ", len(countedVotes)), ", ")+
+		") group by poll_id) totals on totals.poll_id=polls.id where poll_tags.tag=? "+
+		"and polls.visibility=? group by polls.status", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var totals []*DBTotals
+	for rows.Next() {
+		var t DBTotals
+		if err := rows.Scan(&t.Status, &t.Polls, &t.VoteCount, &t.TotalSats); err != nil {
+			return nil, err
+		}
+		totals = append(totals, &t)
+	}
+
+	return totals, rows.Err()
+}
@@ -0,0 +1,122 @@
+package tags_test
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/carlaKC/lightning-poll/db"
+	"github.com/carlaKC/lightning-poll/polls/internal/db/tags"
+	"github.com/carlaKC/lightning-poll/polls/internal/types"
+	ext_types "github.com/carlaKC/lightning-poll/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testPollID = int64(54678)
+	testTag    = "bitcoin"
+)
+
+func setup(t *testing.T) (context.Context, db.Conn) {
+	return context.Background(), db.ConnectForTesting(t)
+}
+
+func TestCreate(t *testing.T) {
+	ctx, dbc := setup(t)
+
+	err := tags.Create(ctx, dbc, testPollID, testTag)
+	assert.NoError(t, err)
+
+	// polls cannot have the same tag twice.
+	err = tags.Create(ctx, dbc, testPollID, testTag)
+	assert.Error(t, err)
+}
+
+func TestListByPolls(t *testing.T) {
+	ctx, dbc := setup(t)
+
+	testPollID2 := int64(3454)
+
+	require.NoError(t, tags.Create(ctx, dbc, testPollID, testTag))
+	require.NoError(t, tags.Create(ctx, dbc, testPollID, "apple"))
+	require.NoError(t, tags.Create(ctx, dbc, testPollID2, testTag))
+
+	list, err := tags.ListByPolls(ctx, dbc, []int64{testPollID})
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, "apple", list[0].Tag)
+	assert.Equal(t, testTag, list[1].Tag)
+
+	list, err = tags.ListByPolls(ctx, dbc, []int64{testPollID, testPollID2})
+	require.NoError(t, err)
+	assert.Len(t, list, 3)
+}
+
+// createPoll inserts a poll directly, because polls are stored by the polls
+// package.
+func createPoll(t *testing.T, dbc db.Conn, status types.PollStatus,
+	visibility ext_types.Visibility) int64 {
+
+	id := rand.Int63()
+	_, err := dbc.ExecContext(context.Background(), "insert into polls (id, status, "+
+		"created_at, expires_at, question, expiry_seconds, repay_scheme, vote_sats, "+
+		"payout_invoice, one_vote_per_identity, visibility, slug) values (?, ?, now(), "+
+		"now(), '', 3600, 1, 10, '', false, ?, ?)", id, status, visibility,
+		strconv.FormatInt(id, 16))
+	require.NoError(t, err)
+
+	return id
+}
+
+func createVote(t *testing.T, dbc db.Conn, pollID, amount int64, status int) {
+	_, err := dbc.ExecContext(context.Background(), "insert into votes (id, created_at, "+
+		"expires_at, poll_id, option_id, pay_req, payment_hash, preimage, settle_amount, "+
+		"status) values (?, now(), now(), ?, 1, '', '', '', ?, ?)", rand.Int63(), pollID,
+		amount, status)
+	require.NoError(t, err)
+}
+
+func TestTotals(t *testing.T) {
+	ctx, dbc := setup(t)
+
+	open := createPoll(t, dbc, types.PollStatusCreated, ext_types.VisibilityPublic)
+	closed := createPoll(t, dbc, types.PollStatusClosed, ext_types.VisibilityPublic)
+	unlisted := createPoll(t, dbc, types.PollStatusCreated, ext_types.VisibilityUnlisted)
+	untagged := createPoll(t, dbc, types.PollStatusCreated, ext_types.VisibilityPublic)
+
+	for _, id := range []int64{open, closed, unlisted} {
+		require.NoError(t, tags.Create(ctx, dbc, id, testTag))
+	}
+
+	createVote(t, dbc, open, 100, 3)
+	createVote(t, dbc, open, 100, 3)
+	createVote(t, dbc, closed, 50, 3)
+	// uncounted votes, and votes in polls without the tag, are not totalled.
+	createVote(t, dbc, closed, 1000, 6)
+	createVote(t, dbc, untagged, 1000, 3)
+	createVote(t, dbc, unlisted, 1000, 3)
+
+	totals, err := tags.Totals(ctx, dbc, testTag, ext_types.VisibilityPublic, []int{3})
+	require.NoError(t, err)
+
+	byStatus := make(map[types.PollStatus]tags.DBTotals)
+	for _, t := range totals {
+		byStatus[t.Status] = *t
+	}
+	assert.Equal(t, map[types.PollStatus]tags.DBTotals{
+		types.PollStatusCreated: {
+			Status:    types.PollStatusCreated,
+			Polls:     1,
+			VoteCount: 2,
+			TotalSats: 200,
+		},
+		types.PollStatusClosed: {
+			Status:    types.PollStatusClosed,
+			Polls:     1,
+			VoteCount: 1,
+			TotalSats: 50,
+		},
+	}, byStatus)
+}
@@ -0,0 +1,20 @@
+package terms
+
+import (
+	"context"
+
+	"github.com/carlaKC/lightning-poll/db"
+)
+
+// Create adds a search term to a poll. Polls are searched by the terms of
+// their question and options, which are stored separately so that searches
+// can use the index on term rather than scanning every poll.
+func Create(ctx context.Context, dbc db.Handle, pollID int64, term string) error {
+	r, err := dbc.ExecContext(ctx, "insert into poll_terms (term, poll_id) values (?, ?)",
+		term, pollID)
+	if err != nil {
+		return err
+	}
+
+	return db.CheckRowsAffected(r, 1)
+}
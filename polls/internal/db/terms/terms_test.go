@@ -0,0 +1,33 @@
+package terms_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/carlaKC/lightning-poll/db"
+	"github.com/carlaKC/lightning-poll/polls/internal/db/terms"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testPollID = int64(54678)
+	testTerm   = "bitcoin"
+)
+
+func setup(t *testing.T) (context.Context, db.Conn) {
+	return context.Background(), db.ConnectForTesting(t)
+}
+
+func TestCreate(t *testing.T) {
+	ctx, dbc := setup(t)
+
+	err := terms.Create(ctx, dbc, testPollID, testTerm)
+	assert.NoError(t, err)
+
+	// terms are only stored once for each poll.
+	err = terms.Create(ctx, dbc, testPollID, testTerm)
+	assert.Error(t, err)
+
+	err = terms.Create(ctx, dbc, testPollID+1, testTerm)
+	assert.NoError(t, err)
+}
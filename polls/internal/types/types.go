@@ -27,3 +27,29 @@ var strings = map[PollStatus]string{
 func (s PollStatus) String() string {
 	return strings[s]
 }
+
+type PayoutStatus int
+
+var (
+	PayoutStatusUnknown   PayoutStatus = 0
+	PayoutStatusCreated   PayoutStatus = 1
+	PayoutStatusPayingOut PayoutStatus = 2
+	PayoutStatusPaidOut   PayoutStatus = 3
+	PayoutStatusFailed    PayoutStatus = 4
+	payoutStatusSentinel  PayoutStatus = 5
+)
+
+func (s PayoutStatus) Valid() bool {
+	return s > PayoutStatusUnknown && s < payoutStatusSentinel
+}
+
+var payoutStrings = map[PayoutStatus]string{
+	PayoutStatusCreated:   "CREATED",
+	PayoutStatusPayingOut: "PAYING_OUT",
+	PayoutStatusPaidOut:   "PAID_OUT",
+	PayoutStatusFailed:    "FAILED",
+}
+
+func (s PayoutStatus) String() string {
+	return payoutStrings[s]
+}
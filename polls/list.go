@@ -0,0 +1,146 @@
+package polls
+
+import (
+	"context"
+
+	poll_db "github.com/carlaKC/lightning-poll/polls/internal/db/polls"
+	"github.com/carlaKC/lightning-poll/polls/internal/types"
+	ext_types "github.com/carlaKC/lightning-poll/types"
+	"github.com/carlaKC/lightning-poll/votes"
+	"github.com/pkg/errors"
+)
+
+var ErrInvalidSort = errors.New("Polls can be sorted by closes, sats or votes")
+
+const (
+	defaultPageSize int64 = 20
+	maxPageSize     int64 = 100
+
+	// maxPage is the last page that can be listed, so that the offset of a
+	// page cannot overflow. Later pages are empty.
+	maxPage int64 = 100000
+)
+
+// Sorts for listing polls, as they are named in query strings.
+const (
+	SortClosesAt  = "closes"
+	SortTotalSats = "sats"
+	SortVoteCount = "votes"
+)
+
+var sorts = map[string]poll_db.Sort{
+	"":            poll_db.SortClosesAt,
+	SortClosesAt:  poll_db.SortClosesAt,
+	SortTotalSats: poll_db.SortTotalSats,
+	SortVoteCount: poll_db.SortVoteCount,
+}
+
+// ListQuery selects a page of public polls to list.
+type ListQuery struct {
+	// Closed lists polls which have closed rather than polls which are open.
+	Closed bool
+
+	// Search lists polls whose question or options have words starting with
+	// each of its words, ignoring case and punctuation.
+	Search string
+
+	// Tag lists polls which have it, if it is set.
+	Tag string
+
+	// Sort is one of SortClosesAt, SortTotalSats or SortVoteCount, and
+	// defaults to SortClosesAt.
+	Sort string
+
+	// Page is the page to list, starting at 1, and pages after 100000 are
+	// empty. PageSize defaults to 20 polls, and is at most 100.
+	Page     int64
+	PageSize int64
+}
+
+// PollPage is a page of listed polls.
+type PollPage struct {
+	Polls    []*Poll
+	Page     int64
+	PageSize int64
+	HasNext  bool
+}
+
+// ListPolls returns a page of public polls. The page and its totals are read
+// in at most two queries and the options of its polls in another, however many
+// polls are listed.
+func ListPolls(ctx context.Context, b Backends, q *ListQuery) (*PollPage, error) {
+	sort, ok := sorts[q.Sort]
+	if !ok {
+		return nil, ErrInvalidSort
+	}
+
+	page, pageSize := q.Page, q.PageSize
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = defaultPageSize
+	} else if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+
+	statuses := []types.PollStatus{types.PollStatusCreated}
+	if q.Closed {
+		statuses = []types.PollStatus{
+			types.PollStatusClosed,
+			types.PollStatusReleased,
+			types.PollStatusPayingOut,
+			types.PollStatusPaidOut,
+		}
+	}
+
+	result := &PollPage{
+		Page:     page,
+		PageSize: pageSize,
+	}
+
+	// searches without any words, such as those made up of punctuation,
+	// match no polls.
+	terms := searchTerms(q.Search)
+	if page > maxPage || q.Search != "" && len(terms) == 0 {
+		return result, nil
+	}
+
+	// one more poll than the page holds is read to find out whether there
+	// is a next page.
+	summaries, err := b.GetPolls().ListPage(ctx, b.GetConn(), poll_db.ListFilter{
+		Statuses:     statuses,
+		Visibility:   ext_types.VisibilityPublic,
+		Terms:        terms,
+		Tag:          q.Tag,
+		Sort:         sort,
+		Offset:       (page - 1) * pageSize,
+		Limit:        pageSize + 1,
+		CountedVotes: votes.CountedStatuses(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result.HasNext = int64(len(summaries)) > pageSize
+	if result.HasNext {
+		summaries = summaries[:pageSize]
+	}
+
+	dbPolls := make([]*poll_db.DBPoll, 0, len(summaries))
+	for _, s := range summaries {
+		dbPolls = append(dbPolls, &s.DBPoll)
+	}
+
+	result.Polls, err = getList(ctx, b, dbPolls)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, s := range summaries {
+		result.Polls[i].VoteCount = s.VoteCount
+		result.Polls[i].TotalSats = s.TotalSats
+	}
+
+	return result, nil
+}
@@ -0,0 +1,42 @@
+package polls
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListPollsEmptyPages(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		query *ListQuery
+	}{
+		{
+			name:  "page past the last page",
+			query: &ListQuery{Page: maxPage + 1},
+		},
+		{
+			name:  "page whose offset would overflow",
+			query: &ListQuery{Page: math.MaxInt64},
+		},
+		{
+			name:  "search without words",
+			query: &ListQuery{Search: "?!"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// empty pages are returned without querying the backends.
+			page, err := ListPolls(ctx, nil, test.query)
+			require.NoError(t, err)
+			assert.Empty(t, page.Polls)
+			assert.False(t, page.HasNext)
+		})
+	}
+}
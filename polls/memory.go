@@ -0,0 +1,415 @@
+package polls
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/carlaKC/lightning-poll/db"
+	options_db "github.com/carlaKC/lightning-poll/polls/internal/db/options"
+	poll_db "github.com/carlaKC/lightning-poll/polls/internal/db/polls"
+	tags_db "github.com/carlaKC/lightning-poll/polls/internal/db/tags"
+	"github.com/carlaKC/lightning-poll/polls/internal/types"
+	ext_types "github.com/carlaKC/lightning-poll/types"
+)
+
+var (
+	errDuplicateSlug = errors.New("polls: slug is already in use")
+	errDuplicateTag  = errors.New("polls: poll already has tag")
+	errDuplicateTerm = errors.New("polls: poll already has search term")
+)
+
+// NewMemPollRepository returns a poll repository which stores polls in
+// memory, for use in tests. The handle passed to its methods is ignored, so
+// changes are not rolled back with the transaction they are made in.
+func NewMemPollRepository() PollRepository {
+	return &memPolls{
+		polls: make(map[int64]*poll_db.DBPoll),
+		tags:  make(map[int64][]string),
+		terms: make(map[int64][]string),
+	}
+}
+
+// NewMemOptionRepository returns an option repository which stores options in
+// memory, for use in tests.
+func NewMemOptionRepository() OptionRepository {
+	return &memOptions{}
+}
+
+type memPolls struct {
+	mu    sync.Mutex
+	polls map[int64]*poll_db.DBPoll
+	order []int64
+
+	// tags are the tags of each poll, in the order they were added.
+	tags map[int64][]string
+
+	// terms are the search terms of each poll.
+	terms map[int64][]string
+}
+
+func (m *memPolls) Create(_ context.Context, _ db.Handle, question, payoutInvoice, _, creatorKey string,
+	repayScheme ext_types.RepayScheme, expirySeconds, voteSats, feeSats, feePercent int64,
+	oneVotePerIdentity bool, visibility ext_types.Visibility, slug,
+	accessCodeHash string) (int64, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// slugs are unique, as the database's unique constraint requires.
+	for _, p := range m.polls {
+		if p.Slug == slug {
+			return 0, errDuplicateSlug
+		}
+	}
+
+	id := rand.Int63()
+	now := time.Now()
+
+	m.polls[id] = &poll_db.DBPoll{
+		ID:            id,
+		Status:        types.PollStatusCreated,
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(time.Second * time.Duration(expirySeconds)),
+		Question:      question,
+		ExpirySeconds: expirySeconds,
+		RepayScheme:   repayScheme,
+		VoteSats:      voteSats,
+		FeeSats:       feeSats,
+		FeePercent:    feePercent,
+		PayoutInvoice: payoutInvoice,
+		CreatorKey:    creatorKey,
+
+		OneVotePerIdentity: oneVotePerIdentity,
+		Visibility:         visibility,
+		Slug:               slug,
+		AccessCodeHash:     accessCodeHash,
+	}
+	m.order = append(m.order, id)
+
+	return id, nil
+}
+
+func (m *memPolls) Lookup(_ context.Context, _ db.Handle, id int64) (*poll_db.DBPoll, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	poll, ok := m.polls[id]
+	if !ok {
+		return nil, db.ErrNotFound
+	}
+
+	p := *poll
+	return &p, nil
+}
+
+func (m *memPolls) LookupBySlug(_ context.Context, _ db.Handle, slug string) (*poll_db.DBPoll, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, poll := range m.polls {
+		if poll.Slug == slug {
+			p := *poll
+			return &p, nil
+		}
+	}
+
+	return nil, db.ErrNotFound
+}
+
+func (m *memPolls) LookupForUpdate(ctx context.Context, h db.Handle, id int64) (*poll_db.DBPoll, error) {
+	return m.Lookup(ctx, h, id)
+}
+
+// list returns copies of the polls that match filter, in the order that they
+// were created.
+func (m *memPolls) list(filter func(*poll_db.DBPoll) bool) []*poll_db.DBPoll {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var polls []*poll_db.DBPoll
+	for _, id := range m.order {
+		if !filter(m.polls[id]) {
+			continue
+		}
+
+		p := *m.polls[id]
+		polls = append(polls, &p)
+	}
+
+	return polls
+}
+
+func (m *memPolls) ListByStatus(_ context.Context, _ db.Handle, status types.PollStatus) ([]*poll_db.DBPoll, error) {
+	return m.list(func(p *poll_db.DBPoll) bool {
+		return p.Status == status
+	}), nil
+}
+
+func (m *memPolls) ListByStatusAndVisibility(_ context.Context, _ db.Handle, status types.PollStatus,
+	visibility ext_types.Visibility) ([]*poll_db.DBPoll, error) {
+	return m.list(func(p *poll_db.DBPoll) bool {
+		return p.Status == status && p.Visibility == visibility
+	}), nil
+}
+
+func (m *memPolls) ListExpired(_ context.Context, _ db.Handle) ([]*poll_db.DBPoll, error) {
+	now := time.Now()
+
+	return m.list(func(p *poll_db.DBPoll) bool {
+		return p.Status == types.PollStatusCreated && p.ExpiresAt.Before(now)
+	}), nil
+}
+
+func (m *memPolls) ListByCreator(_ context.Context, _ db.Handle, creatorKey string) ([]*poll_db.DBPoll, error) {
+	return m.list(func(p *poll_db.DBPoll) bool {
+		return p.CreatorKey == creatorKey
+	}), nil
+}
+
+// ListPage matches search terms by their prefix, like the SQL repository.
+// Votes are not stored with polls, so listed polls have no votes and polls are
+// only sorted by close time.
+func (m *memPolls) ListPage(_ context.Context, _ db.Handle, f poll_db.ListFilter) ([]*poll_db.DBPollSummary, error) {
+	statuses := make(map[types.PollStatus]bool)
+	for _, s := range f.Statuses {
+		statuses[s] = true
+	}
+
+	polls := m.list(func(p *poll_db.DBPoll) bool {
+		return statuses[p.Status] && p.Visibility == f.Visibility &&
+			hasTerms(m.terms[p.ID], f.Terms) &&
+			(f.Tag == "" || hasTag(m.tags[p.ID], f.Tag))
+	})
+
+	sort.SliceStable(polls, func(i, j int) bool {
+		if !polls[i].ExpiresAt.Equal(polls[j].ExpiresAt) {
+			return polls[i].ExpiresAt.Before(polls[j].ExpiresAt)
+		}
+		return polls[i].ID < polls[j].ID
+	})
+
+	var page []*poll_db.DBPollSummary
+	for i := f.Offset; i < int64(len(polls)) && i < f.Offset+f.Limit; i++ {
+		page = append(page, &poll_db.DBPollSummary{DBPoll: *polls[i]})
+	}
+
+	return page, nil
+}
+
+func (m *memPolls) CountByStatus(_ context.Context, _ db.Handle) (map[types.PollStatus]int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counts := make(map[types.PollStatus]int64)
+	for _, p := range m.polls {
+		counts[p.Status]++
+	}
+
+	return counts, nil
+}
+
+func (m *memPolls) UpdateStatus(_ context.Context, _ db.Handle, id int64, fromStatus, toStatus types.PollStatus) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	poll, ok := m.polls[id]
+	if !ok || poll.Status != fromStatus {
+		return db.ErrUnexpectedRowCount
+	}
+
+	poll.Status = toStatus
+	return nil
+}
+
+func (m *memPolls) SetAuditRoot(_ context.Context, _ db.Handle, id int64, root, signature string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	poll, ok := m.polls[id]
+	if !ok || poll.AuditRoot != "" {
+		return db.ErrUnexpectedRowCount
+	}
+
+	poll.AuditRoot = root
+	poll.AuditSignature = signature
+	return nil
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *memPolls) CreateTag(_ context.Context, _ db.Handle, pollID int64, tag string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if hasTag(m.tags[pollID], tag) {
+		return errDuplicateTag
+	}
+
+	m.tags[pollID] = append(m.tags[pollID], tag)
+	return nil
+}
+
+// hasTerms returns true if each of the search terms provided is the start of
+// one of a poll's terms.
+func hasTerms(pollTerms, search []string) bool {
+	for _, s := range search {
+		var found bool
+		for _, t := range pollTerms {
+			if strings.HasPrefix(t, s) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (m *memPolls) CreateTerm(_ context.Context, _ db.Handle, pollID int64, term string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if hasTag(m.terms[pollID], term) {
+		return errDuplicateTerm
+	}
+
+	m.terms[pollID] = append(m.terms[pollID], term)
+	return nil
+}
+
+func (m *memPolls) ListTags(_ context.Context, _ db.Handle, pollIDs []int64) ([]*tags_db.DBTag, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var tags []*tags_db.DBTag
+	for _, id := range pollIDs {
+		for _, tag := range m.tags[id] {
+			tags = append(tags, &tags_db.DBTag{Tag: tag, PollID: id})
+		}
+	}
+
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].Tag < tags[j].Tag
+	})
+
+	return tags, nil
+}
+
+// TagTotals counts the polls with a tag. Votes are not stored with polls, so
+// their totals are always zero.
+func (m *memPolls) TagTotals(_ context.Context, _ db.Handle, tag string,
+	visibility ext_types.Visibility, _ []int) ([]*tags_db.DBTotals, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	byStatus := make(map[types.PollStatus]*tags_db.DBTotals)
+	var totals []*tags_db.DBTotals
+	for _, id := range m.order {
+		poll := m.polls[id]
+		if poll.Visibility != visibility || !hasTag(m.tags[id], tag) {
+			continue
+		}
+
+		t, ok := byStatus[poll.Status]
+		if !ok {
+			t = &tags_db.DBTotals{Status: poll.Status}
+			byStatus[poll.Status] = t
+			totals = append(totals, t)
+		}
+		t.Polls++
+	}
+
+	return totals, nil
+}
+
+type memOptions struct {
+	mu      sync.Mutex
+	options []options_db.DBOption
+}
+
+func (m *memOptions) Create(_ context.Context, _ db.Handle, pollID int64, value string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := rand.Int63()
+	m.options = append(m.options, options_db.DBOption{
+		ID:     id,
+		PollID: pollID,
+		Value:  value,
+	})
+
+	return id, nil
+}
+
+func (m *memOptions) ListByPoll(_ context.Context, _ db.Handle, pollID int64) ([]*options_db.DBOption, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var options []*options_db.DBOption
+	for _, o := range m.options {
+		if o.PollID != pollID {
+			continue
+		}
+
+		opt := o
+		options = append(options, &opt)
+	}
+
+	return options, nil
+}
+
+func (m *memOptions) ListByPolls(_ context.Context, _ db.Handle, pollIDs []int64) ([]*options_db.DBOption, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	listed := make(map[int64]bool)
+	for _, id := range pollIDs {
+		listed[id] = true
+	}
+
+	var options []*options_db.DBOption
+	for _, o := range m.options {
+		if !listed[o.PollID] {
+			continue
+		}
+
+		opt := o
+		options = append(options, &opt)
+	}
+
+	return options, nil
+}
+
+func (m *memOptions) LookupInPoll(_ context.Context, _ db.Handle, pollID, id int64) (*options_db.DBOption, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, o := range m.options {
+		if o.ID != id || o.PollID != pollID {
+			continue
+		}
+
+		opt := o
+		return &opt, nil
+	}
+
+	return nil, db.ErrNotFound
+}
@@ -2,10 +2,9 @@ package polls
 
 import (
 	"context"
-	"log"
-	"time"
 
-	poll_db "github.com/carlaKC/lightning-poll/polls/internal/db/polls"
+	"github.com/carlaKC/lightning-poll/health"
+	"github.com/carlaKC/lightning-poll/logging"
 	"github.com/carlaKC/lightning-poll/polls/internal/types"
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -17,37 +16,66 @@ var pollCount = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 	Help:      "Count of polls by status.",
 }, []string{"status"})
 
+var payoutCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "main",
+	Subsystem: "payouts",
+	Name:      "total",
+	Help:      "Count of payouts to poll recipients by result.",
+}, []string{"result"})
+
+var payoutSats = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "main",
+	Subsystem: "payouts",
+	Name:      "sats_total",
+	Help:      "Satoshis sent to poll recipients, and paid in routing fees to send them.",
+}, []string{"type"})
+
+var reconcileRepaired = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "main",
+	Subsystem: "reconcile",
+	Name:      "repaired_total",
+	Help:      "Count of discrepancies between the DB and LND repaired automatically.",
+}, []string{"kind"})
+
+var reconcileUnresolved = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "main",
+	Subsystem: "reconcile",
+	Name:      "unresolved",
+	Help:      "Count of discrepancies between the DB and LND that require investigation.",
+}, []string{"kind"})
+
 func init() {
 	prometheus.MustRegister(pollCount)
+	prometheus.MustRegister(payoutCount)
+	prometheus.MustRegister(payoutSats)
+	prometheus.MustRegister(reconcileRepaired)
+	prometheus.MustRegister(reconcileUnresolved)
 }
 
-func updateMetricsForever(b Backends) {
+func updateMetricsForever(ctx context.Context, b Backends) {
 	for {
-		ctx := context.Background()
-		if err := updatePollMetrics(ctx, b); err != nil {
-			log.Printf("updateMetricsForever: error %v", err)
+		if err := updatePollMetrics(context.Background(), b); err != nil {
+			logging.From(ctx).Error("update poll metrics failed", "error", err)
+		} else {
+			health.Beat(metricsLoop)
 		}
 
-		time.Sleep(time.Minute * 30)
+		if !health.Wait(ctx, metricsInterval) {
+			return
+		}
 	}
 }
 
 func updatePollMetrics(ctx context.Context, b Backends) error {
-	//TODO(carla): Add DB function that returns map status -> poll rather than dodgy loop
-	i := types.PollStatus(1)
-	for {
-		if !i.Valid() {
-			break
-		}
-
-		p, err := poll_db.ListByStatus(ctx, b.GetDB(), types.PollStatusCreated)
-		if err != nil {
-			return err
-		}
-
-		pollCount.WithLabelValues(types.PollStatusCreated.String()).Sub(float64(len(p)))
-		i++
+	counts, err := b.GetPolls().CountByStatus(ctx, b.GetConn())
+	if err != nil {
+		return err
+	}
 
+	// set every status so that statuses with no polls are reported as zero
+	// rather than keeping their last value.
+	for s := types.PollStatus(1); s.Valid(); s++ {
+		pollCount.WithLabelValues(s.String()).Set(float64(counts[s]))
 	}
 
 	return nil
@@ -2,58 +2,118 @@ package polls
 
 import (
 	"context"
-	"database/sql"
-	"fmt"
-	"log"
 
-	lnd_cl "github.com/carlaKC/lightning-poll/lnd"
-	options_db "github.com/carlaKC/lightning-poll/polls/internal/db/options"
+	"github.com/carlaKC/lightning-poll/db"
+	"github.com/carlaKC/lightning-poll/logging"
 	poll_db "github.com/carlaKC/lightning-poll/polls/internal/db/polls"
-	"github.com/carlaKC/lightning-poll/polls/internal/types"
+	recipients_db "github.com/carlaKC/lightning-poll/polls/internal/db/recipients"
 	ext_types "github.com/carlaKC/lightning-poll/types"
+	"github.com/carlaKC/lightning-poll/votes"
 	"github.com/pkg/errors"
 )
 
 var expiryBufferSeconds int64 = 60 * 60 * 12 // 12 hours in seconds
 
+// Backends provides the dependencies of the polls package. It includes the
+// backends of the votes package, because polls manage their votes.
 type Backends interface {
-	GetDB() *sql.DB
-	GetLND() lnd_cl.Client
+	votes.Backends
+	GetPolls() PollRepository
+	GetOptions() OptionRepository
 }
 
 var (
-	ErrNonZeroInvoice = errors.New("Payout invoice is non-zero")
-	ErrPayoutExpiry   = errors.New("Payout invoice expires too soon")
+	ErrNonZeroInvoice  = errors.New("Payout invoice is non-zero")
+	ErrPayoutExpiry    = errors.New("Payout invoice expires too soon")
+	ErrInvalidShares   = errors.New("Payout shares must be positive and leave a share for the poll creator")
+	ErrDuplicatePayout = errors.New("Each recipient needs a different payout invoice")
 )
 
-func CreatePoll(ctx context.Context, b Backends, question, payReq, email string,
-	repayScheme int64, options []string, expirySeconds, voteSats int64) (int64, error) {
-	if err := ValidatePayout(ctx, b, payReq, expirySeconds); err != nil {
+// CreatePoll creates a poll which pays out to the request's payout invoice
+// when it closes. Any additional recipients are paid their percentage share
+// of the payout, with the poll creator receiving whatever share remains. If
+// the request is invalid a *ValidationError is returned.
+func CreatePoll(ctx context.Context, b Backends, req *PollRequest) (int64, error) {
+	req.Normalize()
+	if err := ValidatePoll(ctx, b, req); err != nil {
 		return 0, err
 	}
 
-	scheme := ext_types.RepayScheme(repayScheme)
-	if !scheme.Valid() {
-		return 0, fmt.Errorf("Repay scheme: %v invalid", scheme)
+	creatorShare := int64(100)
+	for _, r := range req.Recipients {
+		creatorShare -= r.Share
 	}
-	id, err := poll_db.Create(ctx, b.GetDB(), question, payReq, email, scheme, expirySeconds, voteSats)
+
+	slug, err := newSlug()
 	if err != nil {
 		return 0, err
 	}
 
-	log.Printf("polls/ops: Created poll: %v", id)
+	visibility := ext_types.Visibility(req.Visibility)
 
-	for _, o := range options {
-		if o == "" {
-			continue
-		}
-		optID, err := options_db.Create(ctx, b.GetDB(), id, o)
+	// the operator's current fee is stored with the poll, so that the fee
+	// disclosed to its creator and voters cannot change before it closes.
+	fee := GetOperatorFee()
+
+	var codeHash string
+	if visibility == ext_types.VisibilityPrivate {
+		codeHash, err = accessCodeHash(req.AccessCode)
 		if err != nil {
 			return 0, err
 		}
-		log.Printf("polls/ops: Created option: %v for poll: %v", optID, id)
 	}
 
+	// the poll, its recipients, options, tags and search terms are created in a
+	// transaction so that a failure cannot leave a partially created poll.
+	var id int64
+	err = db.WithTx(ctx, b.GetConn(), func(tx db.Handle) error {
+		var err error
+		id, err = b.GetPolls().Create(ctx, tx, req.Question, req.PayReq, req.Email,
+			req.CreatorKey, ext_types.RepayScheme(req.RepayScheme), req.ExpirySeconds,
+			req.VoteSats, fee.FlatSats, fee.Percent, req.OneVotePerIdentity, visibility,
+			slug, codeHash)
+		if err != nil {
+			return err
+		}
+
+		if _, err := recipients_db.Create(ctx, tx, id, 0, creatorShare, req.PayReq); err != nil {
+			return err
+		}
+
+		for i, r := range req.Recipients {
+			if _, err := recipients_db.Create(ctx, tx, id, int64(i+1), r.Share, r.Invoice); err != nil {
+				return err
+			}
+		}
+
+		for _, o := range req.Options {
+			if _, err := b.GetOptions().Create(ctx, tx, id, o); err != nil {
+				return err
+			}
+		}
+
+		for _, t := range req.Tags {
+			if err := b.GetPolls().CreateTag(ctx, tx, id, t); err != nil {
+				return err
+			}
+		}
+
+		for _, t := range searchTerms(append([]string{req.Question}, req.Options...)...) {
+			if err := b.GetPolls().CreateTerm(ctx, tx, id, t); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	ctx = logging.With(ctx, logging.FieldPollID, id)
+	logging.From(ctx).Info("created poll", "options", len(req.Options),
+		"recipients", len(req.Recipients)+1, "visibility", visibility.GetDetails().Name)
+
 	return id, nil
 }
 
@@ -61,37 +121,97 @@ func CreatePoll(ctx context.Context, b Backends, question, payReq, email string,
 // has a 0 amount, so we can specify any payment amount and that it has a sufficient
 // expiry buffer so that it does not expire before we can pay them out.
 func ValidatePayout(ctx context.Context, b Backends, payReq string, expirySeconds int64) error {
+	_, err := decodePayout(ctx, b, payReq, expirySeconds)
+	return err
+}
+
+// decodePayout validates a payout invoice as ValidatePayout does, returning
+// its payment hash.
+func decodePayout(ctx context.Context, b Backends, payReq string, expirySeconds int64) (string, error) {
 	req, err := b.GetLND().DecodePaymentRequest(ctx, payReq)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	if req.Expiry < (expirySeconds + expiryBufferSeconds) {
-		return ErrPayoutExpiry
+		return "", ErrPayoutExpiry
 	}
 
 	if req.NumSatoshis != 0 {
-		return ErrNonZeroInvoice
+		return "", ErrNonZeroInvoice
+	}
+
+	return req.PaymentHash, nil
+}
+
+// validateRecipients checks that each additional recipient has a valid payout
+// invoice and that their shares leave a portion of the payout for the poll
+// creator. It returns the creator's share. Every payout invoice, including
+// the creator's payReq if it is set, must have a different payment hash,
+// because an invoice can only be paid once and payouts are tracked by hash.
+func validateRecipients(ctx context.Context, b Backends, payReq string,
+	recipients []Recipient, expirySeconds int64) (int64, error) {
+
+	hashes := make(map[string]bool)
+	if payReq != "" {
+		req, err := b.GetLND().DecodePaymentRequest(ctx, payReq)
+		if err != nil {
+			return 0, err
+		}
+		hashes[req.PaymentHash] = true
+	}
+
+	var total int64
+	for _, r := range recipients {
+		// shares are checked individually so that their total cannot
+		// overflow.
+		if r.Share <= 0 || r.Share >= 100 {
+			return 0, ErrInvalidShares
+		}
+		total += r.Share
+
+		hash, err := decodePayout(ctx, b, r.Invoice, expirySeconds)
+		if err != nil {
+			return 0, err
+		}
+
+		if hashes[hash] {
+			return 0, ErrDuplicatePayout
+		}
+		hashes[hash] = true
+	}
+
+	if total >= 100 {
+		return 0, ErrInvalidShares
 	}
 
-	return nil
+	return 100 - total, nil
 }
 
 func LookupPoll(ctx context.Context, b Backends, id int64) (*Poll, error) {
-	dbPoll, err := poll_db.Lookup(ctx, b.GetDB(), id)
+	dbPoll, err := b.GetPolls().Lookup(ctx, b.GetConn(), id)
 	if err != nil {
 		return nil, err
 	}
 
 	poll := &Poll{
-		ID:       dbPoll.ID,
-		Question: dbPoll.Question,
-		Cost:     dbPoll.VoteSats,
-		ClosesAt: dbPoll.ExpiresAt,
-		Strategy: dbPoll.RepayScheme.GetDetails(),
+		ID:        dbPoll.ID,
+		Question:  dbPoll.Question,
+		Cost:      dbPoll.VoteSats,
+		ClosesAt:  dbPoll.ExpiresAt,
+		Strategy:  dbPoll.RepayScheme.GetDetails(),
+		Fee:       pollFee(dbPoll),
+		AuditRoot: dbPoll.AuditRoot,
+
+		AuditMessage:   AuditMessage(dbPoll.ID, dbPoll.AuditRoot),
+		AuditSignature: dbPoll.AuditSignature,
+
+		OneVotePerIdentity: dbPoll.OneVotePerIdentity,
+		Visibility:         dbPoll.Visibility,
+		Slug:               dbPoll.Slug,
 	}
 
-	options, err := options_db.ListByPoll(ctx, b.GetDB(), dbPoll.ID)
+	options, err := b.GetOptions().ListByPoll(ctx, b.GetConn(), dbPoll.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -100,11 +220,33 @@ func LookupPoll(ctx context.Context, b Backends, id int64) (*Poll, error) {
 		poll.Options = append(poll.Options, &Option{ID: o.ID, Value: o.Value})
 	}
 
+	tags, err := b.GetPolls().ListTags(ctx, b.GetConn(), []int64{dbPoll.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, t := range tags {
+		poll.Tags = append(poll.Tags, t.Tag)
+	}
+
+	recipients, err := recipients_db.ListByPoll(ctx, b.GetConn(), dbPoll.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range recipients {
+		poll.Recipients = append(poll.Recipients, &Recipient{
+			Invoice: r.PayoutInvoice,
+			Share:   r.SharePercent,
+		})
+	}
+
 	return poll, nil
 }
 
-func ListActivePolls(ctx context.Context, b Backends) ([]*Poll, error) {
-	polls, err := poll_db.ListByStatus(ctx, b.GetDB(), types.PollStatusCreated)
+// ListCreatedPolls returns the polls created by a logged in user.
+func ListCreatedPolls(ctx context.Context, b Backends, creatorKey string) ([]*Poll, error) {
+	polls, err := b.GetPolls().ListByCreator(ctx, b.GetConn(), creatorKey)
 	if err != nil {
 		return nil, err
 	}
@@ -112,27 +254,53 @@ func ListActivePolls(ctx context.Context, b Backends) ([]*Poll, error) {
 	return getList(ctx, b, polls)
 }
 
-func ListInactivePolls(ctx context.Context, b Backends) ([]*Poll, error) {
-	closed, err := poll_db.ListByStatus(ctx, b.GetDB(), types.PollStatusClosed)
+// getList returns listed polls with their options and tags, which are each
+// loaded in a single query. Recipients are not loaded for listed polls.
+func getList(ctx context.Context, b Backends, polls []*poll_db.DBPoll) ([]*Poll, error) {
+	pollList := make([]*Poll, 0, len(polls))
+	pollIDs := make([]int64, 0, len(polls))
+	byID := make(map[int64]*Poll)
+	for _, dbPoll := range polls {
+		poll := &Poll{
+			ID:        dbPoll.ID,
+			Question:  dbPoll.Question,
+			Cost:      dbPoll.VoteSats,
+			ClosesAt:  dbPoll.ExpiresAt,
+			Strategy:  dbPoll.RepayScheme.GetDetails(),
+			Fee:       pollFee(dbPoll),
+			AuditRoot: dbPoll.AuditRoot,
+
+			AuditMessage:   AuditMessage(dbPoll.ID, dbPoll.AuditRoot),
+			AuditSignature: dbPoll.AuditSignature,
+
+			OneVotePerIdentity: dbPoll.OneVotePerIdentity,
+			Visibility:         dbPoll.Visibility,
+			Slug:               dbPoll.Slug,
+		}
+
+		pollList = append(pollList, poll)
+		pollIDs = append(pollIDs, poll.ID)
+		byID[poll.ID] = poll
+	}
+
+	options, err := b.GetOptions().ListByPolls(ctx, b.GetConn(), pollIDs)
 	if err != nil {
 		return nil, err
 	}
-	paidOut, err := poll_db.ListByStatus(ctx, b.GetDB(), types.PollStatusPaidOut)
+
+	for _, o := range options {
+		poll := byID[o.PollID]
+		poll.Options = append(poll.Options, &Option{ID: o.ID, Value: o.Value})
+	}
+
+	tags, err := b.GetPolls().ListTags(ctx, b.GetConn(), pollIDs)
 	if err != nil {
 		return nil, err
 	}
 
-	return getList(ctx, b, append(paidOut, closed...))
-}
-
-func getList(ctx context.Context, b Backends, polls []*poll_db.DBPoll) ([]*Poll, error) {
-	var pollList []*Poll
-	for _, poll := range polls {
-		p, err := LookupPoll(ctx, b, poll.ID)
-		if err != nil {
-			return nil, err
-		}
-		pollList = append(pollList, p)
+	for _, t := range tags {
+		poll := byID[t.PollID]
+		poll.Tags = append(poll.Tags, t.Tag)
 	}
 
 	return pollList, nil
@@ -0,0 +1,273 @@
+package polls
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/carlaKC/lightning-poll/db"
+	"github.com/carlaKC/lightning-poll/ledger"
+	lnd_cl "github.com/carlaKC/lightning-poll/lnd"
+	"github.com/carlaKC/lightning-poll/logging"
+	poll_db "github.com/carlaKC/lightning-poll/polls/internal/db/polls"
+	recipients_db "github.com/carlaKC/lightning-poll/polls/internal/db/recipients"
+	"github.com/carlaKC/lightning-poll/polls/internal/types"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/pkg/errors"
+)
+
+var ErrPollNotPayingOut = errors.New("Poll is not paying out")
+
+// splitPayout divides amount between recipients according to their percentage
+// shares. Each share is rounded down and whatever is left over is allocated to
+// the first recipient, which is always the poll creator.
+func splitPayout(amount int64, shares []int64) ([]int64, int64) {
+	amounts := make([]int64, len(shares))
+
+	var total int64
+	for i, share := range shares {
+		amounts[i] = amount * share / 100
+		total += amounts[i]
+	}
+
+	remainder := amount - total
+	if len(amounts) > 0 {
+		amounts[0] += remainder
+	}
+
+	return amounts, remainder
+}
+
+// payRecipients pays each of a poll's recipients their share of amount. All
+// recipients are attempted, and an error is returned if any of them could not
+// be paid.
+func payRecipients(ctx context.Context, b Backends, poll *poll_db.DBPoll, amount int64) error {
+	recipients, err := recipients_db.ListByPoll(ctx, b.GetConn(), poll.ID)
+	if err != nil {
+		return err
+	}
+
+	// polls created before payouts could be split have a single recipient,
+	// the payout invoice provided by the creator.
+	if len(recipients) == 0 {
+		if _, err := recipients_db.Create(ctx, b.GetConn(), poll.ID, 0, 100,
+			poll.PayoutInvoice); err != nil {
+			return err
+		}
+
+		recipients, err = recipients_db.ListByPoll(ctx, b.GetConn(), poll.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	shares := make([]int64, len(recipients))
+	for i, r := range recipients {
+		shares[i] = r.SharePercent
+	}
+	amounts, remainder := splitPayout(amount, shares)
+
+	var failed int
+	for i, r := range recipients {
+		// the remainder is always allocated to the first recipient.
+		var recipientRemainder int64
+		if i == 0 {
+			recipientRemainder = remainder
+		}
+
+		if err := payRecipient(ctx, b, r, amounts[i], recipientRemainder); err != nil {
+			logging.From(ctx).Error("recipient payout failed", "recipient_id", r.ID,
+				"error", err)
+			failed++
+		}
+	}
+
+	if failed != 0 {
+		return fmt.Errorf("polls/payout: poll %v could not pay %v of %v recipients",
+			poll.ID, failed, len(recipients))
+	}
+
+	return nil
+}
+
+// payRecipient sends a single recipient their share of a poll's payout. The
+// recipient is moved to paying out before the payment is sent so that a
+// failure part way through cannot result in them being paid twice.
+func payRecipient(ctx context.Context, b Backends, r *recipients_db.DBRecipient,
+	amount, remainder int64) error {
+
+	switch r.Status {
+	case types.PayoutStatusPaidOut:
+		return nil
+	case types.PayoutStatusCreated:
+	default:
+		return fmt.Errorf("recipient in status: %v", r.Status)
+	}
+
+	req, err := b.GetLND().DecodePaymentRequest(ctx, r.PayoutInvoice)
+	if err != nil {
+		return err
+	}
+
+	if err := recipients_db.StartPayout(ctx, b.GetConn(), r.ID, amount, remainder,
+		req.PaymentHash); err != nil {
+		return err
+	}
+
+	// there is nothing to send to recipients whose share rounds down to zero.
+	if amount == 0 {
+		return recipients_db.UpdateStatus(ctx, b.GetConn(), r.ID, types.PayoutStatusPayingOut,
+			types.PayoutStatusPaidOut)
+	}
+
+	return sendPayout(ctx, b, r, amount)
+}
+
+// sendPayout pays a recipient who has been moved to paying out, and marks them
+// failed if the payment fails.
+func sendPayout(ctx context.Context, b Backends, r *recipients_db.DBRecipient,
+	amount int64) error {
+
+	resp, err := b.GetLND().SendPaymentSync(ctx, r.PayoutInvoice, amount)
+	if err == nil && resp.PaymentError != "" {
+		err = fmt.Errorf("payment error: %v", resp.PaymentError)
+	}
+	if err != nil {
+		payoutCount.WithLabelValues("failure").Inc()
+		if updateErr := recipients_db.UpdateStatus(ctx, b.GetConn(), r.ID,
+			types.PayoutStatusPayingOut, types.PayoutStatusFailed); updateErr != nil {
+			logging.From(ctx).Error("could not mark recipient failed",
+				"recipient_id", r.ID, "error", updateErr)
+		}
+		return err
+	}
+	payoutCount.WithLabelValues("success").Inc()
+	payoutSats.WithLabelValues("payout").Add(float64(amount))
+
+	var routingFee int64
+	if resp.PaymentRoute != nil {
+		routingFee = resp.PaymentRoute.TotalFees
+		payoutSats.WithLabelValues("routing_fee").Add(float64(routingFee))
+	}
+
+	return markPaidOut(ctx, b, r, amount, routingFee)
+}
+
+// markPaidOut updates a recipient to paid out and records their payout in
+// the ledger, in a single transaction.
+func markPaidOut(ctx context.Context, b Backends, r *recipients_db.DBRecipient,
+	amount, routingFee int64) error {
+
+	return db.WithTx(ctx, b.GetConn(), func(tx db.Handle) error {
+		if err := recipients_db.UpdateStatus(ctx, tx, r.ID, types.PayoutStatusPayingOut,
+			types.PayoutStatusPaidOut); err != nil {
+			return err
+		}
+
+		if err := ledger.RecordPayout(ctx, tx, r.PollID, amount); err != nil {
+			return err
+		}
+
+		return ledger.RecordRoutingFee(ctx, tx, r.PollID, routingFee)
+	})
+}
+
+// RetryPayout retries the payouts to a poll's recipients which failed, so that
+// the poll is not left paying out. Each recipient is paid the amount that was
+// allocated to them when the poll closed, to the same invoice, so a recipient
+// whose earlier payment did succeed is marked paid rather than paid again. The
+// poll is marked paid out once all of its recipients have been paid.
+func RetryPayout(ctx context.Context, b Backends, pollID int64) error {
+	poll, err := b.GetPolls().Lookup(ctx, b.GetConn(), pollID)
+	if err == db.ErrNotFound {
+		return ErrPollNotFound
+	} else if err != nil {
+		return err
+	}
+
+	if poll.Status != types.PollStatusPayingOut {
+		return ErrPollNotPayingOut
+	}
+
+	ctx = logging.With(ctx, logging.FieldPollID, poll.ID)
+
+	recipients, err := recipients_db.ListByPoll(ctx, b.GetConn(), poll.ID)
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	for _, r := range recipients {
+		if r.Status != types.PayoutStatusFailed {
+			continue
+		}
+
+		if err := retryRecipient(ctx, b, r); err != nil {
+			logging.From(ctx).Error("recipient payout retry failed", "recipient_id", r.ID,
+				"error", err)
+			failed++
+		}
+	}
+
+	if failed != 0 {
+		return fmt.Errorf("polls/payout: poll %v could not pay %v of %v recipients",
+			poll.ID, failed, len(recipients))
+	}
+
+	// recipients whose payments are still in flight are left paying out, and
+	// are resolved by reconciliation.
+	recipients, err = recipients_db.ListByPoll(ctx, b.GetConn(), poll.ID)
+	if err != nil {
+		return err
+	}
+
+	var paid int
+	for _, r := range recipients {
+		if r.Status == types.PayoutStatusPaidOut {
+			paid++
+		}
+	}
+
+	if paid != len(recipients) {
+		logging.From(ctx).Info("poll payout still in flight", "paid", paid,
+			"recipients", len(recipients))
+		return nil
+	}
+
+	if err := b.GetPolls().UpdateStatus(ctx, b.GetConn(), poll.ID, types.PollStatusPayingOut,
+		types.PollStatusPaidOut); err != nil {
+		return err
+	}
+
+	if err := ledger.CheckPollClosed(ctx, b.GetConn(), poll.ID); err != nil {
+		logging.From(ctx).Error("closed poll ledger check failed", "error", err)
+	}
+
+	logging.From(ctx).Info("poll paid out after retry")
+	return nil
+}
+
+// retryRecipient pays a recipient whose payout failed. Their payment is looked
+// up first, so that a payment which succeeded or is still in flight is not
+// sent again.
+func retryRecipient(ctx context.Context, b Backends, r *recipients_db.DBRecipient) error {
+	payment, err := b.GetLND().LookupPayment(ctx, r.PaymentHash)
+	if err != nil && err != lnd_cl.ErrPaymentNotFound {
+		return err
+	}
+
+	if err := recipients_db.UpdateStatus(ctx, b.GetConn(), r.ID, types.PayoutStatusFailed,
+		types.PayoutStatusPayingOut); err != nil {
+		return err
+	}
+
+	switch {
+	case payment != nil && payment.Status == lnrpc.Payment_SUCCEEDED:
+		return markPaidOut(ctx, b, r, r.AmountSats, payment.FeeSat)
+
+	case payment != nil && payment.Status == lnrpc.Payment_IN_FLIGHT:
+		return nil
+
+	default:
+		return sendPayout(ctx, b, r, r.AmountSats)
+	}
+}
@@ -0,0 +1,29 @@
+package polls
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitPayout(t *testing.T) {
+	// single recipient receives the full amount
+	amounts, remainder := splitPayout(1000, []int64{100})
+	assert.Equal(t, []int64{1000}, amounts)
+	assert.Equal(t, int64(0), remainder)
+
+	// amount divides evenly between recipients
+	amounts, remainder = splitPayout(1000, []int64{80, 20})
+	assert.Equal(t, []int64{800, 200}, amounts)
+	assert.Equal(t, int64(0), remainder)
+
+	// rounding remainder is allocated to the first recipient
+	amounts, remainder = splitPayout(10, []int64{33, 33, 34})
+	assert.Equal(t, []int64{4, 3, 3}, amounts)
+	assert.Equal(t, int64(1), remainder)
+
+	// small shares may round down to nothing
+	amounts, remainder = splitPayout(3, []int64{99, 1})
+	assert.Equal(t, []int64{3, 0}, amounts)
+	assert.Equal(t, int64(1), remainder)
+}
@@ -0,0 +1,170 @@
+package polls
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	lnd_cl "github.com/carlaKC/lightning-poll/lnd"
+	poll_db "github.com/carlaKC/lightning-poll/polls/internal/db/polls"
+	recipients_db "github.com/carlaKC/lightning-poll/polls/internal/db/recipients"
+	"github.com/carlaKC/lightning-poll/polls/internal/types"
+	ext_types "github.com/carlaKC/lightning-poll/types"
+	"github.com/carlaKC/lightning-poll/votes"
+	"github.com/lightningnetwork/lnd/lnrpc"
+)
+
+// stuckCloseGrace is how long after a poll expires it may take to close
+// before it is reported as stuck.
+var stuckCloseGrace = time.Hour
+
+// Reconcile compares all votes and polls that have not reached a terminal
+// state with the state of their invoices and payments in LND. If repair is
+// true, discrepancies that are safe to fix are repaired.
+func Reconcile(ctx context.Context, b Backends, repair bool) ([]*ext_types.Discrepancy, error) {
+	discrepancies, err := votes.Reconcile(ctx, b, repair)
+	if err != nil {
+		return nil, err
+	}
+
+	// polls which were interrupted while releasing votes cannot be repaired
+	// automatically, because we do not know which votes were released.
+	for _, status := range []types.PollStatus{types.PollStatusClosed, types.PollStatusReleased} {
+		polls, err := b.GetPolls().ListByStatus(ctx, b.GetConn(), status)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, poll := range polls {
+			if time.Since(poll.ExpiresAt) < stuckCloseGrace {
+				continue
+			}
+
+			discrepancies = append(discrepancies, &ext_types.Discrepancy{
+				Kind:        "poll",
+				ID:          poll.ID,
+				Description: fmt.Sprintf("poll stuck in status: %v", status),
+			})
+		}
+	}
+
+	payingOut, err := b.GetPolls().ListByStatus(ctx, b.GetConn(), types.PollStatusPayingOut)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, poll := range payingOut {
+		d, err := reconcilePayout(ctx, b, poll, repair)
+		if err != nil {
+			return nil, err
+		}
+		discrepancies = append(discrepancies, d...)
+	}
+
+	return discrepancies, nil
+}
+
+// reconcilePayout compares the payout status of each of a poll's recipients
+// with the state of their payment in LND.
+func reconcilePayout(ctx context.Context, b Backends, poll *poll_db.DBPoll,
+	repair bool) ([]*ext_types.Discrepancy, error) {
+
+	recipients, err := recipients_db.ListByPoll(ctx, b.GetConn(), poll.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(recipients) == 0 {
+		return []*ext_types.Discrepancy{{
+			Kind:        "poll",
+			ID:          poll.ID,
+			Description: "poll paying out has no payout recipients",
+		}}, nil
+	}
+
+	var discrepancies []*ext_types.Discrepancy
+	paid := 0
+	for _, r := range recipients {
+		d := &ext_types.Discrepancy{Kind: "poll", ID: poll.ID}
+
+		switch r.Status {
+		case types.PayoutStatusPaidOut:
+			paid++
+			continue
+
+		case types.PayoutStatusFailed:
+			d.Description = fmt.Sprintf("payout to recipient %v failed", r.ID)
+			discrepancies = append(discrepancies, d)
+			continue
+
+		case types.PayoutStatusPayingOut:
+
+		default:
+			continue
+		}
+
+		payment, err := b.GetLND().LookupPayment(ctx, r.PaymentHash)
+		if err == lnd_cl.ErrPaymentNotFound {
+			d.Description = fmt.Sprintf("payout to recipient %v not found", r.ID)
+			discrepancies = append(discrepancies, d)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		var fix func() error
+		switch payment.Status {
+		case lnrpc.Payment_SUCCEEDED:
+			d.Description = fmt.Sprintf("payout to recipient %v succeeded but not "+
+				"marked paid out", r.ID)
+			fix = func() error {
+				return markPaidOut(ctx, b, r, r.AmountSats, payment.FeeSat)
+			}
+
+		case lnrpc.Payment_FAILED:
+			d.Description = fmt.Sprintf("payout to recipient %v failed but not "+
+				"marked failed", r.ID)
+			fix = func() error {
+				return recipients_db.UpdateStatus(ctx, b.GetConn(), r.ID,
+					types.PayoutStatusPayingOut, types.PayoutStatusFailed)
+			}
+
+		default:
+			// the payment is still in flight.
+			continue
+		}
+
+		d.Safe = true
+		if repair {
+			if err := fix(); err != nil {
+				return nil, err
+			}
+			d.Repaired = true
+
+			if payment.Status == lnrpc.Payment_SUCCEEDED {
+				paid++
+			}
+		}
+		discrepancies = append(discrepancies, d)
+	}
+
+	if paid != len(recipients) {
+		return discrepancies, nil
+	}
+
+	d := &ext_types.Discrepancy{
+		Kind:        "poll",
+		ID:          poll.ID,
+		Description: "all recipients paid but poll not marked paid out",
+		Safe:        true,
+	}
+	if repair {
+		if err := b.GetPolls().UpdateStatus(ctx, b.GetConn(), poll.ID, types.PollStatusPayingOut,
+			types.PollStatusPaidOut); err != nil {
+			return nil, err
+		}
+		d.Repaired = true
+	}
+
+	return append(discrepancies, d), nil
+}
@@ -0,0 +1,147 @@
+package polls
+
+import (
+	"context"
+
+	"github.com/carlaKC/lightning-poll/db"
+	options_db "github.com/carlaKC/lightning-poll/polls/internal/db/options"
+	poll_db "github.com/carlaKC/lightning-poll/polls/internal/db/polls"
+	tags_db "github.com/carlaKC/lightning-poll/polls/internal/db/tags"
+	terms_db "github.com/carlaKC/lightning-poll/polls/internal/db/terms"
+	"github.com/carlaKC/lightning-poll/polls/internal/types"
+	ext_types "github.com/carlaKC/lightning-poll/types"
+)
+
+// PollRepository stores polls. Each method runs its queries on the handle
+// provided, so that they can be part of a transaction.
+type PollRepository interface {
+	Create(ctx context.Context, h db.Handle, question, payoutInvoice, email, creatorKey string,
+		repayScheme ext_types.RepayScheme, expirySeconds, voteSats, feeSats, feePercent int64,
+		oneVotePerIdentity bool, visibility ext_types.Visibility, slug,
+		accessCodeHash string) (int64, error)
+	Lookup(ctx context.Context, h db.Handle, id int64) (*poll_db.DBPoll, error)
+	LookupBySlug(ctx context.Context, h db.Handle, slug string) (*poll_db.DBPoll, error)
+	LookupForUpdate(ctx context.Context, h db.Handle, id int64) (*poll_db.DBPoll, error)
+	ListByStatus(ctx context.Context, h db.Handle, status types.PollStatus) ([]*poll_db.DBPoll, error)
+	ListByStatusAndVisibility(ctx context.Context, h db.Handle, status types.PollStatus,
+		visibility ext_types.Visibility) ([]*poll_db.DBPoll, error)
+	ListExpired(ctx context.Context, h db.Handle) ([]*poll_db.DBPoll, error)
+	ListByCreator(ctx context.Context, h db.Handle, creatorKey string) ([]*poll_db.DBPoll, error)
+	ListPage(ctx context.Context, h db.Handle, filter poll_db.ListFilter) ([]*poll_db.DBPollSummary, error)
+	CountByStatus(ctx context.Context, h db.Handle) (map[types.PollStatus]int64, error)
+	UpdateStatus(ctx context.Context, h db.Handle, id int64, fromStatus, toStatus types.PollStatus) error
+	SetAuditRoot(ctx context.Context, h db.Handle, id int64, root, signature string) error
+	CreateTag(ctx context.Context, h db.Handle, pollID int64, tag string) error
+	CreateTerm(ctx context.Context, h db.Handle, pollID int64, term string) error
+	ListTags(ctx context.Context, h db.Handle, pollIDs []int64) ([]*tags_db.DBTag, error)
+	TagTotals(ctx context.Context, h db.Handle, tag string, visibility ext_types.Visibility,
+		countedVotes []int) ([]*tags_db.DBTotals, error)
+}
+
+// OptionRepository stores the options that can be voted for in polls.
+type OptionRepository interface {
+	Create(ctx context.Context, h db.Handle, pollID int64, value string) (int64, error)
+	ListByPoll(ctx context.Context, h db.Handle, pollID int64) ([]*options_db.DBOption, error)
+	ListByPolls(ctx context.Context, h db.Handle, pollIDs []int64) ([]*options_db.DBOption, error)
+	LookupInPoll(ctx context.Context, h db.Handle, pollID, id int64) (*options_db.DBOption, error)
+}
+
+// NewSQLPollRepository returns a poll repository backed by a SQL database.
+func NewSQLPollRepository() PollRepository {
+	return sqlPolls{}
+}
+
+// NewSQLOptionRepository returns an option repository backed by a SQL database.
+func NewSQLOptionRepository() OptionRepository {
+	return sqlOptions{}
+}
+
+type sqlPolls struct{}
+
+func (sqlPolls) Create(ctx context.Context, h db.Handle, question, payoutInvoice, email, creatorKey string,
+	repayScheme ext_types.RepayScheme, expirySeconds, voteSats, feeSats, feePercent int64,
+	oneVotePerIdentity bool, visibility ext_types.Visibility, slug,
+	accessCodeHash string) (int64, error) {
+	return poll_db.Create(ctx, h, question, payoutInvoice, email, creatorKey, repayScheme,
+		expirySeconds, voteSats, feeSats, feePercent, oneVotePerIdentity, visibility, slug, accessCodeHash)
+}
+
+func (sqlPolls) Lookup(ctx context.Context, h db.Handle, id int64) (*poll_db.DBPoll, error) {
+	return poll_db.Lookup(ctx, h, id)
+}
+
+func (sqlPolls) LookupBySlug(ctx context.Context, h db.Handle, slug string) (*poll_db.DBPoll, error) {
+	return poll_db.LookupBySlug(ctx, h, slug)
+}
+
+func (sqlPolls) LookupForUpdate(ctx context.Context, h db.Handle, id int64) (*poll_db.DBPoll, error) {
+	return poll_db.LookupForUpdate(ctx, h, id)
+}
+
+func (sqlPolls) ListByStatus(ctx context.Context, h db.Handle, status types.PollStatus) ([]*poll_db.DBPoll, error) {
+	return poll_db.ListByStatus(ctx, h, status)
+}
+
+func (sqlPolls) ListByStatusAndVisibility(ctx context.Context, h db.Handle, status types.PollStatus,
+	visibility ext_types.Visibility) ([]*poll_db.DBPoll, error) {
+	return poll_db.ListByStatusAndVisibility(ctx, h, status, visibility)
+}
+
+func (sqlPolls) ListExpired(ctx context.Context, h db.Handle) ([]*poll_db.DBPoll, error) {
+	return poll_db.ListExpired(ctx, h)
+}
+
+func (sqlPolls) ListByCreator(ctx context.Context, h db.Handle, creatorKey string) ([]*poll_db.DBPoll, error) {
+	return poll_db.ListByCreator(ctx, h, creatorKey)
+}
+
+func (sqlPolls) ListPage(ctx context.Context, h db.Handle, filter poll_db.ListFilter) ([]*poll_db.DBPollSummary, error) {
+	return poll_db.ListPage(ctx, h, filter)
+}
+
+func (sqlPolls) CountByStatus(ctx context.Context, h db.Handle) (map[types.PollStatus]int64, error) {
+	return poll_db.CountByStatus(ctx, h)
+}
+
+func (sqlPolls) UpdateStatus(ctx context.Context, h db.Handle, id int64, fromStatus, toStatus types.PollStatus) error {
+	return poll_db.UpdateStatus(ctx, h, id, fromStatus, toStatus)
+}
+
+func (sqlPolls) SetAuditRoot(ctx context.Context, h db.Handle, id int64, root, signature string) error {
+	return poll_db.SetAuditRoot(ctx, h, id, root, signature)
+}
+
+func (sqlPolls) CreateTag(ctx context.Context, h db.Handle, pollID int64, tag string) error {
+	return tags_db.Create(ctx, h, pollID, tag)
+}
+
+func (sqlPolls) CreateTerm(ctx context.Context, h db.Handle, pollID int64, term string) error {
+	return terms_db.Create(ctx, h, pollID, term)
+}
+
+func (sqlPolls) ListTags(ctx context.Context, h db.Handle, pollIDs []int64) ([]*tags_db.DBTag, error) {
+	return tags_db.ListByPolls(ctx, h, pollIDs)
+}
+
+func (sqlPolls) TagTotals(ctx context.Context, h db.Handle, tag string, visibility ext_types.Visibility,
+	countedVotes []int) ([]*tags_db.DBTotals, error) {
+	return tags_db.Totals(ctx, h, tag, visibility, countedVotes)
+}
+
+type sqlOptions struct{}
+
+func (sqlOptions) Create(ctx context.Context, h db.Handle, pollID int64, value string) (int64, error) {
+	return options_db.Create(ctx, h, pollID, value)
+}
+
+func (sqlOptions) ListByPoll(ctx context.Context, h db.Handle, pollID int64) ([]*options_db.DBOption, error) {
+	return options_db.ListByPoll(ctx, h, pollID)
+}
+
+func (sqlOptions) ListByPolls(ctx context.Context, h db.Handle, pollIDs []int64) ([]*options_db.DBOption, error) {
+	return options_db.ListByPolls(ctx, h, pollIDs)
+}
+
+func (sqlOptions) LookupInPoll(ctx context.Context, h db.Handle, pollID, id int64) (*options_db.DBOption, error) {
+	return options_db.LookupInPoll(ctx, h, pollID, id)
+}
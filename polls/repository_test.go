@@ -0,0 +1,405 @@
+package polls_test
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/carlaKC/lightning-poll/db"
+	"github.com/carlaKC/lightning-poll/polls"
+	poll_db "github.com/carlaKC/lightning-poll/polls/internal/db/polls"
+	"github.com/carlaKC/lightning-poll/polls/internal/types"
+	ext_types "github.com/carlaKC/lightning-poll/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// repos returns a handle and empty repositories to run a test against.
+type repos func(t *testing.T) (db.Handle, polls.PollRepository, polls.OptionRepository)
+
+func sqlRepos(t *testing.T) (db.Handle, polls.PollRepository, polls.OptionRepository) {
+	dbc := db.ConnectForTesting(t)
+	if dbc == nil {
+		t.FailNow()
+	}
+
+	return dbc, polls.NewSQLPollRepository(), polls.NewSQLOptionRepository()
+}
+
+func memRepos(t *testing.T) (db.Handle, polls.PollRepository, polls.OptionRepository) {
+	return nil, polls.NewMemPollRepository(), polls.NewMemOptionRepository()
+}
+
+func TestSQLRepositories(t *testing.T) {
+	testRepositories(t, sqlRepos)
+}
+
+func TestMemRepositories(t *testing.T) {
+	testRepositories(t, memRepos)
+}
+
+// testRepositories is a conformance suite which checks that every repository
+// implementation behaves the same way.
+func testRepositories(t *testing.T, setup repos) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, h db.Handle, p polls.PollRepository, o polls.OptionRepository)
+	}{
+		{name: "create and lookup", test: testCreateLookup},
+		{name: "update status", test: testUpdateStatus},
+		{name: "list by status", test: testListByStatus},
+		{name: "list expired", test: testListExpired},
+		{name: "list by creator", test: testListByCreator},
+		{name: "audit root", test: testAuditRoot},
+		{name: "visibility", test: testVisibility},
+		{name: "options", test: testOptions},
+		{name: "list page", test: testListPage},
+		{name: "tags", test: testTags},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h, p, o := setup(t)
+			test.test(t, h, p, o)
+		})
+	}
+}
+
+func createPoll(t *testing.T, h db.Handle, p polls.PollRepository, expirySeconds int64) int64 {
+	id, err := p.Create(context.Background(), h, "question", "lnbc1", "test@example.com", "",
+		ext_types.RepaySchemeMajority, expirySeconds, 10, 0, 0, false, ext_types.VisibilityPublic,
+		newSlug(), "")
+	require.NoError(t, err)
+	return id
+}
+
+// newSlug returns a unique slug for a test poll.
+func newSlug() string {
+	return fmt.Sprintf("%x", rand.Int63())
+}
+
+func testCreateLookup(t *testing.T, h db.Handle, p polls.PollRepository, _ polls.OptionRepository) {
+	ctx := context.Background()
+	id := createPoll(t, h, p, 3600)
+
+	for _, lookup := range []func(context.Context, db.Handle, int64) (*poll_db.DBPoll, error){
+		p.Lookup, p.LookupForUpdate,
+	} {
+		poll, err := lookup(ctx, h, id)
+		require.NoError(t, err)
+
+		assert.Equal(t, id, poll.ID)
+		assert.Equal(t, types.PollStatusCreated, poll.Status)
+		assert.Equal(t, "question", poll.Question)
+		assert.Equal(t, "lnbc1", poll.PayoutInvoice)
+		assert.Equal(t, ext_types.RepaySchemeMajority, poll.RepayScheme)
+		assert.Equal(t, int64(3600), poll.ExpirySeconds)
+		assert.Equal(t, int64(10), poll.VoteSats)
+		assert.False(t, poll.OneVotePerIdentity)
+		assert.WithinDuration(t, time.Now().Add(time.Hour), poll.ExpiresAt, time.Minute)
+
+		_, err = lookup(ctx, h, id+1)
+		assert.Equal(t, db.ErrNotFound, err)
+	}
+}
+
+func testUpdateStatus(t *testing.T, h db.Handle, p polls.PollRepository, _ polls.OptionRepository) {
+	ctx := context.Background()
+	id := createPoll(t, h, p, 3600)
+
+	err := p.UpdateStatus(ctx, h, id, types.PollStatusCreated, types.PollStatusClosed)
+	require.NoError(t, err)
+
+	poll, err := p.Lookup(ctx, h, id)
+	require.NoError(t, err)
+	assert.Equal(t, types.PollStatusClosed, poll.Status)
+
+	// updates from a status that the poll is not in are rejected.
+	err = p.UpdateStatus(ctx, h, id, types.PollStatusCreated, types.PollStatusClosed)
+	assert.Equal(t, db.ErrUnexpectedRowCount, err)
+
+	err = p.UpdateStatus(ctx, h, id+1, types.PollStatusCreated, types.PollStatusClosed)
+	assert.Equal(t, db.ErrUnexpectedRowCount, err)
+}
+
+func testListByStatus(t *testing.T, h db.Handle, p polls.PollRepository, _ polls.OptionRepository) {
+	ctx := context.Background()
+	id1 := createPoll(t, h, p, 3600)
+	id2 := createPoll(t, h, p, 3600)
+	id3 := createPoll(t, h, p, 3600)
+
+	err := p.UpdateStatus(ctx, h, id3, types.PollStatusCreated, types.PollStatusClosed)
+	require.NoError(t, err)
+
+	created, err := p.ListByStatus(ctx, h, types.PollStatusCreated)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []int64{id1, id2}, pollIDs(created))
+
+	closed, err := p.ListByStatus(ctx, h, types.PollStatusClosed)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []int64{id3}, pollIDs(closed))
+
+	counts, err := p.CountByStatus(ctx, h)
+	require.NoError(t, err)
+	assert.Equal(t, map[types.PollStatus]int64{
+		types.PollStatusCreated: 2,
+		types.PollStatusClosed:  1,
+	}, counts)
+}
+
+func testListExpired(t *testing.T, h db.Handle, p polls.PollRepository, _ polls.OptionRepository) {
+	ctx := context.Background()
+	expired := createPoll(t, h, p, -60)
+	createPoll(t, h, p, 3600)
+
+	// closed polls are not listed, even if they have expired.
+	closed := createPoll(t, h, p, -60)
+	err := p.UpdateStatus(ctx, h, closed, types.PollStatusCreated, types.PollStatusClosed)
+	require.NoError(t, err)
+
+	list, err := p.ListExpired(ctx, h)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []int64{expired}, pollIDs(list))
+}
+
+func testListByCreator(t *testing.T, h db.Handle, p polls.PollRepository, _ polls.OptionRepository) {
+	ctx := context.Background()
+	createPoll(t, h, p, 3600)
+
+	id, err := p.Create(ctx, h, "question", "lnbc1", "", "creator",
+		ext_types.RepaySchemeMajority, 3600, 10, 5, 2, true, ext_types.VisibilityPublic, newSlug(), "")
+	require.NoError(t, err)
+
+	poll, err := p.Lookup(ctx, h, id)
+	require.NoError(t, err)
+	assert.Equal(t, "creator", poll.CreatorKey)
+	assert.True(t, poll.OneVotePerIdentity)
+	assert.Equal(t, int64(5), poll.FeeSats)
+	assert.Equal(t, int64(2), poll.FeePercent)
+
+	list, err := p.ListByCreator(ctx, h, "creator")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []int64{id}, pollIDs(list))
+
+	list, err = p.ListByCreator(ctx, h, "other")
+	require.NoError(t, err)
+	assert.Empty(t, list)
+}
+
+func testAuditRoot(t *testing.T, h db.Handle, p polls.PollRepository, _ polls.OptionRepository) {
+	ctx := context.Background()
+	id := createPoll(t, h, p, 3600)
+
+	poll, err := p.Lookup(ctx, h, id)
+	require.NoError(t, err)
+	assert.Empty(t, poll.AuditRoot)
+
+	err = p.SetAuditRoot(ctx, h, id, "root", "signature")
+	require.NoError(t, err)
+
+	poll, err = p.Lookup(ctx, h, id)
+	require.NoError(t, err)
+	assert.Equal(t, "root", poll.AuditRoot)
+	assert.Equal(t, "signature", poll.AuditSignature)
+
+	// roots cannot be changed once they are set.
+	err = p.SetAuditRoot(ctx, h, id, "other", "other")
+	assert.Equal(t, db.ErrUnexpectedRowCount, err)
+
+	err = p.SetAuditRoot(ctx, h, id+1, "root", "signature")
+	assert.Equal(t, db.ErrUnexpectedRowCount, err)
+}
+
+func testOptions(t *testing.T, h db.Handle, p polls.PollRepository, o polls.OptionRepository) {
+	ctx := context.Background()
+	pollID := createPoll(t, h, p, 3600)
+	otherPollID := createPoll(t, h, p, 3600)
+
+	id1, err := o.Create(ctx, h, pollID, "yes")
+	require.NoError(t, err)
+	id2, err := o.Create(ctx, h, pollID, "no")
+	require.NoError(t, err)
+	otherID, err := o.Create(ctx, h, otherPollID, "maybe")
+	require.NoError(t, err)
+
+	options, err := o.ListByPoll(ctx, h, pollID)
+	require.NoError(t, err)
+	require.Len(t, options, 2)
+
+	values := make(map[int64]string)
+	for _, opt := range options {
+		assert.Equal(t, pollID, opt.PollID)
+		values[opt.ID] = opt.Value
+	}
+	assert.Equal(t, map[int64]string{id1: "yes", id2: "no"}, values)
+
+	opt, err := o.LookupInPoll(ctx, h, pollID, id1)
+	require.NoError(t, err)
+	assert.Equal(t, "yes", opt.Value)
+
+	// options cannot be looked up through another poll.
+	_, err = o.LookupInPoll(ctx, h, pollID, otherID)
+	assert.Equal(t, db.ErrNotFound, err)
+
+	options, err = o.ListByPolls(ctx, h, []int64{pollID, otherPollID})
+	require.NoError(t, err)
+	assert.Len(t, options, 3)
+
+	options, err = o.ListByPolls(ctx, h, nil)
+	require.NoError(t, err)
+	assert.Empty(t, options)
+}
+
+func testListPage(t *testing.T, h db.Handle, p polls.PollRepository, _ polls.OptionRepository) {
+	ctx := context.Background()
+	late := createPoll(t, h, p, 7200)
+	early := createPoll(t, h, p, 3600)
+
+	search, err := p.Create(ctx, h, "Which Sandwich?", "lnbc1", "", "",
+		ext_types.RepaySchemeMajority, 10800, 10, 0, 0, false, ext_types.VisibilityPublic, newSlug(), "")
+	require.NoError(t, err)
+	require.NoError(t, p.CreateTerm(ctx, h, search, "which"))
+	require.NoError(t, p.CreateTerm(ctx, h, search, "sandwich"))
+
+	// terms are only stored once for each poll.
+	assert.Error(t, p.CreateTerm(ctx, h, search, "sandwich"))
+
+	// unlisted polls are not listed alongside public ones.
+	_, err = p.Create(ctx, h, "question", "lnbc1", "", "", ext_types.RepaySchemeMajority,
+		3600, 10, 0, 0, false, ext_types.VisibilityUnlisted, newSlug(), "")
+	require.NoError(t, err)
+
+	filter := poll_db.ListFilter{
+		Statuses:     []types.PollStatus{types.PollStatusCreated},
+		Visibility:   ext_types.VisibilityPublic,
+		Sort:         poll_db.SortClosesAt,
+		Limit:        2,
+		CountedVotes: []int{1},
+	}
+
+	page, err := p.ListPage(ctx, h, filter)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{early, late}, summaryIDs(page))
+
+	filter.Offset = 2
+	page, err = p.ListPage(ctx, h, filter)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{search}, summaryIDs(page))
+
+	// polls match terms which start with each search term.
+	filter.Offset = 0
+	filter.Terms = []string{"sand", "which"}
+	page, err = p.ListPage(ctx, h, filter)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{search}, summaryIDs(page))
+
+	filter.Terms = []string{"sandwich", "ham"}
+	page, err = p.ListPage(ctx, h, filter)
+	require.NoError(t, err)
+	assert.Empty(t, page)
+
+	filter.Terms = nil
+	filter.Statuses = []types.PollStatus{types.PollStatusClosed}
+	page, err = p.ListPage(ctx, h, filter)
+	require.NoError(t, err)
+	assert.Empty(t, page)
+}
+
+func testVisibility(t *testing.T, h db.Handle, p polls.PollRepository, _ polls.OptionRepository) {
+	ctx := context.Background()
+	public := createPoll(t, h, p, 3600)
+
+	slug := newSlug()
+	private, err := p.Create(ctx, h, "question", "lnbc1", "", "", ext_types.RepaySchemeMajority,
+		3600, 10, 0, 0, false, ext_types.VisibilityPrivate, slug, "hash")
+	require.NoError(t, err)
+
+	poll, err := p.LookupBySlug(ctx, h, slug)
+	require.NoError(t, err)
+	assert.Equal(t, private, poll.ID)
+	assert.Equal(t, ext_types.VisibilityPrivate, poll.Visibility)
+	assert.Equal(t, "hash", poll.AccessCodeHash)
+
+	_, err = p.LookupBySlug(ctx, h, newSlug())
+	assert.Equal(t, db.ErrNotFound, err)
+
+	// slugs are unique.
+	_, err = p.Create(ctx, h, "question", "lnbc1", "", "", ext_types.RepaySchemeMajority,
+		3600, 10, 0, 0, false, ext_types.VisibilityPublic, slug, "")
+	assert.Error(t, err)
+
+	list, err := p.ListByStatusAndVisibility(ctx, h, types.PollStatusCreated,
+		ext_types.VisibilityPublic)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []int64{public}, pollIDs(list))
+
+	list, err = p.ListByStatusAndVisibility(ctx, h, types.PollStatusCreated,
+		ext_types.VisibilityPrivate)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []int64{private}, pollIDs(list))
+}
+
+func testTags(t *testing.T, h db.Handle, p polls.PollRepository, _ polls.OptionRepository) {
+	ctx := context.Background()
+	tagged := createPoll(t, h, p, 3600)
+	closed := createPoll(t, h, p, 3600)
+	untagged := createPoll(t, h, p, 3600)
+
+	require.NoError(t, p.CreateTag(ctx, h, tagged, "dev"))
+	require.NoError(t, p.CreateTag(ctx, h, tagged, "bitcoin"))
+	require.NoError(t, p.CreateTag(ctx, h, closed, "bitcoin"))
+
+	// polls cannot have the same tag twice.
+	assert.Error(t, p.CreateTag(ctx, h, tagged, "dev"))
+
+	tags, err := p.ListTags(ctx, h, []int64{tagged, untagged})
+	require.NoError(t, err)
+	require.Len(t, tags, 2)
+	assert.Equal(t, "bitcoin", tags[0].Tag)
+	assert.Equal(t, "dev", tags[1].Tag)
+	assert.Equal(t, tagged, tags[0].PollID)
+
+	require.NoError(t, p.UpdateStatus(ctx, h, closed, types.PollStatusCreated,
+		types.PollStatusClosed))
+
+	page, err := p.ListPage(ctx, h, poll_db.ListFilter{
+		Statuses:     []types.PollStatus{types.PollStatusCreated},
+		Visibility:   ext_types.VisibilityPublic,
+		Tag:          "bitcoin",
+		Sort:         poll_db.SortClosesAt,
+		Limit:        10,
+		CountedVotes: []int{1},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{tagged}, summaryIDs(page))
+
+	totals, err := p.TagTotals(ctx, h, "bitcoin", ext_types.VisibilityPublic, []int{1})
+	require.NoError(t, err)
+
+	polls := make(map[types.PollStatus]int64)
+	for _, t := range totals {
+		polls[t.Status] = t.Polls
+	}
+	assert.Equal(t, map[types.PollStatus]int64{
+		types.PollStatusCreated: 1,
+		types.PollStatusClosed:  1,
+	}, polls)
+}
+
+func summaryIDs(list []*poll_db.DBPollSummary) []int64 {
+	var ids []int64
+	for _, p := range list {
+		ids = append(ids, p.ID)
+	}
+	return ids
+}
+
+func pollIDs(list []*poll_db.DBPoll) []int64 {
+	var ids []int64
+	for _, p := range list {
+		ids = append(ids, p.ID)
+	}
+	return ids
+}
@@ -0,0 +1,38 @@
+package polls
+
+import (
+	"strings"
+	"unicode"
+)
+
+// maxTermLength is the longest search term stored, in characters. Longer words
+// are truncated, and still match searches for their first characters.
+const maxTermLength = 64
+
+// searchTerms splits text into the lowercase words that it can be searched
+// by, in the order that they first appear. Words are runs of letters and
+// numbers, so punctuation is ignored.
+func searchTerms(text ...string) []string {
+	var (
+		terms []string
+		seen  = make(map[string]bool)
+	)
+	for _, t := range text {
+		words := strings.FieldsFunc(strings.ToLower(t), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		})
+
+		for _, w := range words {
+			if r := []rune(w); len(r) > maxTermLength {
+				w = string(r[:maxTermLength])
+			}
+
+			if !seen[w] {
+				seen[w] = true
+				terms = append(terms, w)
+			}
+		}
+	}
+
+	return terms
+}
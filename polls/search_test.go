@@ -0,0 +1,21 @@
+package polls
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchTerms(t *testing.T) {
+	assert.Empty(t, searchTerms(""))
+	assert.Empty(t, searchTerms("%_ ?!"))
+
+	assert.Equal(t, []string{"which", "sandwich", "ham", "cheese"},
+		searchTerms("Which Sandwich?", "Ham", "cheese & ham"))
+
+	assert.Equal(t, []string{"café", "2024"}, searchTerms("Café: 2024"))
+
+	long := strings.Repeat("é", maxTermLength+1)
+	assert.Equal(t, []string{strings.Repeat("é", maxTermLength)}, searchTerms(long))
+}
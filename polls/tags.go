@@ -0,0 +1,52 @@
+package polls
+
+import (
+	"context"
+
+	"github.com/carlaKC/lightning-poll/polls/internal/types"
+	ext_types "github.com/carlaKC/lightning-poll/types"
+	"github.com/carlaKC/lightning-poll/votes"
+	"github.com/pkg/errors"
+)
+
+var ErrInvalidTag = errors.New("Tags are lowercase letters, numbers and hyphens")
+
+// TagStats totals the public polls with a tag.
+type TagStats struct {
+	Tag         string
+	OpenPolls   int64
+	ClosedPolls int64
+
+	// VoteCount and TotalSats total the counted votes of every poll with
+	// the tag, whether it is open or closed.
+	VoteCount int64
+	TotalSats int64
+}
+
+// GetTagStats returns the totals of the public polls with a tag, which are
+// summed in a single query.
+func GetTagStats(ctx context.Context, b Backends, tag string) (*TagStats, error) {
+	if !ValidTag(tag) {
+		return nil, ErrInvalidTag
+	}
+
+	totals, err := b.GetPolls().TagTotals(ctx, b.GetConn(), tag,
+		ext_types.VisibilityPublic, votes.CountedStatuses())
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &TagStats{Tag: tag}
+	for _, t := range totals {
+		if t.Status == types.PollStatusCreated {
+			stats.OpenPolls += t.Polls
+		} else {
+			stats.ClosedPolls += t.Polls
+		}
+
+		stats.VoteCount += t.VoteCount
+		stats.TotalSats += t.TotalSats
+	}
+
+	return stats, nil
+}
@@ -7,15 +7,49 @@ import (
 )
 
 type Poll struct {
-	ID       int64
-	Question string
-	Options  []*Option
-	Cost     int64
-	ClosesAt time.Time
-	Strategy types.RepayDetails
+	ID         int64
+	Question   string
+	Options    []*Option
+	Cost       int64
+	ClosesAt   time.Time
+	Strategy   types.RepayDetails
+	Recipients []*Recipient
+
+	// Fee is the operator's fee when the poll was created, which is
+	// deducted when it is paid out.
+	Fee Fee
+
+	// AuditRoot is the Merkle root of the poll's votes, set once it closes.
+	// AuditMessage commits to the root, and is signed by AuditSignature.
+	AuditRoot      string
+	AuditMessage   string
+	AuditSignature string
+
+	// OneVotePerIdentity is true if voters must log in to vote, and can only
+	// have one vote.
+	OneVotePerIdentity bool
+
+	Visibility types.Visibility
+
+	// Slug identifies the poll in URLs, so that its ID is not exposed.
+	Slug string
+
+	// Tags categorise the poll, in alphabetical order.
+	Tags []string
+
+	// VoteCount and TotalSats total the poll's counted votes. They are only
+	// set for polls listed by ListPolls.
+	VoteCount int64
+	TotalSats int64
 }
 
 type Option struct {
 	ID    int64
 	Value string
 }
+
+// Recipient is a destination for a percentage share of a poll's payout.
+type Recipient struct {
+	Invoice string
+	Share   int64
+}
@@ -0,0 +1,283 @@
+package polls
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	ext_types "github.com/carlaKC/lightning-poll/types"
+	"github.com/carlaKC/lightning-poll/votes"
+)
+
+const (
+	maxQuestionLength = 280
+	maxOptionLength   = 100
+	minOptions        = 2
+	maxOptions        = 10
+	maxEmailLength    = 255
+
+	minAccessCodeLength = 6
+	maxAccessCodeLength = 64
+
+	maxTags      = 5
+	maxTagLength = 32
+
+	minExpirySeconds int64 = 60 * 60 // 1 hour in seconds
+)
+
+var maxVoteSats = flag.Int64("max_vote_sats", 1000000, "Maximum number of satoshis "+
+	"that a poll may charge per vote")
+
+// Fields of a poll request, named after the create poll form inputs so that
+// errors can be displayed next to the input they relate to.
+const (
+	FieldQuestion    = "question"
+	FieldOptions     = "option"
+	FieldSats        = "satoshis"
+	FieldExpiry      = "expiry"
+	FieldEmail       = "email"
+	FieldRepayScheme = "payout"
+	FieldInvoice     = "invoice"
+	FieldRecipients  = "recipient"
+	FieldVisibility  = "visibility"
+	FieldAccessCode  = "access_code"
+	FieldTags        = "tags"
+)
+
+// PollRequest contains the values provided to create a poll.
+type PollRequest struct {
+	Question      string
+	PayReq        string
+	Email         string
+	RepayScheme   int64
+	Options       []string
+	ExpirySeconds int64
+	VoteSats      int64
+	Recipients    []Recipient
+
+	// CreatorKey is the linking key of the logged in user creating the poll,
+	// which is empty if they are not logged in.
+	CreatorKey string
+
+	// OneVotePerIdentity requires voters to log in, and limits them to one
+	// vote which they can change until the poll closes.
+	OneVotePerIdentity bool
+
+	// Visibility determines who can find the poll. Private polls can only
+	// be viewed with their access code.
+	Visibility int64
+	AccessCode string
+
+	// Tags categorise the poll, so that it can be listed with other polls
+	// that have the same tag.
+	Tags []string
+}
+
+// FieldError describes a single invalid field of a request.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (f *FieldError) Error() string {
+	return fmt.Sprintf("%v: %v", f.Field, f.Message)
+}
+
+// ValidationError is returned when a request has invalid fields, and contains
+// an error for each of them.
+type ValidationError struct {
+	Fields []*FieldError
+}
+
+// Add adds an error for a field.
+func (v *ValidationError) Add(field, message string) {
+	v.Fields = append(v.Fields, &FieldError{Field: field, Message: message})
+}
+
+// Empty returns true if no field errors have been added.
+func (v *ValidationError) Empty() bool {
+	return len(v.Fields) == 0
+}
+
+func (v *ValidationError) Error() string {
+	msgs := make([]string, len(v.Fields))
+	for i, f := range v.Fields {
+		msgs[i] = f.Error()
+	}
+
+	return "invalid request: " + strings.Join(msgs, ", ")
+}
+
+// Normalize trims whitespace from the text fields of a request, and removes
+// empty options so that unused option inputs are ignored. Tags are lowercased
+// and duplicate tags are removed.
+func (r *PollRequest) Normalize() {
+	r.Question = strings.TrimSpace(r.Question)
+	r.PayReq = strings.TrimSpace(r.PayReq)
+	r.Email = strings.TrimSpace(r.Email)
+	r.AccessCode = strings.TrimSpace(r.AccessCode)
+
+	var options []string
+	for _, o := range r.Options {
+		o = strings.TrimSpace(o)
+		if o == "" {
+			continue
+		}
+		options = append(options, o)
+	}
+	r.Options = options
+
+	for i := range r.Recipients {
+		r.Recipients[i].Invoice = strings.TrimSpace(r.Recipients[i].Invoice)
+	}
+
+	var tags []string
+	seen := make(map[string]bool)
+	for _, t := range r.Tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		tags = append(tags, t)
+	}
+	r.Tags = tags
+}
+
+// ValidatePoll checks every field of a normalized poll request, including
+// decoding its payout invoices. If any fields are invalid it returns a
+// *ValidationError describing all of them.
+func ValidatePoll(ctx context.Context, b Backends, req *PollRequest) error {
+	verr := validateFields(req)
+
+	if req.PayReq != "" {
+		if err := ValidatePayout(ctx, b, req.PayReq, req.ExpirySeconds); err != nil {
+			verr.Add(FieldInvoice, err.Error())
+		}
+	}
+
+	if _, err := validateRecipients(ctx, b, req.PayReq, req.Recipients, req.ExpirySeconds); err != nil {
+		verr.Add(FieldRecipients, err.Error())
+	}
+
+	if verr.Empty() {
+		return nil
+	}
+
+	return verr
+}
+
+// validateFields checks the fields of a poll request which can be validated
+// without querying LND.
+func validateFields(req *PollRequest) *ValidationError {
+	verr := new(ValidationError)
+
+	switch {
+	case req.Question == "":
+		verr.Add(FieldQuestion, "A question is required")
+	case len(req.Question) > maxQuestionLength:
+		verr.Add(FieldQuestion, fmt.Sprintf("Question must be at most %v characters",
+			maxQuestionLength))
+	}
+
+	validateOptions(req.Options, verr)
+
+	switch {
+	case req.VoteSats < 1:
+		verr.Add(FieldSats, "Votes must cost at least 1 satoshi")
+	case req.VoteSats > *maxVoteSats:
+		verr.Add(FieldSats, fmt.Sprintf("Votes may cost at most %v satoshis", *maxVoteSats))
+	}
+
+	if req.ExpirySeconds < minExpirySeconds {
+		verr.Add(FieldExpiry, fmt.Sprintf("Polls must be open for at least %v",
+			time.Duration(minExpirySeconds)*time.Second))
+	} else if err := votes.CheckHorizon(time.Duration(req.ExpirySeconds) * time.Second); err != nil {
+		verr.Add(FieldExpiry, err.Error())
+	}
+
+	if req.Email != "" {
+		addr, err := mail.ParseAddress(req.Email)
+		if err != nil || addr.Address != req.Email || len(req.Email) > maxEmailLength {
+			verr.Add(FieldEmail, "Email address is invalid")
+		}
+	}
+
+	if !ext_types.RepayScheme(req.RepayScheme).Valid() {
+		verr.Add(FieldRepayScheme, "A voter refund strategy is required")
+	}
+
+	if req.PayReq == "" {
+		verr.Add(FieldInvoice, "A payout invoice is required")
+	}
+
+	visibility := ext_types.Visibility(req.Visibility)
+	if !visibility.Valid() {
+		verr.Add(FieldVisibility, "A visibility is required")
+	} else if visibility == ext_types.VisibilityPrivate && (len(req.AccessCode) < minAccessCodeLength ||
+		len(req.AccessCode) > maxAccessCodeLength) {
+		verr.Add(FieldAccessCode, fmt.Sprintf("Private polls need an access code of %v to %v "+
+			"characters", minAccessCodeLength, maxAccessCodeLength))
+	}
+
+	validateTags(req.Tags, verr)
+
+	return verr
+}
+
+func validateOptions(options []string, verr *ValidationError) {
+	if len(options) < minOptions || len(options) > maxOptions {
+		verr.Add(FieldOptions, fmt.Sprintf("Polls must have between %v and %v options",
+			minOptions, maxOptions))
+	}
+
+	seen := make(map[string]bool)
+	for _, o := range options {
+		if len(o) > maxOptionLength {
+			verr.Add(FieldOptions, fmt.Sprintf("Options must be at most %v characters",
+				maxOptionLength))
+			return
+		}
+
+		key := strings.ToLower(o)
+		if seen[key] {
+			verr.Add(FieldOptions, fmt.Sprintf("Option %q is duplicated", o))
+			return
+		}
+		seen[key] = true
+	}
+}
+
+func validateTags(tags []string, verr *ValidationError) {
+	if len(tags) > maxTags {
+		verr.Add(FieldTags, fmt.Sprintf("Polls may have at most %v tags", maxTags))
+		return
+	}
+
+	for _, t := range tags {
+		if !ValidTag(t) {
+			verr.Add(FieldTags, fmt.Sprintf("Tags must be at most %v lowercase letters, "+
+				"numbers or hyphens", maxTagLength))
+			return
+		}
+	}
+}
+
+// ValidTag returns true if a tag is made up of at most 32 lowercase letters,
+// numbers and hyphens.
+func ValidTag(tag string) bool {
+	if tag == "" || len(tag) > maxTagLength {
+		return false
+	}
+
+	for _, c := range tag {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return false
+		}
+	}
+
+	return true
+}
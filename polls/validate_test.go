@@ -0,0 +1,237 @@
+package polls
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/carlaKC/lightning-poll/lnd"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+)
+
+func validRequest() *PollRequest {
+	return &PollRequest{
+		Question:      "Which?",
+		PayReq:        "lnbc1",
+		RepayScheme:   1,
+		Options:       []string{"a", "b"},
+		ExpirySeconds: 60 * 60 * 24,
+		VoteSats:      10,
+		Visibility:    1,
+	}
+}
+
+func fieldsOf(verr *ValidationError) []string {
+	var fields []string
+	for _, f := range verr.Fields {
+		fields = append(fields, f.Field)
+	}
+	return fields
+}
+
+func TestValidateFields(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(r *PollRequest)
+		fields []string
+	}{
+		{
+			name:   "valid",
+			modify: func(r *PollRequest) {},
+		},
+		{
+			name:   "empty question",
+			modify: func(r *PollRequest) { r.Question = "" },
+			fields: []string{FieldQuestion},
+		},
+		{
+			name:   "long question",
+			modify: func(r *PollRequest) { r.Question = strings.Repeat("a", maxQuestionLength+1) },
+			fields: []string{FieldQuestion},
+		},
+		{
+			name:   "single option",
+			modify: func(r *PollRequest) { r.Options = []string{"a"} },
+			fields: []string{FieldOptions},
+		},
+		{
+			name:   "duplicate options",
+			modify: func(r *PollRequest) { r.Options = []string{"a", "A"} },
+			fields: []string{FieldOptions},
+		},
+		{
+			name:   "zero sats",
+			modify: func(r *PollRequest) { r.VoteSats = 0 },
+			fields: []string{FieldSats},
+		},
+		{
+			name:   "too many sats",
+			modify: func(r *PollRequest) { r.VoteSats = *maxVoteSats + 1 },
+			fields: []string{FieldSats},
+		},
+		{
+			name:   "zero expiry",
+			modify: func(r *PollRequest) { r.ExpirySeconds = 0 },
+			fields: []string{FieldExpiry},
+		},
+		{
+			name:   "expiry beyond horizon",
+			modify: func(r *PollRequest) { r.ExpirySeconds = 60 * 60 * 24 * 365 },
+			fields: []string{FieldExpiry},
+		},
+		{
+			name:   "invalid email",
+			modify: func(r *PollRequest) { r.Email = "carla" },
+			fields: []string{FieldEmail},
+		},
+		{
+			name:   "valid email",
+			modify: func(r *PollRequest) { r.Email = "carla@example.com" },
+		},
+		{
+			name:   "invalid repay scheme",
+			modify: func(r *PollRequest) { r.RepayScheme = 0 },
+			fields: []string{FieldRepayScheme},
+		},
+		{
+			name:   "invalid visibility",
+			modify: func(r *PollRequest) { r.Visibility = 0 },
+			fields: []string{FieldVisibility},
+		},
+		{
+			name:   "private without access code",
+			modify: func(r *PollRequest) { r.Visibility = 3 },
+			fields: []string{FieldAccessCode},
+		},
+		{
+			name: "private with access code",
+			modify: func(r *PollRequest) {
+				r.Visibility = 3
+				r.AccessCode = "secret"
+			},
+		},
+		{
+			name:   "valid tags",
+			modify: func(r *PollRequest) { r.Tags = []string{"bitcoin", "meetup-2026"} },
+		},
+		{
+			name:   "invalid tag",
+			modify: func(r *PollRequest) { r.Tags = []string{"two words"} },
+			fields: []string{FieldTags},
+		},
+		{
+			name:   "long tag",
+			modify: func(r *PollRequest) { r.Tags = []string{strings.Repeat("a", maxTagLength+1)} },
+			fields: []string{FieldTags},
+		},
+		{
+			name:   "too many tags",
+			modify: func(r *PollRequest) { r.Tags = []string{"a", "b", "c", "d", "e", "f"} },
+			fields: []string{FieldTags},
+		},
+		{
+			name: "multiple errors",
+			modify: func(r *PollRequest) {
+				r.Question = ""
+				r.PayReq = ""
+			},
+			fields: []string{FieldQuestion, FieldInvoice},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := validRequest()
+			test.modify(req)
+
+			assert.Equal(t, test.fields, fieldsOf(validateFields(req)))
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	req := &PollRequest{
+		Question: " Which? ",
+		Options:  []string{" a", "", "b ", "  "},
+		Tags:     []string{" Bitcoin", "", "bitcoin", "dev "},
+	}
+	req.Normalize()
+
+	assert.Equal(t, "Which?", req.Question)
+	assert.Equal(t, []string{"a", "b"}, req.Options)
+	assert.Equal(t, []string{"bitcoin", "dev"}, req.Tags)
+}
+
+// lndBackends only provides LND, for validation which does not use the
+// database.
+type lndBackends struct {
+	Backends
+	lnd *lnd.MockLND
+}
+
+func (b *lndBackends) GetLND() lnd.Client {
+	return b.lnd
+}
+
+func TestValidateRecipients(t *testing.T) {
+	ctx := context.Background()
+	expiry := int64(60 * 60)
+
+	payReq := func(hash string) *lnrpc.PayReq {
+		return &lnrpc.PayReq{PaymentHash: hash, Expiry: expiry + expiryBufferSeconds}
+	}
+
+	b := &lndBackends{lnd: &lnd.MockLND{PayReqs: map[string]*lnrpc.PayReq{
+		"creator": payReq("a"),
+		"first":   payReq("b"),
+		"second":  payReq("c"),
+		"copy":    payReq("b"),
+		"reused":  payReq("a"),
+	}}}
+
+	tests := []struct {
+		name       string
+		recipients []Recipient
+		share      int64
+		err        error
+	}{
+		{
+			name:       "valid",
+			recipients: []Recipient{{Invoice: "first", Share: 20}, {Invoice: "second", Share: 30}},
+			share:      50,
+		},
+		{
+			name:       "duplicate recipient invoice",
+			recipients: []Recipient{{Invoice: "first", Share: 20}, {Invoice: "copy", Share: 30}},
+			err:        ErrDuplicatePayout,
+		},
+		{
+			name:       "creator's invoice",
+			recipients: []Recipient{{Invoice: "reused", Share: 20}},
+			err:        ErrDuplicatePayout,
+		},
+		{
+			name:       "shares leave nothing for the creator",
+			recipients: []Recipient{{Invoice: "first", Share: 60}, {Invoice: "second", Share: 40}},
+			err:        ErrInvalidShares,
+		},
+		{
+			name: "shares overflow",
+			recipients: []Recipient{
+				{Invoice: "first", Share: math.MaxInt64/2 + 1},
+				{Invoice: "second", Share: math.MaxInt64/2 + 1},
+			},
+			err: ErrInvalidShares,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			share, err := validateRecipients(ctx, b, "creator", test.recipients, expiry)
+			assert.Equal(t, test.err, err)
+			assert.Equal(t, test.share, share)
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package polls
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/carlaKC/lightning-poll/db"
+	"github.com/carlaKC/lightning-poll/polls/internal/types"
+	"github.com/carlaKC/lightning-poll/votes"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrPollNotFound   = errors.New("Poll not found")
+	ErrOptionNotFound = errors.New("Option does not belong to this poll")
+	ErrPollClosed     = errors.New("Poll is closed to new votes")
+)
+
+// CreateVote creates a vote for an option in an open poll, returning the ID
+// of the vote. The poll is locked while the vote is created, so that it
+// cannot be closed until the vote has been recorded, and the vote's invoice is
+// added once the lock is released. The vote is linked to the voter's linking
+// key if they are logged in.
+func CreateVote(ctx context.Context, b Backends, pollID, optionID int64, voterKey string) (int64, error) {
+	var (
+		id, sats, expiry int64
+		note             string
+	)
+	err := db.WithTx(ctx, b.GetConn(), func(tx db.Handle) error {
+		poll, err := b.GetPolls().LookupForUpdate(ctx, tx, pollID)
+		if err == db.ErrNotFound {
+			return ErrPollNotFound
+		} else if err != nil {
+			return err
+		}
+
+		// the vote's invoice expires by the time the poll closes, so that it
+		// cannot be paid once the poll has closed.
+		expiry = int64(time.Until(poll.ExpiresAt) / time.Second)
+		if poll.Status != types.PollStatusCreated || expiry <= 0 {
+			return ErrPollClosed
+		}
+
+		option, err := b.GetOptions().LookupInPoll(ctx, tx, pollID, optionID)
+		if err == db.ErrNotFound {
+			return ErrOptionNotFound
+		} else if err != nil {
+			return err
+		}
+
+		sats = poll.VoteSats
+		note = fmt.Sprintf("Vote: %v for poll: %v", option.Value, poll.Question)
+
+		// voters in polls which allow one vote per identity replace their
+		// previous vote.
+		if poll.OneVotePerIdentity {
+			id, err = votes.CreateForIdentity(ctx, b, tx, pollID, optionID, expiry, voterKey)
+			return err
+		}
+
+		id, err = votes.Create(ctx, b, tx, pollID, optionID, expiry, voterKey)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if err := votes.AddInvoice(ctx, b, id, sats, expiry, note); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// ChangeVote moves a vote in an open poll to another option, if the secret
+// provided is the vote's change secret. The vote's poll is locked while the
+// vote is changed, so that it cannot close with the vote half changed.
+func ChangeVote(ctx context.Context, b Backends, voteID, optionID int64, secret string) error {
+	vote, err := votes.Lookup(ctx, b, voteID)
+	if err != nil {
+		return err
+	}
+
+	return db.WithTx(ctx, b.GetConn(), func(tx db.Handle) error {
+		poll, err := b.GetPolls().LookupForUpdate(ctx, tx, vote.PollID)
+		if err == db.ErrNotFound {
+			return ErrPollNotFound
+		} else if err != nil {
+			return err
+		}
+
+		if poll.Status != types.PollStatusCreated || !time.Now().Before(poll.ExpiresAt) {
+			return ErrPollClosed
+		}
+
+		_, err = b.GetOptions().LookupInPoll(ctx, tx, vote.PollID, optionID)
+		if err == db.ErrNotFound {
+			return ErrOptionNotFound
+		} else if err != nil {
+			return err
+		}
+
+		return votes.ChangeOption(ctx, b, tx, voteID, optionID, secret)
+	})
+}
@@ -0,0 +1,119 @@
+// Package ratelimit limits the rate of requests per key, such as a client's
+// IP address, to protect expensive endpoints from being flooded.
+package ratelimit
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+// idleTimeout is the time after which a key's limiter is discarded if it has
+// not been used, so that memory use does not grow with every key seen.
+const idleTimeout = time.Minute * 10
+
+type limiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// Limiter allows a number of requests per minute for each key, with bursts of
+// up to the same number of requests.
+type Limiter struct {
+	perMinute int
+
+	mu       sync.Mutex
+	limiters map[string]*limiter
+	lastScan time.Time
+}
+
+// New returns a limiter which allows perMinute requests for each key. A limit
+// of zero or less disables the limiter.
+func New(perMinute int) *Limiter {
+	return &Limiter{
+		perMinute: perMinute,
+		limiters:  make(map[string]*limiter),
+		lastScan:  time.Now(),
+	}
+}
+
+// Allow returns whether a request for the key provided is within its limit.
+func (l *Limiter) Allow(key string) bool {
+	if l.perMinute <= 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.removeIdle(now)
+
+	lim, ok := l.limiters[key]
+	if !ok {
+		lim = &limiter{
+			limiter: rate.NewLimiter(rate.Every(time.Minute/time.Duration(l.perMinute)),
+				l.perMinute),
+		}
+		l.limiters[key] = lim
+	}
+	lim.lastSeen = now
+
+	return lim.limiter.AllowN(now, 1)
+}
+
+// removeIdle discards limiters which have not been used recently. Idle
+// limiters have refilled, so discarding them does not change any limits.
+func (l *Limiter) removeIdle(now time.Time) {
+	if now.Sub(l.lastScan) < idleTimeout {
+		return
+	}
+	l.lastScan = now
+
+	for key, lim := range l.limiters {
+		if now.Sub(lim.lastSeen) > idleTimeout {
+			delete(l.limiters, key)
+		}
+	}
+}
+
+// Middleware rejects requests which exceed the limit for the key returned by
+// keyFn with http.StatusTooManyRequests. Requests with an empty key are not
+// limited.
+func Middleware(l *Limiter, keyFn func(c *gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := keyFn(c)
+		if key == "" || l.Allow(key) {
+			c.Next()
+			return
+		}
+
+		c.Header("Retry-After", "60")
+		c.String(http.StatusTooManyRequests, "Too many requests, please try again later")
+		c.Abort()
+	}
+}
+
+// ClientIP keys requests by the client's IP address.
+func ClientIP(c *gin.Context) string {
+	return c.ClientIP()
+}
+
+// PostForm returns a function which keys requests by the value of a field in
+// their POST form.
+func PostForm(field string) func(c *gin.Context) string {
+	return func(c *gin.Context) string {
+		return c.PostForm(field)
+	}
+}
+
+// Param returns a function which keys requests by the value of a parameter in
+// their path.
+func Param(name string) func(c *gin.Context) string {
+	return func(c *gin.Context) string {
+		return c.Param(name)
+	}
+}
@@ -0,0 +1,77 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllow(t *testing.T) {
+	l := New(2)
+
+	require.True(t, l.Allow("a"))
+	require.True(t, l.Allow("a"))
+	require.False(t, l.Allow("a"))
+
+	// other keys have their own limit
+	require.True(t, l.Allow("b"))
+}
+
+func TestAllowDisabled(t *testing.T) {
+	l := New(0)
+
+	for i := 0; i < 10; i++ {
+		require.True(t, l.Allow("a"))
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.POST("/vote", Middleware(New(1), PostForm("poll_id")), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	post := func(pollID string) int {
+		form := url.Values{"poll_id": {pollID}}
+		req := httptest.NewRequest(http.MethodPost, "/vote", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusOK, post("1"))
+	require.Equal(t, http.StatusTooManyRequests, post("1"))
+	require.Equal(t, http.StatusOK, post("2"))
+
+	// requests without a key are not limited
+	require.Equal(t, http.StatusOK, post(""))
+	require.Equal(t, http.StatusOK, post(""))
+}
+
+func TestParam(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.POST("/access/:slug", Middleware(New(1), Param("slug")), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	post := func(slug string) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/access/"+slug, nil))
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusOK, post("a"))
+	require.Equal(t, http.StatusTooManyRequests, post("a"))
+	require.Equal(t, http.StatusOK, post("b"))
+}
@@ -1,139 +1,851 @@
 package main
 
 import (
-	"context"
 	"database/sql"
 	"errors"
 	"fmt"
-
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/carlaKC/lightning-poll/auth"
+	"github.com/carlaKC/lightning-poll/db"
+	"github.com/carlaKC/lightning-poll/health"
 	lnd_cl "github.com/carlaKC/lightning-poll/lnd"
 	"github.com/carlaKC/lightning-poll/polls"
+	"github.com/carlaKC/lightning-poll/ratelimit"
 	"github.com/carlaKC/lightning-poll/types"
 	"github.com/carlaKC/lightning-poll/votes"
 	"github.com/gin-gonic/gin"
 )
 
 type Env struct {
-	db  *sql.DB
-	lnd lnd_cl.Client
+	conn    db.Conn
+	lnd     lnd_cl.Client
+	polls   polls.PollRepository
+	options polls.OptionRepository
+	votes   votes.Repository
+	auth    auth.Repository
+}
+
+// newEnv returns an environment which stores polls, votes and logins in the
+// SQL database provided.
+func newEnv(dbc db.Conn, lnd lnd_cl.Client) *Env {
+	return &Env{
+		conn:    dbc,
+		lnd:     lnd,
+		polls:   polls.NewSQLPollRepository(),
+		options: polls.NewSQLOptionRepository(),
+		votes:   votes.NewSQLRepository(),
+		auth:    auth.NewSQLRepository(),
+	}
+}
+
+func (e *Env) GetConn() db.Conn {
+	return e.conn
 }
 
-func (e *Env) GetDB() *sql.DB {
-	return e.db
+func (e *Env) GetPolls() polls.PollRepository {
+	return e.polls
+}
+
+func (e *Env) GetOptions() polls.OptionRepository {
+	return e.options
+}
+
+func (e *Env) GetVotes() votes.Repository {
+	return e.votes
 }
 
 func (e *Env) GetLND() lnd_cl.Client {
 	return e.lnd
 }
 
+func (e *Env) GetAuth() auth.Repository {
+	return e.auth
+}
+
+// Cookies that hold a client's login challenge and session token.
+const (
+	loginCookie   = "login_k1"
+	sessionCookie = "session"
+)
+
+// loadSession sets the linking key of a logged in client in the request's
+// context. Requests without a valid session continue without one.
+func (e *Env) loadSession(c *gin.Context) {
+	token, err := c.Cookie(sessionCookie)
+	if err != nil {
+		c.Next()
+		return
+	}
+
+	key, err := auth.LookupSession(c.Request.Context(), e, token)
+	if err == nil {
+		c.Set(linkingKeyParam, key)
+	} else if err != auth.ErrNoSession {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	c.Next()
+}
+
+const linkingKeyParam = "linking_key"
+
+// linkingKey returns the linking key of a logged in client, or an empty
+// string if they are not logged in.
+func linkingKey(c *gin.Context) string {
+	return c.GetString(linkingKeyParam)
+}
+
+// setCookie sets a cookie which is only readable by the server.
+func setCookie(c *gin.Context, name, value string, maxAge time.Duration) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(name, value, int(maxAge/time.Second), "/", "", auth.SecureCookies(), true)
+}
+
+// accessCookieExpiry is how long a client is remembered as having entered a
+// private poll's access code.
+const accessCookieExpiry = time.Hour * 24 * 30
+
+// accessCookie returns the name of the cookie that holds the access token that
+// a client was given for entering a private poll's access code.
+func accessCookie(slug string) string {
+	return "poll_access_" + slug
+}
+
+// lookupPoll returns the poll with the slug provided, using the access token
+// that the client was given for it. If the poll cannot be shown, a response is
+// written and nil is returned.
+func (e *Env) lookupPoll(c *gin.Context, slug string) *polls.Poll {
+	token, _ := c.Cookie(accessCookie(slug))
+
+	poll, err := polls.LookupBySlug(c.Request.Context(), e, slug, token)
+	switch err {
+	case nil:
+		return poll
+
+	case polls.ErrPollNotFound:
+		c.String(http.StatusNotFound, err.Error())
+
+	case polls.ErrAccessDenied:
+		c.HTML(
+			http.StatusForbidden,
+			"access.html",
+			gin.H{
+				"title":     "github.com/carlaKC/lightning Poll - Private Poll",
+				"slug":      slug,
+				"incorrect": token != "",
+			},
+		)
+
+	default:
+		c.AbortWithError(http.StatusInternalServerError, err)
+	}
+
+	return nil
+}
+
+// lookupPollByID returns the poll with the ID provided, applying the same
+// access check as lookupPoll so that votes and receipts do not expose private
+// polls. If the poll cannot be shown, a response is written and nil is
+// returned.
+func (e *Env) lookupPollByID(c *gin.Context, id int64) *polls.Poll {
+	poll, err := polls.LookupPoll(c.Request.Context(), e, id)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return nil
+	}
+
+	return e.lookupPoll(c, poll.Slug)
+}
+
 func initializeRoutes(e *Env) {
+	router.Use(e.loadSession)
+
 	router.GET("/", e.showHomePage)
 	router.GET("/create", e.createPollPage)
-	router.GET("/view/:id", e.viewPollPage)
-	router.GET("/results/:id", e.viewPollResults)
+	router.GET("/view/:slug", e.viewPollPage)
+	router.GET("/results/:slug", e.viewPollResults)
 	router.GET("/vote/:id", e.viewVotePage)
+	router.GET("/receipt/:id", e.viewReceiptPage)
+	router.GET("/audit/:slug", e.viewPollAudit)
+	router.GET("/login", e.loginPage)
+	router.GET("/login/status", e.loginStatus)
+	router.GET("/lnurl/auth", e.lnurlAuth)
+	router.GET("/account", e.accountPage)
+	router.GET("/api/polls", e.listPollsAPI)
+	router.GET("/tags/:tag", e.viewTagPage)
 
 	router.POST("/create", e.createPollPost)
-	router.POST("/vote", e.createVotePost)
+	// access codes are only checked here, so attempts to guess them are
+	// rate limited for each client and each poll.
+	router.POST("/access/:slug",
+		ratelimit.Middleware(ratelimit.New(*accessIPLimit), ratelimit.ClientIP),
+		ratelimit.Middleware(ratelimit.New(*accessPollLimit), ratelimit.Param("slug")),
+		e.accessPost,
+	)
+	router.POST("/receipt/verify", e.verifyReceiptPost)
+	router.POST("/login/node", e.nodeLoginPost)
+	router.POST("/logout", e.logoutPost)
+	// every vote creates a hold invoice in LND, so votes are rate limited
+	// for each client and each poll.
+	router.POST("/vote",
+		ratelimit.Middleware(ratelimit.New(*voteIPLimit), ratelimit.ClientIP),
+		ratelimit.Middleware(ratelimit.New(*votePollLimit), ratelimit.PostForm("poll")),
+		e.createVotePost,
+	)
+	router.POST("/vote/change",
+		ratelimit.Middleware(ratelimit.New(*voteIPLimit), ratelimit.ClientIP),
+		e.changeVotePost,
+	)
+
+	router.GET("/healthz", health.Healthz)
+	router.GET("/readyz", health.Readyz(e))
 }
 
+// showHomePage lists open and closed public polls, which are searched and
+// sorted together but paged separately.
 func (e *Env) showHomePage(c *gin.Context) {
-	open, err := polls.ListActivePolls(c.Request.Context(), e)
-	if err != nil {
+	search, sort, tag := c.Query("q"), c.Query("sort"), c.Query("tag")
+
+	open, err := polls.ListPolls(c.Request.Context(), e, &polls.ListQuery{
+		Search: search,
+		Tag:    tag,
+		Sort:   sort,
+		Page:   getQueryInt(c, "page"),
+	})
+	if err == polls.ErrInvalidSort {
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	} else if err != nil {
 		c.AbortWithError(http.StatusInternalServerError, err)
+		return
 	}
 
-	inactive, err := polls.ListInactivePolls(c.Request.Context(), e)
+	closed, err := polls.ListPolls(c.Request.Context(), e, &polls.ListQuery{
+		Closed: true,
+		Search: search,
+		Tag:    tag,
+		Sort:   sort,
+		Page:   getQueryInt(c, "closed_page"),
+	})
 	if err != nil {
 		c.AbortWithError(http.StatusInternalServerError, err)
+		return
 	}
 
 	c.HTML(
 		http.StatusOK,
 		"home.html",
 		gin.H{
-			"title":  "github.com/carlaKC/lightning Poll - Home",
-			"open":   open,
-			"closed": inactive,
+			"title":        "github.com/carlaKC/lightning Poll - Home",
+			"open":         open,
+			"closed":       closed,
+			"search":       search,
+			"sort":         sort,
+			"tag":          tag,
+			"sorts":        []string{polls.SortClosesAt, polls.SortTotalSats, polls.SortVoteCount},
+			"open_pages":   pageLinks(c, "page", open),
+			"closed_pages": pageLinks(c, "closed_page", closed),
+			"linking_key":  linkingKey(c),
 		},
 	)
 
 }
 
-func (e *Env) createPollPage(c *gin.Context) {
+// viewTagPage shows the open and closed public polls with a tag, along with
+// the totals of all of them.
+func (e *Env) viewTagPage(c *gin.Context) {
+	tag := c.Param("tag")
+
+	stats, err := polls.GetTagStats(c.Request.Context(), e, tag)
+	if err == polls.ErrInvalidTag {
+		c.AbortWithError(http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	open, err := polls.ListPolls(c.Request.Context(), e, &polls.ListQuery{
+		Tag:  tag,
+		Page: getQueryInt(c, "page"),
+	})
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	closed, err := polls.ListPolls(c.Request.Context(), e, &polls.ListQuery{
+		Closed: true,
+		Tag:    tag,
+		Page:   getQueryInt(c, "closed_page"),
+	})
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
 
 	c.HTML(
 		http.StatusOK,
-		"create.html",
+		"tag.html",
 		gin.H{
-			"title":     "github.com/carlaKC/lightning Poll - Create",
-			"repayment": types.GetRepaySchemes(),
+			"title":        "github.com/carlaKC/lightning Poll - " + tag,
+			"stats":        stats,
+			"open":         open,
+			"closed":       closed,
+			"open_pages":   pageLinks(c, "page", open),
+			"closed_pages": pageLinks(c, "closed_page", closed),
 		},
 	)
 }
 
-func (e *Env) viewPollPage(c *gin.Context) {
-	id := getInt(c, "id")
+type pages struct {
+	Previous string
+	Next     string
+}
+
+// pageLinks returns links to the pages either side of a listed page, keeping
+// the rest of the request's query. Links are empty if there is no such page.
+func pageLinks(c *gin.Context, field string, page *polls.PollPage) pages {
+	link := func(n int64) string {
+		query := c.Request.URL.Query()
+		query.Set(field, strconv.FormatInt(n, 10))
+		return c.Request.URL.Path + "?" + query.Encode()
+	}
+
+	var p pages
+	if page.Page > 1 {
+		p.Previous = link(page.Page - 1)
+	}
+	if page.HasNext {
+		p.Next = link(page.Page + 1)
+	}
+
+	return p
+}
+
+type listedPoll struct {
+	Slug      string    `json:"slug"`
+	Question  string    `json:"question"`
+	Options   []string  `json:"options"`
+	Tags      []string  `json:"tags"`
+	Cost      int64     `json:"cost_sats"`
+	ClosesAt  time.Time `json:"closes_at"`
+	VoteCount int64     `json:"vote_count"`
+	TotalSats int64     `json:"total_sats"`
+}
+
+// listPollsAPI returns a page of public polls as JSON. The status query is
+// either active, the default, or closed.
+func (e *Env) listPollsAPI(c *gin.Context) {
+	var closed bool
+	switch c.Query("status") {
+	case "", "active":
+
+	case "closed":
+		closed = true
+
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be active or closed"})
+		return
+	}
+
+	page, err := polls.ListPolls(c.Request.Context(), e, &polls.ListQuery{
+		Closed:   closed,
+		Search:   c.Query("q"),
+		Tag:      c.Query("tag"),
+		Sort:     c.Query("sort"),
+		Page:     getQueryInt(c, "page"),
+		PageSize: getQueryInt(c, "page_size"),
+	})
+	switch err {
+	case nil:
+
+	case polls.ErrInvalidSort:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 
-	poll, err := polls.LookupPoll(context.Background(), e, id)
+	default:
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	listed := make([]listedPoll, 0, len(page.Polls))
+	for _, poll := range page.Polls {
+		options := make([]string, 0, len(poll.Options))
+		for _, o := range poll.Options {
+			options = append(options, o.Value)
+		}
+
+		listed = append(listed, listedPoll{
+			Slug:      poll.Slug,
+			Question:  poll.Question,
+			Options:   options,
+			Tags:      poll.Tags,
+			Cost:      poll.Cost,
+			ClosesAt:  poll.ClosesAt,
+			VoteCount: poll.VoteCount,
+			TotalSats: poll.TotalSats,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"polls":     listed,
+		"page":      page.Page,
+		"page_size": page.PageSize,
+		"has_next":  page.HasNext,
+	})
+}
+
+// loginPage shows an LNURL-auth challenge for the client's wallet to sign. The
+// challenge is stored in a cookie, so that only this client can exchange it
+// for a session once it is signed.
+func (e *Env) loginPage(c *gin.Context) {
+	challenge, err := auth.NewChallenge(c.Request.Context(), e)
 	if err != nil {
 		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	setCookie(c, loginCookie, challenge.K1, time.Minute*10)
+
+	c.HTML(
+		http.StatusOK,
+		"login.html",
+		gin.H{
+			"title":        "github.com/carlaKC/lightning Poll - Log In",
+			"lnurl":        challenge.LNURL,
+			"node_message": auth.NodeMessage(challenge.K1),
+		},
+	)
+}
+
+// loginStatus reports whether the client's login challenge has been signed,
+// and starts their session if it has.
+func (e *Env) loginStatus(c *gin.Context) {
+	k1, err := c.Cookie(loginCookie)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": auth.ErrChallengeNotFound.Error()})
+		return
+	}
+
+	token, _, err := auth.Login(c.Request.Context(), e, k1)
+	switch err {
+	case nil:
+
+	case auth.ErrNotSigned:
+		c.JSON(http.StatusOK, gin.H{"logged_in": false})
+		return
+
+	case auth.ErrChallengeNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+
+	default:
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	setCookie(c, loginCookie, "", -1)
+	setCookie(c, sessionCookie, token, auth.SessionExpiry())
+	c.JSON(http.StatusOK, gin.H{"logged_in": true})
+}
+
+// lnurlAuth is the LNURL-auth callback that wallets call with their signature
+// of a login challenge.
+func (e *Env) lnurlAuth(c *gin.Context) {
+	if c.Query("tag") != "login" {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "ERROR", "reason": "unsupported tag"})
+		return
+	}
+
+	err := auth.CompleteChallenge(c.Request.Context(), e, c.Query("k1"), c.Query("sig"),
+		c.Query("key"))
+	switch err {
+	case nil:
+		c.JSON(http.StatusOK, gin.H{"status": "OK"})
+
+	case auth.ErrChallengeNotFound, auth.ErrInvalidSignature:
+		c.JSON(http.StatusBadRequest, gin.H{"status": "ERROR", "reason": err.Error()})
+
+	default:
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "ERROR",
+			"reason": "internal error"})
+	}
+}
+
+// nodeLoginPost logs a node operator in with their node's signature of the
+// client's login challenge.
+func (e *Env) nodeLoginPost(c *gin.Context) {
+	k1, err := c.Cookie(loginCookie)
+	if err != nil {
+		c.String(http.StatusNotFound, auth.ErrChallengeNotFound.Error())
+		return
+	}
+
+	ctx := c.Request.Context()
+	err = auth.CompleteNodeChallenge(ctx, e, k1, strings.TrimSpace(c.PostForm("signature")))
+	switch err {
+	case nil:
+
+	case auth.ErrChallengeNotFound:
+		c.String(http.StatusNotFound, err.Error())
+		return
+
+	case auth.ErrInvalidSignature:
+		c.String(http.StatusBadRequest, err.Error())
+		return
+
+	default:
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	token, _, err := auth.Login(ctx, e, k1)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	setCookie(c, loginCookie, "", -1)
+	setCookie(c, sessionCookie, token, auth.SessionExpiry())
+	c.Redirect(http.StatusSeeOther, "/account")
+}
+
+func (e *Env) logoutPost(c *gin.Context) {
+	token, err := c.Cookie(sessionCookie)
+	if err == nil {
+		err = auth.Logout(c.Request.Context(), e, token)
+		if err != nil && err != auth.ErrNoSession {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	setCookie(c, sessionCookie, "", -1)
+	c.Redirect(http.StatusSeeOther, "/")
+}
+
+// accountPage shows a logged in user the polls they have created and the
+// votes they have made.
+func (e *Env) accountPage(c *gin.Context) {
+	key := linkingKey(c)
+	if key == "" {
+		c.Redirect(http.StatusSeeOther, "/login")
+		return
+	}
+
+	created, err := polls.ListCreatedPolls(c.Request.Context(), e, key)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	voted, err := votes.ListByVoter(c.Request.Context(), e, key)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	c.HTML(
+		http.StatusOK,
+		"account.html",
+		gin.H{
+			"title":       "github.com/carlaKC/lightning Poll - Account",
+			"linking_key": key,
+			"polls":       created,
+			"votes":       voted,
+		},
+	)
+}
+
+func (e *Env) createPollPage(c *gin.Context) {
+	renderCreatePage(c, http.StatusOK, url.Values{}, nil)
+}
+
+// renderCreatePage renders the create poll form, filled with the values
+// provided and listing any errors in them.
+func renderCreatePage(c *gin.Context, status int, form url.Values,
+	verr *polls.ValidationError) {
+
+	var fieldErrors []*polls.FieldError
+	if verr != nil {
+		fieldErrors = verr.Fields
+	}
+
+	c.HTML(
+		status,
+		"create.html",
+		gin.H{
+			"title":      "github.com/carlaKC/lightning Poll - Create",
+			"repayment":  types.GetRepaySchemes(),
+			"visibility": types.GetVisibilities(),
+			"fee":        polls.GetOperatorFee(),
+			"form":       form,
+			"errors":     fieldErrors,
+		},
+	)
+}
+
+func (e *Env) viewPollPage(c *gin.Context) {
+	poll := e.lookupPoll(c, c.Param("slug"))
+	if poll == nil {
+		return
 	}
 
 	c.HTML(
 		http.StatusOK,
 		"view.html",
 		gin.H{
-			"title":   "github.com/carlaKC/lightning Poll - View Poll",
-			"poll":    poll,
-			"is_open": time.Now().Before(poll.ClosesAt),
-			"unix":    int64(poll.ClosesAt.Unix()),
+			"title":       "github.com/carlaKC/lightning Poll - View Poll",
+			"poll":        poll,
+			"is_open":     time.Now().Before(poll.ClosesAt),
+			"unix":        int64(poll.ClosesAt.Unix()),
+			"fee":         poll.Fee,
+			"linking_key": linkingKey(c),
+			"visibility":  poll.Visibility.GetDetails(),
+			"public":      poll.Visibility == types.VisibilityPublic,
 		},
 	)
 }
 
+// accessPost remembers the access code that a client entered for a private
+// poll, which is checked when they view it.
+func (e *Env) accessPost(c *gin.Context) {
+	slug := c.Param("slug")
+
+	token, err := polls.UnlockPoll(c.Request.Context(), e, slug,
+		strings.TrimSpace(c.PostForm("access_code")))
+	switch err {
+	case nil:
+
+	case polls.ErrPollNotFound:
+		c.String(http.StatusNotFound, err.Error())
+		return
+
+	case polls.ErrAccessDenied:
+		c.HTML(
+			http.StatusForbidden,
+			"access.html",
+			gin.H{
+				"title":     "github.com/carlaKC/lightning Poll - Private Poll",
+				"slug":      slug,
+				"incorrect": true,
+			},
+		)
+		return
+
+	default:
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	if token != "" {
+		setCookie(c, accessCookie(slug), token, accessCookieExpiry)
+	}
+	c.Redirect(http.StatusSeeOther, "/view/"+url.PathEscape(slug))
+}
+
 func (e *Env) viewVotePage(c *gin.Context) {
-	id := getInt(c, "id")
+	e.renderVotePage(c, getInt(c, "id"), "")
+}
 
+type voteChange struct {
+	From      string
+	To        string
+	ChangedAt time.Time
+}
+
+// renderVotePage shows a vote's invoice and the changes made to it. A vote's
+// change secret is only shown to the voter when they create it, so that
+// anyone else viewing the vote cannot change it.
+func (e *Env) renderVotePage(c *gin.Context, id int64, changeSecret string) {
 	vote, err := votes.Lookup(c.Request.Context(), e, id)
-	if err != nil {
+	if err == sql.ErrNoRows {
+		c.String(http.StatusNotFound, "Vote not found")
+		return
+	} else if err != nil {
 		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	poll := e.lookupPollByID(c, vote.PollID)
+	if poll == nil {
+		return
 	}
 
-	poll, err := polls.LookupPoll(c.Request.Context(), e, vote.PollID)
+	changes, err := votes.ListChanges(c.Request.Context(), e, id)
 	if err != nil {
 		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	var changed []voteChange
+	for _, change := range changes {
+		changed = append(changed, voteChange{
+			From:      optionValue(poll, change.FromOptionID),
+			To:        optionValue(poll, change.ToOptionID),
+			ChangedAt: change.ChangedAt,
+		})
 	}
 
 	c.HTML(
 		http.StatusOK,
 		"vote.html",
 		gin.H{
-			"title": "github.com/carlaKC/lightning Poll - View Vote",
-			"poll":  poll,
-			"vote":  vote,
+			"title":         "github.com/carlaKC/lightning Poll - View Vote",
+			"poll":          poll,
+			"vote":          vote,
+			"option":        optionValue(poll, vote.OptionID),
+			"is_open":       time.Now().Before(poll.ClosesAt),
+			"changes":       changed,
+			"change_secret": changeSecret,
 		},
 	)
 }
 
+// optionValue returns the value of one of a poll's options.
+func optionValue(poll *polls.Poll, optionID int64) string {
+	for _, o := range poll.Options {
+		if o.ID == optionID {
+			return o.Value
+		}
+	}
+
+	return ""
+}
+
+func (e *Env) viewReceiptPage(c *gin.Context) {
+	id := getInt(c, "id")
+
+	vote, err := votes.Lookup(c.Request.Context(), e, id)
+	if err == sql.ErrNoRows {
+		c.String(http.StatusNotFound, "Vote not found")
+		return
+	} else if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	// receipts are only signed for clients who can view the vote's poll.
+	poll := e.lookupPollByID(c, vote.PollID)
+	if poll == nil {
+		return
+	}
+
+	receipt, err := votes.IssueReceipt(c.Request.Context(), e, id)
+	if err == sql.ErrNoRows {
+		c.String(http.StatusNotFound, "Vote not found")
+		return
+	} else if err == votes.ErrVoteNotPaid {
+		c.String(http.StatusConflict, err.Error())
+		return
+	} else if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	c.HTML(
+		http.StatusOK,
+		"receipt.html",
+		gin.H{
+			"title":   "github.com/carlaKC/lightning Poll - Vote Receipt",
+			"poll":    poll,
+			"option":  optionValue(poll, receipt.OptionID),
+			"receipt": receipt,
+		},
+	)
+}
+
+// verifyReceiptPost checks a receipt's message and signature, and reports
+// whether it was signed by our node along with the vote's outcome.
+func (e *Env) verifyReceiptPost(c *gin.Context) {
+	receipt, err := votes.ParseReceipt(c.PostForm("message"), c.PostForm("signature"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"valid": false, "error": err.Error()})
+		return
+	}
+
+	err = votes.VerifyReceipt(c.Request.Context(), e, receipt)
+	switch err {
+	case nil:
+
+	case votes.ErrInvalidReceipt, sql.ErrNoRows:
+		c.JSON(http.StatusOK, gin.H{"valid": false})
+		return
+
+	default:
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"valid":        true,
+		"pubkey":       receipt.Pubkey,
+		"poll_id":      receipt.PollID,
+		"option_id":    receipt.OptionID,
+		"payment_hash": receipt.PaymentHash,
+		"timestamp":    receipt.Timestamp.Unix(),
+		"outcome":      receipt.Outcome,
+	})
+}
+
+// viewPollAudit returns a closed poll's audit as JSON, so that anyone can
+// check its tally against the Merkle root committed when it closed.
+func (e *Env) viewPollAudit(c *gin.Context) {
+	slug := c.Param("slug")
+	token, _ := c.Cookie(accessCookie(slug))
+
+	poll, err := polls.LookupBySlug(c.Request.Context(), e, slug, token)
+	switch err {
+	case nil:
+
+	case polls.ErrPollNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+
+	case polls.ErrAccessDenied:
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+
+	default:
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	audit, err := polls.GetAudit(c.Request.Context(), e, poll.ID)
+	switch err {
+	case nil:
+
+	case polls.ErrNoAudit:
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+
+	default:
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, audit)
+}
+
 type result struct {
 	Value string
 	Count int64
 }
 
 func (e *Env) viewPollResults(c *gin.Context) {
-	pollID := getInt(c, "id")
-
-	poll, err := polls.LookupPoll(c.Request.Context(), e, pollID)
-	if err != nil {
-		c.AbortWithError(http.StatusInternalServerError, err)
+	poll := e.lookupPoll(c, c.Param("slug"))
+	if poll == nil {
+		return
 	}
 
-	results, err := votes.GetResults(c.Request.Context(), e, pollID)
+	results, err := votes.GetResults(c.Request.Context(), e, poll.ID)
 	if err != nil {
 		c.AbortWithError(http.StatusInternalServerError, err)
 	}
@@ -175,61 +887,230 @@ func getInt(c *gin.Context, field string) int64 {
 	return num
 }
 
-func getPostInt(c *gin.Context, field string) int64 {
-	num, err := strconv.ParseInt(c.PostForm(field), 10, 64)
+// getQueryInt parses an optional integer query parameter, returning zero if it
+// is missing or invalid.
+func getQueryInt(c *gin.Context, field string) int64 {
+	num, _ := strconv.ParseInt(c.Query(field), 10, 64)
+	return num
+}
+
+// getFormInt parses an integer field of a form, adding an error for the field
+// if it is missing or invalid.
+func getFormInt(c *gin.Context, field, message string, verr *polls.ValidationError) int64 {
+	num, err := strconv.ParseInt(strings.TrimSpace(c.PostForm(field)), 10, 64)
 	if err != nil {
-		c.AbortWithError(http.StatusInternalServerError, err)
+		verr.Add(field, message)
 	}
 	return num
 }
 
+// getRecipients reads the optional additional payout recipients from the
+// create poll form. Rows with no invoice are ignored.
+func getRecipients(c *gin.Context) ([]polls.Recipient, error) {
+	invoices := c.PostFormArray("recipient_invoice")
+	shares := c.PostFormArray("recipient_share")
+	if len(invoices) != len(shares) {
+		return nil, errors.New("Each payout recipient requires an invoice and a share")
+	}
+
+	var recipients []polls.Recipient
+	for i, invoice := range invoices {
+		if invoice == "" {
+			continue
+		}
+
+		share, err := strconv.ParseInt(shares[i], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid share for recipient %v", i+1)
+		}
+
+		recipients = append(recipients, polls.Recipient{Invoice: invoice, Share: share})
+	}
+
+	return recipients, nil
+}
+
 func (e *Env) createPollPost(c *gin.Context) {
-	ctx := context.Background()
+	ctx := c.Request.Context()
 
-	question := c.PostForm("question")
-	payReq := c.PostForm("invoice")
-	sats := getPostInt(c, "satoshis")
-	email := c.PostForm("email")
+	// values that cannot be parsed are reported alongside any other invalid
+	// fields, so that the form is only re-rendered once with every error.
+	verr := new(polls.ValidationError)
 
-	expiry := getPostInt(c, "expiry")
-	expirySeconds := expiry * 60 * 60 // hours to seconds
+	expiry := getFormInt(c, polls.FieldExpiry, "Expiry must be a whole number of hours", verr)
+	req := &polls.PollRequest{
+		Question:      c.PostForm("question"),
+		PayReq:        c.PostForm("invoice"),
+		Email:         c.PostForm("email"),
+		RepayScheme:   getFormInt(c, polls.FieldRepayScheme, "A voter refund strategy is required", verr),
+		Options:       c.PostFormArray("option"),
+		ExpirySeconds: expiry * 60 * 60, // hours to seconds
+		VoteSats:      getFormInt(c, polls.FieldSats, "Satoshis per vote must be a whole number", verr),
+		CreatorKey:    linkingKey(c),
 
-	options, ok := c.GetPostFormArray("option")
-	if !ok {
-		c.Error(errors.New("Could not get options"))
+		OneVotePerIdentity: c.PostForm("one_vote_per_identity") != "",
+		Visibility:         getFormInt(c, polls.FieldVisibility, "A visibility is required", verr),
+		AccessCode:         c.PostForm(polls.FieldAccessCode),
+		Tags:               strings.Split(c.PostForm(polls.FieldTags), ","),
 	}
 
-	if err := polls.ValidatePayout(ctx, e, payReq, expirySeconds); err != nil {
-		c.String(http.StatusBadRequest, err.Error())
+	recipients, err := getRecipients(c)
+	if err != nil {
+		verr.Add(polls.FieldRecipients, err.Error())
+	}
+	req.Recipients = recipients
+
+	var id int64
+	if verr.Empty() {
+		id, err = polls.CreatePoll(ctx, e, req)
+	} else {
+		req.Normalize()
+		err = polls.ValidatePoll(ctx, e, req)
+		if err == nil {
+			err = verr
+		}
+	}
+
+	var reqErr *polls.ValidationError
+	if errors.As(err, &reqErr) {
+		if reqErr != verr {
+			addUnreported(verr, reqErr)
+		}
+		renderCreatePage(c, http.StatusBadRequest, c.Request.PostForm, verr)
+		return
+	} else if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
 		return
 	}
 
-	id, err := polls.CreatePoll(context.Background(), e, question, payReq, email,
-		getPostInt(c, "payout"), options, expirySeconds, sats)
+	poll, err := polls.LookupPoll(ctx, e, id)
 	if err != nil {
 		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	// the creator of a private poll has entered its access code already.
+	if poll.Visibility == types.VisibilityPrivate {
+		token, err := polls.UnlockPoll(ctx, e, poll.Slug, req.AccessCode)
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		setCookie(c, accessCookie(poll.Slug), token, accessCookieExpiry)
 	}
 
-	// TODO(carla): figure out non hacky redirect
-	c.Params = append(c.Params, gin.Param{Key: "id", Value: fmt.Sprintf("%v", id)})
-	e.viewPollPage(c)
+	c.Redirect(http.StatusSeeOther, "/view/"+poll.Slug)
+}
+
+// addUnreported adds errors from one validation error to another, skipping
+// fields that already have an error.
+func addUnreported(to, from *polls.ValidationError) {
+	reported := make(map[string]bool)
+	for _, f := range to.Fields {
+		reported[f.Field] = true
+	}
+
+	for _, f := range from.Fields {
+		if !reported[f.Field] {
+			to.Add(f.Field, f.Message)
+		}
+	}
 }
 
 func (e *Env) createVotePost(c *gin.Context) {
-	pollID := getPostInt(c, "poll_id")
-	optionID := getPostInt(c, "id")
+	optionID, err := strconv.ParseInt(c.PostForm("id"), 10, 64)
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid option")
+		return
+	}
+
+	poll := e.lookupPoll(c, c.PostForm("poll"))
+	if poll == nil {
+		return
+	}
+
+	id, err := polls.CreateVote(c.Request.Context(), e, poll.ID, optionID, linkingKey(c))
+	switch err {
+	case nil:
+
+	case polls.ErrPollNotFound:
+		c.String(http.StatusNotFound, err.Error())
+		return
+
+	case polls.ErrOptionNotFound, votes.ErrPollTooLong:
+		c.String(http.StatusBadRequest, err.Error())
+		return
 
-	poll, err := polls.LookupPoll(c.Request.Context(), e, pollID)
+	case polls.ErrPollClosed:
+		c.String(http.StatusConflict, err.Error())
+		return
+
+	case votes.ErrTooManyOpenVotes:
+		c.String(http.StatusTooManyRequests, err.Error())
+		return
+
+	case votes.ErrIdentityRequired:
+		c.Redirect(http.StatusSeeOther, "/login")
+		return
+
+	default:
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	secret, err := votes.ChangeSecret(id)
 	if err != nil {
 		c.AbortWithError(http.StatusInternalServerError, err)
+		return
 	}
-	expirySeconds := time.Now().Sub(poll.ClosesAt).Seconds()
-	note := fmt.Sprintf("Vote: %v for poll: %v", c.PostForm("opt_str"), c.PostForm("poll_str"))
-	id, err := votes.Create(c.Request.Context(), e, pollID, optionID, poll.Cost, int64(expirySeconds), note)
+
+	e.renderVotePage(c, id, secret)
+}
+
+// changeVotePost moves a vote to another option for a voter who has the
+// vote's change secret.
+func (e *Env) changeVotePost(c *gin.Context) {
+	voteID, err := strconv.ParseInt(c.PostForm("vote_id"), 10, 64)
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid vote")
+		return
+	}
+
+	optionID, err := strconv.ParseInt(c.PostForm("id"), 10, 64)
 	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid option")
+		return
+	}
+
+	err = polls.ChangeVote(c.Request.Context(), e, voteID, optionID,
+		strings.TrimSpace(c.PostForm("secret")))
+	switch err {
+	case nil:
+
+	case sql.ErrNoRows:
+		c.String(http.StatusNotFound, "Vote not found")
+		return
+
+	case polls.ErrPollNotFound:
+		c.String(http.StatusNotFound, err.Error())
+		return
+
+	case polls.ErrOptionNotFound:
+		c.String(http.StatusBadRequest, err.Error())
+		return
+
+	case votes.ErrInvalidChangeSecret:
+		c.String(http.StatusForbidden, err.Error())
+		return
+
+	case polls.ErrPollClosed, votes.ErrVoteNotChangeable:
+		c.String(http.StatusConflict, err.Error())
+		return
+
+	default:
 		c.AbortWithError(http.StatusInternalServerError, err)
+		return
 	}
 
-	c.Params = append(c.Params, gin.Param{Key: "id", Value: fmt.Sprintf("%v", id)})
-	e.viewVotePage(c)
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/vote/%v", voteID))
 }
@@ -0,0 +1,93 @@
+// Package tracing configures OpenTelemetry tracing, so that the time spent
+// handling a request can be attributed to our own code, the database or LND.
+package tracing
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ServiceName identifies lightning-poll's spans in a trace collector.
+const ServiceName = "lightning-poll"
+
+var (
+	traceExporter = flag.String("trace_exporter", "", "Exporter for trace spans: otlp, "+
+		"stdout or empty to disable tracing")
+	otlpAddress = flag.String("otlp_address", "localhost:4317", "Address of the OTLP "+
+		"collector that spans are exported to over grpc")
+)
+
+// Init configures the global tracer provider using the trace_exporter flag. It
+// must be called after flags have been parsed, and the function it returns
+// should be called on shutdown to flush any buffered spans.
+func Init(ctx context.Context) (func(context.Context) error, error) {
+	var (
+		exporter sdktrace.SpanExporter
+		err      error
+	)
+	switch *traceExporter {
+	case "":
+		return func(context.Context) error { return nil }, nil
+
+	case "otlp":
+		exporter, err = otlptracegrpc.New(ctx,
+			otlptracegrpc.WithEndpoint(*otlpAddress),
+			otlptracegrpc.WithInsecure(),
+		)
+
+	case "stdout":
+		exporter, err = stdouttrace.New(
+			stdouttrace.WithWriter(os.Stdout),
+			stdouttrace.WithPrettyPrint(),
+		)
+
+	default:
+		return nil, fmt.Errorf("unknown trace exporter: %v", *traceExporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			semconv.ServiceName(ServiceName),
+		)),
+	)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{},
+	))
+
+	return provider.Shutdown, nil
+}
+
+// Start starts a span as a child of any span in the context provided. If
+// tracing is disabled the span returned does nothing.
+func Start(ctx context.Context, name string) (context.Context, trace.Span) {
+	return otel.Tracer(ServiceName).Start(ctx, name)
+}
+
+// End records an error on a span, if there is one, and ends it. It is
+// intended to be deferred with a pointer to a named error return.
+func End(span trace.Span, err *error) {
+	if err != nil && *err != nil {
+		span.RecordError(*err)
+		span.SetStatus(codes.Error, (*err).Error())
+	}
+
+	span.End()
+}
@@ -0,0 +1,18 @@
+package types
+
+// Discrepancy describes a difference between the state of a vote or poll in
+// our database and the state of its invoice or payment in our Lightning node.
+type Discrepancy struct {
+	// Kind is the type of record that is out of sync, vote or poll.
+	Kind string
+	ID   int64
+
+	Description string
+
+	// Safe is true if the discrepancy can be repaired automatically. Unsafe
+	// discrepancies require manual investigation by the operator.
+	Safe bool
+
+	// Repaired is true if the discrepancy was repaired.
+	Repaired bool
+}
@@ -0,0 +1,44 @@
+package types
+
+// Visibility determines who can find and view a poll.
+type Visibility int
+
+var (
+	VisibilityUnknown  Visibility = 0
+	VisibilityPublic   Visibility = 1
+	VisibilityUnlisted Visibility = 2
+	VisibilityPrivate  Visibility = 3
+	visibilitySentinel Visibility = 4
+)
+
+func (v Visibility) Valid() bool {
+	return v > VisibilityUnknown && v < visibilitySentinel
+}
+
+func (v Visibility) GetDetails() VisibilityDetails {
+	return allVisibilities[v]
+}
+
+type VisibilityDetails struct {
+	Name        string
+	Description string
+}
+
+var allVisibilities = map[Visibility]VisibilityDetails{
+	VisibilityPublic: {
+		Name:        "Public",
+		Description: "Listed on the home page for anybody to vote in",
+	},
+	VisibilityUnlisted: {
+		Name:        "Unlisted",
+		Description: "Only people who have the poll's link can vote in it",
+	},
+	VisibilityPrivate: {
+		Name:        "Private",
+		Description: "Only people who have the poll's link and access code can vote in it",
+	},
+}
+
+func GetVisibilities() map[Visibility]VisibilityDetails {
+	return allVisibilities
+}
@@ -0,0 +1,84 @@
+package votes
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"github.com/carlaKC/lightning-poll/audit"
+	"github.com/carlaKC/lightning-poll/votes/internal/types"
+)
+
+// AuditEntry is a vote in a poll's audit export. The preimage of a settled
+// vote is revealed, so that anyone can check that it was paid for.
+type AuditEntry struct {
+	PaymentHash string `json:"payment_hash"`
+	OptionID    int64  `json:"option_id"`
+	Status      string `json:"status"`
+	Preimage    string `json:"preimage,omitempty"`
+}
+
+var auditStatuses = map[types.VoteStatus]string{
+	types.VoteStatusPaid:     "paid",
+	types.VoteStatusReturned: "returned",
+	types.VoteStatusSettled:  "settled",
+}
+
+// Leaf returns the data that the entry's Merkle leaf is the hash of. The
+// preimage is not committed to, so that the root can be calculated before
+// votes are settled.
+func (e *AuditEntry) Leaf() []byte {
+	return []byte(fmt.Sprintf("%v:%v:%v", e.PaymentHash, e.OptionID, e.Status))
+}
+
+// AuditRoot returns the hex encoded Merkle root of a list of audit entries,
+// which must be sorted by payment hash.
+func AuditRoot(entries []*AuditEntry) string {
+	var leaves [][32]byte
+	for _, e := range entries {
+		leaves = append(leaves, audit.LeafHash(e.Leaf()))
+	}
+
+	root := audit.Root(leaves)
+	return hex.EncodeToString(root[:])
+}
+
+// AuditVotes returns an audit entry for every vote counted in a poll's
+// results, sorted by payment hash. Preimages are revealed for settled votes if
+// reveal is true.
+func AuditVotes(ctx context.Context, b Backends, pollID int64, reveal bool) ([]*AuditEntry, error) {
+	votes, err := getVotes(ctx, b, pollID)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*AuditEntry
+	for _, vote := range votes {
+		e := &AuditEntry{
+			PaymentHash: vote.PayHash,
+			OptionID:    vote.OptionID,
+			Status:      auditStatuses[vote.Status],
+		}
+
+		if reveal && vote.Status == types.VoteStatusSettled {
+			preimage, err := votePreimage(&Vote{
+				ID:       vote.ID,
+				Hash:     vote.PayHash,
+				Preimage: vote.Preimage,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("vote %v: %v", vote.ID, err)
+			}
+			e.Preimage = hex.EncodeToString(preimage)
+		}
+
+		entries = append(entries, e)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].PaymentHash < entries[j].PaymentHash
+	})
+
+	return entries, nil
+}
@@ -0,0 +1,83 @@
+package votes
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/carlaKC/lightning-poll/votes/internal/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditVotes(t *testing.T) {
+	ctx := context.Background()
+	setPreimageSeed(t, testPreimageSeed)
+	b := &memBackends{votes: NewMemRepository()}
+
+	// createVote creates a vote with a derived preimage, and moves it to the
+	// status provided.
+	createVote := func(id, pollID, optionID int64, status types.VoteStatus) string {
+		preimage, err := DerivePreimage(id)
+		require.NoError(t, err)
+		hash := sha256.Sum256(preimage)
+		payHash := hex.EncodeToString(hash[:])
+
+		err = b.votes.Create(ctx, nil, id, pollID, optionID, 3600, 3600, "lnbc1", payHash, "", nil)
+		require.NoError(t, err)
+
+		if status != types.VoteStatusCreated {
+			require.NoError(t, b.votes.MarkPaid(ctx, nil, id, 100, uint64(id)))
+		}
+		if status != types.VoteStatusCreated && status != types.VoteStatusPaid {
+			err = b.votes.UpdateStatus(ctx, nil, id, types.VoteStatusPaid, status)
+			require.NoError(t, err)
+		}
+
+		return payHash
+	}
+
+	settled := createVote(1, 10, 20, types.VoteStatusSettled)
+	returned := createVote(2, 10, 21, types.VoteStatusReturned)
+
+	// unpaid votes, canceled votes and votes in other polls are not counted.
+	createVote(3, 10, 20, types.VoteStatusCreated)
+	createVote(4, 10, 20, types.VoteStatusCanceled)
+	createVote(5, 11, 20, types.VoteStatusSettled)
+
+	entries, err := AuditVotes(ctx, b, 10, true)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.True(t, entries[0].PaymentHash < entries[1].PaymentHash)
+
+	byHash := make(map[string]*AuditEntry)
+	for _, e := range entries {
+		byHash[e.PaymentHash] = e
+	}
+
+	preimage, err := DerivePreimage(1)
+	require.NoError(t, err)
+	assert.Equal(t, &AuditEntry{
+		PaymentHash: settled,
+		OptionID:    20,
+		Status:      "settled",
+		Preimage:    hex.EncodeToString(preimage),
+	}, byHash[settled])
+	assert.Equal(t, &AuditEntry{
+		PaymentHash: returned,
+		OptionID:    21,
+		Status:      "returned",
+	}, byHash[returned])
+
+	// preimages are not part of the root, so it is the same whether or not
+	// they are revealed.
+	hidden, err := AuditVotes(ctx, b, 10, false)
+	require.NoError(t, err)
+	assert.Empty(t, hidden[0].Preimage+hidden[1].Preimage)
+	assert.Equal(t, AuditRoot(entries), AuditRoot(hidden))
+
+	// changing any vote changes the root.
+	hidden[0].OptionID++
+	assert.NotEqual(t, AuditRoot(entries), AuditRoot(hidden))
+}
@@ -3,29 +3,68 @@ package votes
 import (
 	"context"
 	"encoding/hex"
-	"log"
+	"sync"
 	"time"
 
-	votes_db "github.com/carlaKC/lightning-poll/votes/internal/db/votes"
+	"github.com/carlaKC/lightning-poll/db"
+	"github.com/carlaKC/lightning-poll/health"
+	"github.com/carlaKC/lightning-poll/ledger"
+	"github.com/carlaKC/lightning-poll/logging"
 	"github.com/carlaKC/lightning-poll/votes/internal/types"
 	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/pkg/errors"
 )
 
-func StartLoops(b Backends) {
-	go expireVotesForever(b)
+// Names and intervals of the background loops, which report their successful
+// iterations to the health package.
+const (
+	expireVotesLoop    = "votes/expire"
+	cancelExpiringLoop = "votes/cancel_expiring"
+	metricsLoop        = "votes/metrics"
+
+	expireVotesInterval    = time.Minute * 5
+	cancelExpiringInterval = time.Minute * 10
+	metricsInterval        = time.Minute
+)
+
+// StartLoops starts the background loops for votes, which stop once ctx is
+// canceled and the iteration in progress has finished, marking wg done.
+func StartLoops(ctx context.Context, wg *sync.WaitGroup, b Backends) {
+	health.RegisterLoop(expireVotesLoop, expireVotesInterval)
+	health.RegisterLoop(cancelExpiringLoop, cancelExpiringInterval)
+	health.RegisterLoop(metricsLoop, metricsInterval)
+
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		expireVotesForever(ctx, b)
+	}()
+	go func() {
+		defer wg.Done()
+		cancelExpiringVotesForever(ctx, b)
+	}()
+	go func() {
+		defer wg.Done()
+		updateMetricsForever(ctx, b)
+	}()
 }
 
-func expireVotesForever(b Backends) {
+func expireVotesForever(ctx context.Context, b Backends) {
 	for {
 		if err := expireVotes(context.Background(), b); err != nil {
-			log.Printf("votes/ops: expireVotesForever error: %v", err)
+			logging.From(ctx).Error("expire votes failed", "error", err)
+		} else {
+			health.Beat(expireVotesLoop)
+		}
+
+		if !health.Wait(ctx, expireVotesInterval) {
+			return
 		}
-		time.Sleep(time.Minute * 5)
 	}
 }
 
 func expireVotes(ctx context.Context, b Backends) error {
-	expired, err := votes_db.ListExpired(ctx, b.GetDB())
+	expired, err := b.GetVotes().ListExpired(ctx, b.GetConn())
 	if err != nil {
 		return err
 	}
@@ -35,6 +74,23 @@ func expireVotes(ctx context.Context, b Backends) error {
 	}
 
 	for _, exp := range expired {
+		// votes without a payment request never had an invoice shown to the
+		// voter, and may not have an invoice at all. Any invoice is canceled
+		// so that it cannot be paid, ignoring errors for invoices which LND
+		// does not have.
+		if exp.PayReq == "" {
+			if err := b.GetLND().CancelHoldInvoice(ctx, exp.PayHash); err != nil {
+				logging.From(ctx).Warn("cancel vote without payment request failed",
+					logging.FieldVoteID, exp.ID, "error", err)
+			}
+
+			if err := b.GetVotes().UpdateStatus(ctx, b.GetConn(), exp.ID,
+				types.VoteStatusCreated, types.VoteStatusExpired); err != nil {
+				return err
+			}
+			continue
+		}
+
 		// if the invoice has been settled, update vote to paid
 		inv, err := b.GetLND().LookupInvoice(ctx, exp.PayHash)
 		if err != nil {
@@ -49,21 +105,79 @@ func expireVotes(ctx context.Context, b Backends) error {
 			continue
 		}
 
-		// if the invoice has not been paid, expire it
-		if err := votes_db.UpdateStatus(ctx, b.GetDB(), exp.ID, types.VoteStatusCreated,
+		// if the invoice has not been paid, cancel it so that it cannot be
+		// paid in future and expire the vote
+		if err := b.GetLND().CancelHoldInvoice(ctx, exp.PayHash); err != nil {
+			return err
+		}
+
+		if err := b.GetVotes().UpdateStatus(ctx, b.GetConn(), exp.ID, types.VoteStatusCreated,
 			types.VoteStatusExpired); err != nil {
 			return err
 		}
+		recordInvoice(invoiceExpired, 0)
 	}
 	return nil
 }
 
-// markInvoicePaid marks an invoice as paid, so that it can be settled or released in future
+// errAlreadyPaid is returned when a vote has already been marked paid.
+var errAlreadyPaid = errors.New("vote already marked paid")
+
+// markInvoicePaid marks an invoice as paid, so that it can be settled or released in future.
+// The invoice subscription, expiry loop and reconciler can all see the same
+// accepted invoice, so a vote which is no longer created has already been
+// handled and is left as it is. A vote which replaces an identity's vote
+// cancels the old vote's hold invoice, refunding it if it was paid.
 func markInvoicePaid(ctx context.Context, b Backends, payHash string, settledAmount int64, settleIndex uint64) error {
-	vote, err := votes_db.LookupByHash(ctx, b.GetDB(), payHash)
+	vote, err := b.GetVotes().LookupByHash(ctx, b.GetConn(), payHash)
+	if err != nil {
+		return err
+	}
+
+	replaced, err := replacedVote(ctx, b, vote)
 	if err != nil {
 		return err
 	}
 
-	return votes_db.MarkPaid(ctx, b.GetDB(), vote.ID, settledAmount, settleIndex)
+	if replaced != nil && (replaced.Status == types.VoteStatusCreated ||
+		replaced.Status == types.VoteStatusPaid) {
+
+		if err := b.GetLND().CancelHoldInvoice(ctx, replaced.PayHash); err != nil {
+			return err
+		}
+	}
+
+	var refunded int64
+	err = db.WithTx(ctx, b.GetConn(), func(tx db.Handle) error {
+		err := b.GetVotes().MarkPaid(ctx, tx, vote.ID, settledAmount, settleIndex)
+		if err == db.ErrUnexpectedRowCount {
+			return errAlreadyPaid
+		} else if err != nil {
+			return err
+		}
+
+		if err := ledger.RecordVoteAccepted(ctx, tx, vote.PollID, settledAmount); err != nil {
+			return err
+		}
+
+		if replaced == nil {
+			return nil
+		}
+
+		refunded, err = replaceVote(ctx, b, tx, replaced, vote)
+		return err
+	})
+	if err == errAlreadyPaid {
+		logging.From(ctx).Debug("vote already marked paid", logging.FieldVoteID, vote.ID)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	recordInvoice(invoiceAccepted, settledAmount)
+
+	if refunded > 0 {
+		recordInvoice(invoiceCanceled, refunded)
+	}
+
+	return nil
 }
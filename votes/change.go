@@ -0,0 +1,127 @@
+package votes
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"time"
+
+	"github.com/carlaKC/lightning-poll/db"
+	"github.com/carlaKC/lightning-poll/logging"
+	"github.com/carlaKC/lightning-poll/votes/internal/types"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrInvalidChangeSecret = errors.New("Invalid secret for this vote")
+	ErrVoteNotChangeable   = errors.New("Vote can no longer be changed")
+)
+
+// Change records a vote being moved from one option to another.
+type Change struct {
+	FromOptionID int64
+	ToOptionID   int64
+	ChangedAt    time.Time
+}
+
+// ChangeSecret returns the secret that lets a voter change their vote. Like
+// the vote's preimage it is derived from the preimage seed and the vote's ID,
+// but with a different label so that it reveals nothing about the preimage.
+func ChangeSecret(voteID int64) (string, error) {
+	s, err := seed()
+	if err != nil {
+		return "", err
+	}
+
+	var id [8]byte
+	binary.BigEndian.PutUint64(id[:], uint64(voteID))
+
+	mac := hmac.New(sha256.New, s)
+	mac.Write([]byte("lightning-poll vote change secret"))
+	mac.Write(id[:])
+
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// ChangeOption moves a vote to another option, if the secret provided is the
+// vote's change secret. The vote's invoice is left as it is, so a held payment
+// stays held and counts towards the new option. It must be called in the same
+// transaction as locking the vote's poll, so that the poll cannot close while
+// the vote is changed.
+func ChangeOption(ctx context.Context, b Backends, h db.Handle, voteID, optionID int64,
+	secret string) error {
+
+	vote, err := b.GetVotes().Lookup(ctx, h, voteID)
+	if err != nil {
+		return err
+	}
+
+	expected, err := ChangeSecret(vote.ID)
+	if err != nil {
+		return err
+	}
+
+	if !hmac.Equal([]byte(expected), []byte(secret)) {
+		return ErrInvalidChangeSecret
+	}
+
+	if vote.Status != types.VoteStatusCreated && vote.Status != types.VoteStatusPaid {
+		return ErrVoteNotChangeable
+	}
+
+	if vote.OptionID == optionID {
+		return nil
+	}
+
+	err = b.GetVotes().ChangeOption(ctx, h, vote.ID, vote.OptionID, optionID)
+	if err != nil {
+		return err
+	}
+
+	if err := b.GetVotes().CreateChange(ctx, h, vote.ID, vote.OptionID, optionID); err != nil {
+		return err
+	}
+
+	logging.From(ctx).Info("changed vote", logging.FieldPollID, vote.PollID,
+		logging.FieldVoteID, vote.ID, "from_option_id", vote.OptionID, "option_id", optionID)
+
+	return nil
+}
+
+// ListChanges returns the changes made to a vote, oldest first.
+func ListChanges(ctx context.Context, b Backends, voteID int64) ([]*Change, error) {
+	dbChanges, err := b.GetVotes().ListChanges(ctx, b.GetConn(), voteID)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]*Change, 0, len(dbChanges))
+	for _, c := range dbChanges {
+		changes = append(changes, &Change{
+			FromOptionID: c.FromOptionID,
+			ToOptionID:   c.ToOptionID,
+			ChangedAt:    c.CreatedAt,
+		})
+	}
+
+	return changes, nil
+}
+
+// changedFrom returns true if a vote was ever moved away from the option
+// provided.
+func changedFrom(ctx context.Context, b Backends, voteID, optionID int64) (bool, error) {
+	changes, err := b.GetVotes().ListChanges(ctx, b.GetConn(), voteID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, c := range changes {
+		if c.FromOptionID == optionID {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
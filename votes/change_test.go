@@ -0,0 +1,77 @@
+package votes
+
+import (
+	"context"
+	"encoding/hex"
+	"testing"
+
+	"github.com/carlaKC/lightning-poll/lnd"
+	"github.com/carlaKC/lightning-poll/votes/internal/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangeSecret(t *testing.T) {
+	setPreimageSeed(t, testPreimageSeed)
+
+	secret, err := ChangeSecret(1)
+	require.NoError(t, err)
+
+	other, err := ChangeSecret(2)
+	require.NoError(t, err)
+	assert.NotEqual(t, secret, other)
+
+	// secrets are not the vote's preimage.
+	preimage, err := DerivePreimage(1)
+	require.NoError(t, err)
+	assert.NotEqual(t, hex.EncodeToString(preimage), secret)
+}
+
+func TestChangeOption(t *testing.T) {
+	setPreimageSeed(t, testPreimageSeed)
+	ctx := context.Background()
+	b := &memBackends{
+		votes: NewMemRepository(),
+		lnd:   &lnd.MockLND{Pubkey: "node"},
+	}
+
+	err := b.votes.Create(ctx, nil, 1, 10, 20, 3600, 3600, "lnbc1", "hash", "", nil)
+	require.NoError(t, err)
+	require.NoError(t, b.votes.MarkPaid(ctx, nil, 1, 100, 1))
+
+	receipt, err := IssueReceipt(ctx, b, 1)
+	require.NoError(t, err)
+
+	secret, err := ChangeSecret(1)
+	require.NoError(t, err)
+
+	other, err := ChangeSecret(2)
+	require.NoError(t, err)
+	assert.Equal(t, ErrInvalidChangeSecret, ChangeOption(ctx, b, nil, 1, 21, other))
+
+	require.NoError(t, ChangeOption(ctx, b, nil, 1, 21, secret))
+
+	vote, err := b.votes.Lookup(ctx, nil, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(21), vote.OptionID)
+	assert.Equal(t, types.VoteStatusPaid, vote.Status)
+
+	// changing to the current option is not recorded.
+	require.NoError(t, ChangeOption(ctx, b, nil, 1, 21, secret))
+
+	changes, err := ListChanges(ctx, b, 1)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, int64(20), changes[0].FromOptionID)
+	assert.Equal(t, int64(21), changes[0].ToOptionID)
+
+	// receipts issued before the change are still valid, but report that
+	// the vote was changed.
+	require.NoError(t, VerifyReceipt(ctx, b, receipt))
+	assert.Equal(t, OutcomeChanged, receipt.Outcome)
+
+	// votes cannot be changed once they have been settled.
+	err = b.votes.UpdateStatus(ctx, nil, 1, types.VoteStatusPaid, types.VoteStatusSettled)
+	require.NoError(t, err)
+	assert.Equal(t, ErrVoteNotChangeable, ChangeOption(ctx, b, nil, 1, 20, secret))
+}
@@ -0,0 +1,199 @@
+package votes
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/carlaKC/lightning-poll/db"
+	"github.com/carlaKC/lightning-poll/health"
+	"github.com/carlaKC/lightning-poll/ledger"
+	"github.com/carlaKC/lightning-poll/logging"
+	votes_db "github.com/carlaKC/lightning-poll/votes/internal/db/votes"
+	"github.com/carlaKC/lightning-poll/votes/internal/types"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/pkg/errors"
+)
+
+// blockTime is the expected time between blocks, used to estimate the number
+// of blocks until a poll closes.
+const blockTime = time.Minute * 10
+
+var (
+	// maxVoteCLTV defaults to a week of blocks plus the default buffer, which
+	// leaves senders headroom under the 2016 block limit on a route's total
+	// CLTV that LND enforces by default.
+	maxVoteCLTV = flag.Int64("max_vote_cltv", 1008+144, "Maximum CLTV delta requested "+
+		"for vote invoices, polls closing further in the future cannot receive votes")
+	cltvBufferBlocks = flag.Int64("cltv_buffer_blocks", 144, "Number of blocks that vote "+
+		"HTLCs are required to remain valid for after their poll closes")
+	cltvCancelBlocks = flag.Int64("cltv_cancel_blocks", 40, "Number of blocks before a vote's "+
+		"HTLC expires at which it is refunded to avoid a force close")
+)
+
+var ErrPollTooLong = errors.New("Poll closes too far in the future to hold votes")
+
+// voteCLTV returns the final CLTV delta to require for a vote's hold invoice
+// so that HTLCs paying it do not expire before the poll closes.
+func voteCLTV(closesIn time.Duration) (uint64, error) {
+	blocks := blocksUntil(closesIn) + *cltvBufferBlocks
+	if blocks > *maxVoteCLTV {
+		return 0, ErrPollTooLong
+	}
+
+	return uint64(blocks), nil
+}
+
+// blocksUntil estimates the number of blocks that will be found in a duration,
+// rounding up.
+func blocksUntil(d time.Duration) int64 {
+	if d < 0 {
+		return 0
+	}
+
+	return int64((d + blockTime - 1) / blockTime)
+}
+
+// CheckHorizon returns an error if a poll closing after the duration provided
+// would not be able to hold votes until it closes.
+func CheckHorizon(closesIn time.Duration) error {
+	_, err := voteCLTV(closesIn)
+	return err
+}
+
+func cancelExpiringVotesForever(ctx context.Context, b Backends) {
+	for {
+		if err := cancelExpiringVotes(context.Background(), b); err != nil {
+			logging.From(ctx).Error("cancel expiring votes failed", "error", err)
+		} else {
+			health.Beat(cancelExpiringLoop)
+		}
+
+		if !health.Wait(ctx, cancelExpiringInterval) {
+			return
+		}
+	}
+}
+
+// cancelExpiringVotes refunds any paid votes which have HTLCs that are close
+// to their CLTV expiry. If we continued to hold these HTLCs, our peer would
+// have to force close the channel to claim them back on chain. Votes are also
+// refunded once their HTLCs are expected to expire within the cancel buffer of
+// their poll closing, which happens when blocks are found faster than
+// expected, because they would have to be canceled before they could be
+// settled.
+//
+// A vote which cannot be checked or canceled is logged and skipped, so that
+// it does not stop later votes from being canceled before they expire, and an
+// error counting the failures is returned once every vote has been tried.
+func cancelExpiringVotes(ctx context.Context, b Backends) error {
+	info, err := b.GetLND().GetInfo(ctx)
+	if err != nil {
+		return err
+	}
+	height := int64(info.BlockHeight)
+
+	paid, err := b.GetVotes().ListByStatus(ctx, b.GetConn(), types.VoteStatusPaid)
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	for _, vote := range paid {
+		voteCtx := logging.With(ctx, logging.FieldPollID, vote.PollID,
+			logging.FieldVoteID, vote.ID, logging.FieldPaymentHash, vote.PayHash)
+
+		inv, err := b.GetLND().LookupInvoice(voteCtx, vote.PayHash)
+		if err != nil {
+			logging.From(voteCtx).Error("lookup expiring vote invoice failed", "error", err)
+			failed++
+			continue
+		}
+
+		expiry, ok := earliestExpiry(inv)
+		if !ok {
+			continue
+		}
+
+		reason, expiring := expiringReason(height, expiry, vote.ClosesAt)
+		if !expiring {
+			continue
+		}
+
+		if err := cancelVote(voteCtx, b, vote, reason); err != nil {
+			logging.From(voteCtx).Error("cancel expiring vote failed", "reason", reason,
+				"error", err)
+			failed++
+			continue
+		}
+		logging.From(voteCtx).Info("canceled expiring vote", "reason", reason)
+	}
+
+	if failed > 0 {
+		return errors.Errorf("%v of %v paid votes could not be checked or canceled",
+			failed, len(paid))
+	}
+
+	return nil
+}
+
+// expiringReason returns the reason to cancel a vote whose earliest HTLC
+// expires at the height provided, and false if the HTLC can be held until the
+// vote's poll closes with the cancel buffer to spare.
+func expiringReason(height, expiry int64, closesAt time.Time) (string, bool) {
+	if expiry-height <= *cltvCancelBlocks {
+		return fmt.Sprintf("htlc expires at height %v, canceled at height %v",
+			expiry, height), true
+	}
+
+	closeHeight := height + blocksUntil(time.Until(closesAt))
+	if expiry-closeHeight <= *cltvCancelBlocks {
+		return fmt.Sprintf("htlc expires at height %v, before poll closes at about "+
+			"height %v, canceled at height %v", expiry, closeHeight, height), true
+	}
+
+	return "", false
+}
+
+// earliestExpiry returns the lowest expiry height of the HTLCs held for an
+// invoice, and false if it has no held HTLCs.
+func earliestExpiry(inv *lnrpc.Invoice) (int64, bool) {
+	var (
+		expiry int64
+		found  bool
+	)
+	for _, htlc := range inv.Htlcs {
+		if htlc.State != lnrpc.InvoiceHTLCState_ACCEPTED {
+			continue
+		}
+
+		if !found || int64(htlc.ExpiryHeight) < expiry {
+			expiry = int64(htlc.ExpiryHeight)
+			found = true
+		}
+	}
+
+	return expiry, found
+}
+
+// cancelVote refunds a paid vote before its poll has closed.
+func cancelVote(ctx context.Context, b Backends, vote *votes_db.DBVote, reason string) error {
+	if err := b.GetLND().CancelHoldInvoice(ctx, vote.PayHash); err != nil {
+		return err
+	}
+
+	err := db.WithTx(ctx, b.GetConn(), func(tx db.Handle) error {
+		if err := b.GetVotes().Cancel(ctx, tx, vote.ID, reason); err != nil {
+			return err
+		}
+
+		return ledger.RecordVoteCanceled(ctx, tx, vote.PollID, vote.SettleAmount)
+	})
+	if err != nil {
+		return err
+	}
+	recordInvoice(invoiceCanceled, vote.SettleAmount)
+
+	return nil
+}
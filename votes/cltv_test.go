@@ -0,0 +1,92 @@
+package votes
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/carlaKC/lightning-poll/lnd"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVoteCLTV(t *testing.T) {
+	// polls that have already closed only require the buffer
+	cltv, err := voteCLTV(time.Hour * -1)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(*cltvBufferBlocks), cltv)
+
+	// partial blocks are rounded up
+	cltv, err = voteCLTV(time.Minute * 11)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2+*cltvBufferBlocks), cltv)
+
+	// polls closing beyond the horizon are refused
+	_, err = voteCLTV(blockTime * time.Duration(*maxVoteCLTV))
+	assert.Equal(t, ErrPollTooLong, err)
+}
+
+func TestEarliestExpiry(t *testing.T) {
+	_, ok := earliestExpiry(&lnrpc.Invoice{})
+	assert.False(t, ok)
+
+	expiry, ok := earliestExpiry(&lnrpc.Invoice{
+		Htlcs: []*lnrpc.InvoiceHTLC{
+			{ExpiryHeight: 200, State: lnrpc.InvoiceHTLCState_ACCEPTED},
+			{ExpiryHeight: 100, State: lnrpc.InvoiceHTLCState_CANCELED},
+			{ExpiryHeight: 150, State: lnrpc.InvoiceHTLCState_ACCEPTED},
+		},
+	})
+	assert.True(t, ok)
+	assert.Equal(t, int64(150), expiry)
+}
+
+func TestPaymentExpiry(t *testing.T) {
+	window := int64(*paymentWindow / time.Second)
+
+	// invoices expire at the end of the payment window
+	assert.Equal(t, window, paymentExpiry(window*10))
+
+	// but not after the poll closes
+	assert.Equal(t, window-1, paymentExpiry(window-1))
+}
+
+func TestExpiringReason(t *testing.T) {
+	closesAt := time.Now().Add(blockTime * 10)
+
+	// htlcs which outlast the poll's close by more than the cancel buffer
+	// are held.
+	_, expiring := expiringReason(100, 111+*cltvCancelBlocks, closesAt)
+	assert.False(t, expiring)
+
+	// htlcs which would expire within the buffer of the poll closing are
+	// canceled, even if they are not close to expiring yet.
+	reason, expiring := expiringReason(100, 110+*cltvCancelBlocks, closesAt)
+	assert.True(t, expiring)
+	assert.Contains(t, reason, "before poll closes")
+
+	// once the poll has closed, htlcs are canceled close to their expiry.
+	_, expiring = expiringReason(100, 101+*cltvCancelBlocks, time.Now().Add(-time.Hour))
+	assert.False(t, expiring)
+
+	_, expiring = expiringReason(100, 100+*cltvCancelBlocks, time.Now().Add(-time.Hour))
+	assert.True(t, expiring)
+}
+
+func TestCancelExpiringVotesContinues(t *testing.T) {
+	ctx := context.Background()
+	b := &memBackends{votes: NewMemRepository(), lnd: &lnd.MockLND{BlockHeight: 100}}
+
+	// neither vote's invoice can be found, and both are tried.
+	for id := int64(1); id <= 2; id++ {
+		err := b.votes.Create(ctx, nil, id, 1, 2, 60, 60, "lnbc1", fmt.Sprint(id), "", nil)
+		require.NoError(t, err)
+		require.NoError(t, b.votes.MarkPaid(ctx, nil, id, 100, uint64(id)))
+	}
+
+	err := cancelExpiringVotes(ctx, b)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "2 of 2")
+}
@@ -0,0 +1,126 @@
+package votes
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/carlaKC/lightning-poll/db"
+	"github.com/carlaKC/lightning-poll/ledger"
+	"github.com/carlaKC/lightning-poll/logging"
+	votes_db "github.com/carlaKC/lightning-poll/votes/internal/db/votes"
+	"github.com/carlaKC/lightning-poll/votes/internal/types"
+	"github.com/pkg/errors"
+)
+
+var ErrIdentityRequired = errors.New("Please log in to vote in this poll")
+
+// cancelReasonChanged is recorded for paid votes which are refunded because
+// their voter changed their vote.
+const cancelReasonChanged = "voter changed their vote"
+
+// CreateForIdentity creates a vote in a poll which allows one vote per
+// identity, which needs an invoice added by AddInvoice like votes made by
+// Create. If the identity already has an open vote in the poll, the new vote
+// replaces it once it is paid, when markInvoicePaid cancels the old vote's
+// hold invoice, so that a voter who does not pay for their new vote keeps
+// their old one. It must be called in the same transaction as locking the
+// poll, so that an identity cannot create two votes at once.
+func CreateForIdentity(ctx context.Context, b Backends, h db.Handle, pollID, optionID,
+	expiry int64, identity string) (int64, error) {
+
+	if identity == "" {
+		return 0, ErrIdentityRequired
+	}
+
+	vote, err := b.GetVotes().LookupByIdentity(ctx, h, pollID, identity)
+	switch {
+	case err == sql.ErrNoRows:
+
+	case err != nil:
+		return 0, err
+
+	// the new vote is linked to the identity by its voter key, and claims
+	// the identity when it replaces the open vote.
+	case vote.Status == types.VoteStatusCreated || vote.Status == types.VoteStatusPaid:
+		return Create(ctx, b, h, pollID, optionID, expiry, identity)
+
+	// votes which are no longer open release their identity, so that it can
+	// vote again.
+	default:
+		if err := b.GetVotes().ReleaseIdentity(ctx, h, vote.ID); err != nil {
+			return 0, err
+		}
+
+		logging.From(ctx).Info("released identity", logging.FieldVoteID, vote.ID,
+			"status", vote.Status)
+	}
+
+	id, err := Create(ctx, b, h, pollID, optionID, expiry, identity)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, b.GetVotes().ClaimIdentity(ctx, h, id, identity)
+}
+
+// replacedVote returns the vote that a vote which has just been paid replaces,
+// which is the current vote of its voter's identity if the vote was created
+// by CreateForIdentity without claiming the identity. It returns nil for
+// votes which do not replace another vote.
+func replacedVote(ctx context.Context, b Backends, vote *votes_db.DBVote) (*votes_db.DBVote, error) {
+	if vote.Identity != "" || vote.VoterKey == "" {
+		return nil, nil
+	}
+
+	current, err := b.GetVotes().LookupByIdentity(ctx, b.GetConn(), vote.PollID, vote.VoterKey)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return current, nil
+}
+
+// replaceVote moves an identity from the vote it replaces to a vote which has
+// just been paid, canceling the replaced vote if it is still open and
+// refunding it if it was paid. The replaced vote's invoice must already have
+// been canceled, so that a failed transaction leaves a discrepancy for
+// reconciliation rather than a vote that can still be paid. It returns the
+// amount refunded.
+func replaceVote(ctx context.Context, b Backends, h db.Handle, replaced,
+	vote *votes_db.DBVote) (int64, error) {
+
+	var refunded int64
+	switch replaced.Status {
+	case types.VoteStatusCreated:
+		if err := b.GetVotes().UpdateStatus(ctx, h, replaced.ID, types.VoteStatusCreated,
+			types.VoteStatusExpired); err != nil {
+			return 0, err
+		}
+
+	case types.VoteStatusPaid:
+		if err := b.GetVotes().Cancel(ctx, h, replaced.ID, cancelReasonChanged); err != nil {
+			return 0, err
+		}
+
+		err := ledger.RecordVoteCanceled(ctx, h, replaced.PollID, replaced.SettleAmount)
+		if err != nil {
+			return 0, err
+		}
+		refunded = replaced.SettleAmount
+	}
+
+	if err := b.GetVotes().ReleaseIdentity(ctx, h, replaced.ID); err != nil {
+		return 0, err
+	}
+
+	if err := b.GetVotes().ClaimIdentity(ctx, h, vote.ID, vote.VoterKey); err != nil {
+		return 0, err
+	}
+
+	logging.From(ctx).Info("replaced vote", logging.FieldVoteID, vote.ID,
+		"replaced_vote_id", replaced.ID, "status", replaced.Status)
+
+	return refunded, nil
+}
@@ -0,0 +1,84 @@
+package votes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/carlaKC/lightning-poll/lnd"
+	"github.com/carlaKC/lightning-poll/votes/internal/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateForIdentity(t *testing.T) {
+	setPreimageSeed(t, testPreimageSeed)
+	ctx := context.Background()
+	b := &memBackends{votes: NewMemRepository(), lnd: &lnd.MockLND{}}
+
+	_, err := CreateForIdentity(ctx, b, nil, 1, 2, 60, "")
+	assert.Equal(t, ErrIdentityRequired, err)
+
+	first, err := CreateForIdentity(ctx, b, nil, 1, 2, 60, "voter")
+	require.NoError(t, err)
+
+	// voting again creates a replacement, which leaves the identity's open
+	// vote alone until it is paid.
+	second, err := CreateForIdentity(ctx, b, nil, 1, 3, 60, "voter")
+	require.NoError(t, err)
+	assert.NotEqual(t, first, second)
+	assert.Empty(t, b.lnd.Canceled)
+
+	vote, err := b.votes.LookupByIdentity(ctx, nil, 1, "voter")
+	require.NoError(t, err)
+	assert.Equal(t, first, vote.ID)
+
+	replacement, err := b.votes.Lookup(ctx, nil, second)
+	require.NoError(t, err)
+	assert.Empty(t, replacement.Identity)
+
+	replaced, err := replacedVote(ctx, b, replacement)
+	require.NoError(t, err)
+	require.NotNil(t, replaced)
+	assert.Equal(t, first, replaced.ID)
+
+	// the identity's current vote does not replace itself.
+	replaced, err = replacedVote(ctx, b, vote)
+	require.NoError(t, err)
+	assert.Nil(t, replaced)
+
+	// once the replacement is paid, the open vote is canceled and the
+	// replacement becomes the identity's vote.
+	refunded, err := replaceVote(ctx, b, nil, vote, replacement)
+	require.NoError(t, err)
+	assert.Zero(t, refunded)
+
+	old, err := b.votes.Lookup(ctx, nil, first)
+	require.NoError(t, err)
+	assert.Equal(t, types.VoteStatusExpired, old.Status)
+	assert.Empty(t, old.Identity)
+
+	vote, err = b.votes.LookupByIdentity(ctx, nil, 1, "voter")
+	require.NoError(t, err)
+	assert.Equal(t, second, vote.ID)
+	assert.Equal(t, int64(3), vote.OptionID)
+
+	// once the vote is no longer open, the identity can vote again straight
+	// away.
+	require.NoError(t, b.votes.MarkPaid(ctx, nil, second, 60, 1))
+	require.NoError(t, b.votes.Cancel(ctx, nil, second, "test"))
+
+	third, err := CreateForIdentity(ctx, b, nil, 1, 2, 60, "voter")
+	require.NoError(t, err)
+
+	vote, err = b.votes.LookupByIdentity(ctx, nil, 1, "voter")
+	require.NoError(t, err)
+	assert.Equal(t, third, vote.ID)
+
+	// the identity's vote in another poll is separate.
+	other, err := CreateForIdentity(ctx, b, nil, 4, 2, 60, "voter")
+	require.NoError(t, err)
+
+	vote, err = b.votes.LookupByIdentity(ctx, nil, 4, "voter")
+	require.NoError(t, err)
+	assert.Equal(t, other, vote.ID)
+}
@@ -0,0 +1,64 @@
+package changes
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/carlaKC/lightning-poll/db"
+)
+
+var cols = "id, vote_id, created_at, from_option_id, to_option_id"
+
+type row interface {
+	Scan(dest ...interface{}) error
+}
+
+// Create records that a vote was moved from one option to another.
+func Create(ctx context.Context, dbc db.Handle, voteID, fromOption, toOption int64) error {
+	r, err := dbc.ExecContext(ctx, "insert into vote_changes (id, vote_id, created_at, "+
+		"from_option_id, to_option_id) values (?, ?, now(), ?, ?)", rand.Int63(), voteID,
+		fromOption, toOption)
+	if err != nil {
+		return err
+	}
+
+	return db.CheckRowsAffected(r, 1)
+}
+
+type DBChange struct {
+	ID           int64
+	VoteID       int64
+	CreatedAt    time.Time
+	FromOptionID int64
+	ToOptionID   int64
+}
+
+func scan(r row) (change DBChange, err error) {
+	err = r.Scan(&change.ID, &change.VoteID, &change.CreatedAt, &change.FromOptionID,
+		&change.ToOptionID)
+	return change, err
+}
+
+func list(ctx context.Context, dbc db.Handle, query string, args ...interface{}) (changes []*DBChange, err error) {
+	rows, err := dbc.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		change, err := scan(rows)
+		if err != nil {
+			return changes, err
+		}
+		changes = append(changes, &change)
+	}
+
+	return changes, rows.Err()
+}
+
+// ListByVote returns the changes made to a vote, oldest first.
+func ListByVote(ctx context.Context, dbc db.Handle, voteID int64) ([]*DBChange, error) {
+	return list(ctx, dbc, "select "+cols+" from vote_changes where vote_id=? "+
+		"order by created_at", voteID)
+}
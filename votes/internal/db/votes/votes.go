@@ -5,29 +5,46 @@ import (
 	"database/sql"
 	"github.com/carlaKC/lightning-poll/db"
 	"github.com/carlaKC/lightning-poll/votes/internal/types"
-	"math/rand"
 	"time"
 )
 
-var cols = "id, created_at, expires_at, poll_id, option_id, pay_req, payment_hash, preimage, settle_index, settle_amount, status"
+var cols = "id, created_at, expires_at, closes_at, poll_id, option_id, pay_req, payment_hash, preimage, settle_index, settle_amount, status, cancel_reason, voter_key, identity"
 
 type row interface {
 	Scan(dest ...interface{}) error
 }
 
-func Create(ctx context.Context, dbc *sql.DB, pollID, optionID, expirySeconds int64, payReq, payHash string, preimage []byte) (int64, error) {
-	id := rand.Int63()
-	expiresAt := time.Now().Add(time.Second * time.Duration(expirySeconds) * -1)
+// Create adds a vote with the ID provided, which is chosen by the caller so
+// that the vote's preimage can be derived from it. Votes with derived
+// preimages store an empty preimage. The voter key is the linking key of the
+// voter, which is empty if they were not logged in. The vote expires
+// expirySeconds after it is created, and its poll closes closesInSeconds after
+// it is created.
+func Create(ctx context.Context, dbc db.Handle, id, pollID, optionID, expirySeconds, closesInSeconds int64, payReq, payHash, voterKey string, preimage []byte) error {
+	now := time.Now()
+	expiresAt := now.Add(time.Duration(expirySeconds) * time.Second)
+	closesAt := now.Add(time.Duration(closesInSeconds) * time.Second)
+	nullKey := sql.NullString{String: voterKey, Valid: voterKey != ""}
 
-	r, err := dbc.ExecContext(ctx, "insert into votes set id=?, "+
-		"created_at=now(),expires_at=?, poll_id=?, option_id=?, pay_req=?,"+
-		"payment_hash=?, preimage=?, status=?", id,
-		expiresAt, pollID, optionID, payReq, payHash, preimage, types.VoteStatusCreated)
+	r, err := dbc.ExecContext(ctx, "insert into votes (id, created_at, "+
+		"expires_at, closes_at, poll_id, option_id, pay_req, payment_hash, preimage, status, "+
+		"voter_key) values (?, now(), ?, ?, ?, ?, ?, ?, ?, ?, ?)", id,
+		expiresAt, closesAt, pollID, optionID, payReq, payHash, nonNil(preimage),
+		types.VoteStatusCreated, nullKey)
 	if err != nil {
-		return 0, err
+		return err
 	}
 
-	return id, db.CheckRowsAffected(r, 1)
+	return db.CheckRowsAffected(r, 1)
+}
+
+// nonNil returns an empty preimage rather than nil, which would be stored as
+// null.
+func nonNil(preimage []byte) []byte {
+	if preimage == nil {
+		return []byte{}
+	}
+	return preimage
 }
 
 type DBVote struct {
@@ -42,16 +59,40 @@ type DBVote struct {
 	SettleIndex  int64
 	SettleAmount int64
 	Status       types.VoteStatus
+	CancelReason string
+	VoterKey     string
+
+	// Identity is the voter's key in polls that allow one vote per identity.
+	// It is only set on the voter's current vote, and is unique per poll.
+	Identity string
+
+	// ClosesAt is when the vote's poll closes, which its HTLCs must remain
+	// valid until.
+	ClosesAt time.Time
 }
 
 func scan(r row) (vote DBVote, err error) {
 	var settleIndex, settleAmount sql.NullInt64
-	err = r.Scan(&vote.ID, &vote.CreatedAt, &vote.ExpiresAt, &vote.PollID, &vote.OptionID,
-		&vote.PayReq, &vote.PayHash, &vote.Preimage, &settleIndex, &settleAmount, &vote.Status)
+	var cancelReason, voterKey, identity sql.NullString
+	err = r.Scan(&vote.ID, &vote.CreatedAt, &vote.ExpiresAt, &vote.ClosesAt, &vote.PollID, &vote.OptionID,
+		&vote.PayReq, &vote.PayHash, &vote.Preimage, &settleIndex, &settleAmount, &vote.Status,
+		&cancelReason, &voterKey, &identity)
 	if err != nil {
 		return vote, err
 	}
 
+	if cancelReason.Valid {
+		vote.CancelReason = cancelReason.String
+	}
+
+	if voterKey.Valid {
+		vote.VoterKey = voterKey.String
+	}
+
+	if identity.Valid {
+		vote.Identity = identity.String
+	}
+
 	if settleIndex.Valid {
 		vote.SettleIndex = settleIndex.Int64
 	}
@@ -62,7 +103,7 @@ func scan(r row) (vote DBVote, err error) {
 	return vote, nil
 }
 
-func list(ctx context.Context, dbc *sql.DB, query string, args ...interface{}) (votes []*DBVote, err error) {
+func list(ctx context.Context, dbc db.Handle, query string, args ...interface{}) (votes []*DBVote, err error) {
 	rows, err := dbc.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
@@ -79,11 +120,45 @@ func list(ctx context.Context, dbc *sql.DB, query string, args ...interface{}) (
 	return votes, rows.Err()
 }
 
-func ListByPollAndStatus(ctx context.Context, dbc *sql.DB, pollID int64, status types.VoteStatus) ([]*DBVote, error) {
+func ListByPollAndStatus(ctx context.Context, dbc db.Handle, pollID int64, status types.VoteStatus) ([]*DBVote, error) {
 	return list(ctx, dbc, "select "+cols+" from votes where poll_id=? and status=?", pollID, status)
 }
 
-func UpdateStatus(ctx context.Context, dbc *sql.DB, id int64, fromStatus, toStatus types.VoteStatus) error {
+func ListByStatus(ctx context.Context, dbc db.Handle, status types.VoteStatus) ([]*DBVote, error) {
+	return list(ctx, dbc, "select "+cols+" from votes where status=?", status)
+}
+
+// ListByVoter returns the votes made by the linking key provided.
+func ListByVoter(ctx context.Context, dbc db.Handle, voterKey string) ([]*DBVote, error) {
+	return list(ctx, dbc, "select "+cols+" from votes where voter_key=?", voterKey)
+}
+
+// ClaimIdentity makes a vote the current vote of an identity in its poll.
+// Identities are unique per poll, so this fails if the identity already has a
+// vote in the poll.
+func ClaimIdentity(ctx context.Context, dbc db.Handle, id int64, identity string) error {
+	r, err := dbc.ExecContext(ctx, "update votes set identity=? where id=? and "+
+		"identity is null", identity, id)
+	if err != nil {
+		return err
+	}
+
+	return db.CheckRowsAffected(r, 1)
+}
+
+// ReleaseIdentity removes the identity from a vote, so that the identity can
+// vote again in the poll.
+func ReleaseIdentity(ctx context.Context, dbc db.Handle, id int64) error {
+	r, err := dbc.ExecContext(ctx, "update votes set identity=null where id=? and "+
+		"identity is not null", id)
+	if err != nil {
+		return err
+	}
+
+	return db.CheckRowsAffected(r, 1)
+}
+
+func UpdateStatus(ctx context.Context, dbc db.Handle, id int64, fromStatus, toStatus types.VoteStatus) error {
 	r, err := dbc.ExecContext(ctx, "update votes set status=? where status=? and "+
 		"id=?", toStatus, fromStatus, id)
 	if err != nil {
@@ -93,9 +168,37 @@ func UpdateStatus(ctx context.Context, dbc *sql.DB, id int64, fromStatus, toStat
 	return db.CheckRowsAffected(r, 1)
 }
 
-func MarkPaid(ctx context.Context, dbc *sql.DB, id, settleAmount int64, settleIndex uint64) error {
+// ChangeOption moves an open vote to another option, if it has not been
+// changed since it was read.
+func ChangeOption(ctx context.Context, dbc db.Handle, id, fromOption, toOption int64) error {
+	r, err := dbc.ExecContext(ctx, "update votes set option_id=? where id=? and "+
+		"option_id=? and status in (?, ?)", toOption, id, fromOption, types.VoteStatusCreated,
+		types.VoteStatusPaid)
+	if err != nil {
+		return err
+	}
+
+	return db.CheckRowsAffected(r, 1)
+}
+
+// Cancel marks a paid vote as canceled, recording the reason that it was
+// refunded before its poll closed.
+func Cancel(ctx context.Context, dbc db.Handle, id int64, reason string) error {
+	r, err := dbc.ExecContext(ctx, "update votes set status=?, cancel_reason=? where "+
+		"id=? and status=?", types.VoteStatusCanceled, reason, id, types.VoteStatusPaid)
+	if err != nil {
+		return err
+	}
+
+	return db.CheckRowsAffected(r, 1)
+}
+
+// MarkPaid marks a created vote as paid, so that a vote is only marked paid
+// once and votes which have moved on are not moved back to paid.
+func MarkPaid(ctx context.Context, dbc db.Handle, id, settleAmount int64, settleIndex uint64) error {
 	r, err := dbc.ExecContext(ctx, "update votes set status=?, settle_index=?, "+
-		"settle_amount=? where id=?", types.VoteStatusPaid, settleIndex, settleAmount, id)
+		"settle_amount=? where id=? and status=?", types.VoteStatusPaid, settleIndex,
+		settleAmount, id, types.VoteStatusCreated)
 	if err != nil {
 		return err
 	}
@@ -103,13 +206,44 @@ func MarkPaid(ctx context.Context, dbc *sql.DB, id, settleAmount int64, settleIn
 	return db.CheckRowsAffected(r, 1)
 }
 
+// CountByStatus returns the number of votes in each status.
+func CountByStatus(ctx context.Context, dbc db.Handle) (map[types.VoteStatus]int64, error) {
+	rows, err := dbc.QueryContext(ctx, "select status, count(*) from votes group by status")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[types.VoteStatus]int64)
+	for rows.Next() {
+		var (
+			status types.VoteStatus
+			count  int64
+		)
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, err
+		}
+		counts[status] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// CountByPollAndStatus returns the number of votes for a poll in a status.
+func CountByPollAndStatus(ctx context.Context, dbc db.Handle, pollID int64, status types.VoteStatus) (int64, error) {
+	var count int64
+	err := dbc.QueryRowContext(ctx, "select count(*) from votes where poll_id=? "+
+		"and status=?", pollID, status).Scan(&count)
+	return count, err
+}
+
 // ListExpired returns a list of created votes which have expired
-func ListExpired(ctx context.Context, dbc *sql.DB) ([]*DBVote, error) {
-	return list(ctx, dbc, "select * from votes where expires_at<now() "+
+func ListExpired(ctx context.Context, dbc db.Handle) ([]*DBVote, error) {
+	return list(ctx, dbc, "select "+cols+" from votes where expires_at<now() "+
 		"and status=?", types.VoteStatusCreated)
 }
 
-func Lookup(ctx context.Context, dbc *sql.DB, id int64) (*DBVote, error) {
+func Lookup(ctx context.Context, dbc db.Handle, id int64) (*DBVote, error) {
 	row := dbc.QueryRowContext(ctx, "select "+cols+" from votes where id=?", id)
 	vote, err := scan(row)
 	if err != nil {
@@ -118,7 +252,7 @@ func Lookup(ctx context.Context, dbc *sql.DB, id int64) (*DBVote, error) {
 	return &vote, nil
 }
 
-func LookupByHash(ctx context.Context, dbc *sql.DB, paymentHash string) (*DBVote, error) {
+func LookupByHash(ctx context.Context, dbc db.Handle, paymentHash string) (*DBVote, error) {
 	row := dbc.QueryRowContext(ctx, "select "+cols+" from votes where payment_hash=?", paymentHash)
 	vote, err := scan(row)
 	if err != nil {
@@ -127,7 +261,49 @@ func LookupByHash(ctx context.Context, dbc *sql.DB, paymentHash string) (*DBVote
 	return &vote, nil
 }
 
-func GetLatestSettleIndex(ctx context.Context, dbc *sql.DB) (int64, error) {
+// LookupByIdentity returns the current vote of an identity in a poll.
+func LookupByIdentity(ctx context.Context, dbc db.Handle, pollID int64, identity string) (*DBVote, error) {
+	row := dbc.QueryRowContext(ctx, "select "+cols+" from votes where poll_id=? and "+
+		"identity=?", pollID, identity)
+	vote, err := scan(row)
+	if err != nil {
+		return nil, err
+	}
+
+	return &vote, nil
+}
+
+// ListPlaintextPreimages returns votes with preimages which have not been
+// encrypted, which are stored as the raw 32 byte preimage.
+func ListPlaintextPreimages(ctx context.Context, dbc db.Handle) ([]*DBVote, error) {
+	return list(ctx, dbc, "select "+cols+" from votes where length(preimage)=32")
+}
+
+// UpdatePreimage replaces a vote's stored preimage, if it has not changed
+// since it was read.
+func UpdatePreimage(ctx context.Context, dbc db.Handle, id int64, from, to []byte) error {
+	r, err := dbc.ExecContext(ctx, "update votes set preimage=? where id=? and "+
+		"preimage=?", to, id, from)
+	if err != nil {
+		return err
+	}
+
+	return db.CheckRowsAffected(r, 1)
+}
+
+// SetPayReq sets the payment request of a vote which was created before its
+// invoice.
+func SetPayReq(ctx context.Context, dbc db.Handle, id int64, payReq string) error {
+	r, err := dbc.ExecContext(ctx, "update votes set pay_req=? where id=? and pay_req=''",
+		payReq, id)
+	if err != nil {
+		return err
+	}
+
+	return db.CheckRowsAffected(r, 1)
+}
+
+func GetLatestSettleIndex(ctx context.Context, dbc db.Handle) (int64, error) {
 	row := dbc.QueryRowContext(ctx, "select coalesce(max(settle_index), 0)"+
 		" from votes")
 
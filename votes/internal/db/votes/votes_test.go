@@ -2,10 +2,10 @@ package votes_test
 
 import (
 	"context"
-	"database/sql"
 	"github.com/carlaKC/lightning-poll/db"
 	"github.com/carlaKC/lightning-poll/votes/internal/db/votes"
 	"github.com/carlaKC/lightning-poll/votes/internal/types"
+	"math/rand"
 	"testing"
 	"time"
 
@@ -20,23 +20,23 @@ var (
 	testPreimage = []byte{}
 )
 
-func setup(t *testing.T) (context.Context, *sql.DB) {
+func setup(t *testing.T) (context.Context, db.Conn) {
 	return context.Background(), db.ConnectForTesting(t)
 }
 
 func TestCreate(t *testing.T) {
 	ctx, dbc := setup(t)
 
-	_, err := votes.Create(ctx, dbc, testPollID, testOptionID, 10, testInvoice, testPayHash, testPreimage)
+	err := votes.Create(ctx, dbc, rand.Int63(), testPollID, testOptionID, 10, 10, testInvoice, testPayHash, "", testPreimage)
 	assert.NoError(t, err)
 }
 
 func TestListByPollAndStatus(t *testing.T) {
 	ctx, dbc := setup(t)
 
-	_, err := votes.Create(ctx, dbc, testPollID, testOptionID, 10, testInvoice, testPayHash, testPreimage)
+	err := votes.Create(ctx, dbc, rand.Int63(), testPollID, testOptionID, 10, 10, testInvoice, testPayHash, "", testPreimage)
 	assert.NoError(t, err)
-	_, err = votes.Create(ctx, dbc, testPollID, testOptionID, 10, testInvoice, testPayHash, testPreimage)
+	err = votes.Create(ctx, dbc, rand.Int63(), testPollID, testOptionID, 10, 10, testInvoice, testPayHash, "", testPreimage)
 	assert.NoError(t, err)
 
 	vList, err := votes.ListByPollAndStatus(ctx, dbc, testPollID, types.VoteStatusCreated)
@@ -48,10 +48,33 @@ func TestListByPollAndStatus(t *testing.T) {
 	assert.Len(t, vList, 0)
 }
 
+func TestListByStatus(t *testing.T) {
+	ctx, dbc := setup(t)
+
+	id := rand.Int63()
+	err := votes.Create(ctx, dbc, id, testPollID, testOptionID, 10, 10, testInvoice, testPayHash, "", testPreimage)
+	assert.NoError(t, err)
+	err = votes.Create(ctx, dbc, rand.Int63(), testPollID, testOptionID, 10, 10, testInvoice, testPayHash, "", testPreimage)
+	assert.NoError(t, err)
+
+	err = votes.UpdateStatus(ctx, dbc, id, types.VoteStatusCreated, types.VoteStatusPaid)
+	assert.NoError(t, err)
+
+	vList, err := votes.ListByStatus(ctx, dbc, types.VoteStatusCreated)
+	assert.NoError(t, err)
+	assert.Len(t, vList, 1)
+
+	vList, err = votes.ListByStatus(ctx, dbc, types.VoteStatusPaid)
+	assert.NoError(t, err)
+	assert.Len(t, vList, 1)
+	assert.Equal(t, id, vList[0].ID)
+}
+
 func TestUpdateStatus(t *testing.T) {
 	ctx, dbc := setup(t)
 
-	id, err := votes.Create(ctx, dbc, testPollID, testOptionID, 10, testInvoice, testPayHash, testPreimage)
+	id := rand.Int63()
+	err := votes.Create(ctx, dbc, id, testPollID, testOptionID, 10, 10, testInvoice, testPayHash, "", testPreimage)
 	assert.NoError(t, err)
 
 	err = votes.UpdateStatus(ctx, dbc, id, types.VoteStatusCreated, types.VoteStatusExpired)
@@ -62,10 +85,34 @@ func TestUpdateStatus(t *testing.T) {
 
 }
 
+func TestCancel(t *testing.T) {
+	ctx, dbc := setup(t)
+
+	id := rand.Int63()
+	err := votes.Create(ctx, dbc, id, testPollID, testOptionID, 10, 10, testInvoice, testPayHash, "", testPreimage)
+	assert.NoError(t, err)
+
+	// only paid votes can be canceled
+	err = votes.Cancel(ctx, dbc, id, "test reason")
+	assert.Equal(t, db.ErrUnexpectedRowCount, err)
+
+	err = votes.MarkPaid(ctx, dbc, id, 1, 4)
+	assert.NoError(t, err)
+
+	err = votes.Cancel(ctx, dbc, id, "test reason")
+	assert.NoError(t, err)
+
+	vote, err := votes.Lookup(ctx, dbc, id)
+	assert.NoError(t, err)
+	assert.Equal(t, types.VoteStatusCanceled, vote.Status)
+	assert.Equal(t, "test reason", vote.CancelReason)
+}
+
 func TestMarkPaid(t *testing.T) {
 	ctx, dbc := setup(t)
 
-	id, err := votes.Create(ctx, dbc, testPollID, testOptionID, 10, testInvoice, testPayHash, testPreimage)
+	id := rand.Int63()
+	err := votes.Create(ctx, dbc, id, testPollID, testOptionID, 10, 10, testInvoice, testPayHash, "", testPreimage)
 	assert.NoError(t, err)
 
 	err = votes.MarkPaid(ctx, dbc, id, 1, 4)
@@ -82,8 +129,19 @@ func TestListExpired(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Len(t, expired, 0)
 
-	id, err := votes.Create(ctx, dbc, testPollID, testOptionID, 10, testInvoice, testPayHash, testPreimage)
+	id := rand.Int63()
+	err = votes.Create(ctx, dbc, id, testPollID, testOptionID, 10, 10, testInvoice, testPayHash, "", testPreimage)
+	assert.NoError(t, err)
+
+	// newly created votes have not expired yet.
+	expired, err = votes.ListExpired(ctx, dbc)
+	assert.NoError(t, err)
+	assert.Len(t, expired, 0)
+
+	vote, err := votes.Lookup(ctx, dbc, id)
 	assert.NoError(t, err)
+	assert.True(t, vote.ExpiresAt.After(time.Now()))
+
 	r, err := dbc.ExecContext(ctx, "update votes set expires_at=? where id=?", time.Now().Add(time.Hour*-1), id)
 	assert.NoError(t, err)
 	assert.NoError(t, db.CheckRowsAffected(r, 1))
@@ -100,7 +158,8 @@ func TestGetLatestSettleIndex(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, int64(0), index)
 
-	id, err := votes.Create(ctx, dbc, testPollID, testOptionID, 10, testInvoice, testPayHash, testPreimage)
+	id := rand.Int63()
+	err = votes.Create(ctx, dbc, id, testPollID, testOptionID, 10, 10, testInvoice, testPayHash, "", testPreimage)
 	assert.NoError(t, err)
 	err = votes.MarkPaid(ctx, dbc, id, 1, 4)
 	assert.NoError(t, err)
@@ -109,3 +168,40 @@ func TestGetLatestSettleIndex(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, int64(4), index)
 }
+
+func TestCountByStatus(t *testing.T) {
+	ctx, dbc := setup(t)
+
+	id := rand.Int63()
+	err := votes.Create(ctx, dbc, id, testPollID, testOptionID, 10, 10, testInvoice, testPayHash, "", testPreimage)
+	assert.NoError(t, err)
+	err = votes.Create(ctx, dbc, rand.Int63(), testPollID, testOptionID, 10, 10, testInvoice, testPayHash, "", testPreimage)
+	assert.NoError(t, err)
+	err = votes.MarkPaid(ctx, dbc, id, 1, 4)
+	assert.NoError(t, err)
+
+	counts, err := votes.CountByStatus(ctx, dbc)
+	assert.NoError(t, err)
+	assert.Equal(t, map[types.VoteStatus]int64{
+		types.VoteStatusCreated: 1,
+		types.VoteStatusPaid:    1,
+	}, counts)
+}
+
+func TestCountByPollAndStatus(t *testing.T) {
+	ctx, dbc := setup(t)
+
+	id := rand.Int63()
+	err := votes.Create(ctx, dbc, id, testPollID, testOptionID, 10, 10, testInvoice, testPayHash, "", testPreimage)
+	assert.NoError(t, err)
+	err = votes.Create(ctx, dbc, rand.Int63(), testPollID, testOptionID, 10, 10, testInvoice, testPayHash, "", testPreimage)
+	assert.NoError(t, err)
+	err = votes.Create(ctx, dbc, rand.Int63(), testPollID+1, testOptionID, 10, 10, testInvoice, testPayHash, "", testPreimage)
+	assert.NoError(t, err)
+	err = votes.MarkPaid(ctx, dbc, id, 1, 4)
+	assert.NoError(t, err)
+
+	count, err := votes.CountByPollAndStatus(ctx, dbc, testPollID, types.VoteStatusCreated)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
@@ -9,9 +9,23 @@ var (
 	VoteStatusPaid     VoteStatus = 3
 	VoteStatusReturned VoteStatus = 4
 	VoteStatusSettled  VoteStatus = 5
-	voteStatusSentinel VoteStatus = 6
+	VoteStatusCanceled VoteStatus = 6
+	voteStatusSentinel VoteStatus = 7
 )
 
 func (s VoteStatus) Valid() bool {
 	return s > VoteStatusUnknown && s < voteStatusSentinel
 }
+
+var strings = map[VoteStatus]string{
+	VoteStatusCreated:  "CREATED",
+	VoteStatusExpired:  "EXPIRED",
+	VoteStatusPaid:     "PAID",
+	VoteStatusReturned: "RETURNED",
+	VoteStatusSettled:  "SETTLED",
+	VoteStatusCanceled: "CANCELED",
+}
+
+func (s VoteStatus) String() string {
+	return strings[s]
+}
@@ -0,0 +1,64 @@
+package votes
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/carlaKC/lightning-poll/lnd"
+	"github.com/carlaKC/lightning-poll/votes/internal/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddInvoice(t *testing.T) {
+	setPreimageSeed(t, testPreimageSeed)
+	ctx := context.Background()
+	b := &memBackends{votes: NewMemRepository(), lnd: &lnd.MockLND{}}
+
+	// votes are saved without an invoice until one is added.
+	id, err := Create(ctx, b, nil, 1, 2, 3600, "")
+	require.NoError(t, err)
+
+	vote, err := b.votes.Lookup(ctx, nil, id)
+	require.NoError(t, err)
+	assert.Empty(t, vote.PayReq)
+	assert.NotEmpty(t, vote.PayHash)
+
+	require.NoError(t, AddInvoice(ctx, b, id, 10, 3600, "note"))
+
+	vote, err = b.votes.Lookup(ctx, nil, id)
+	require.NoError(t, err)
+	assert.Equal(t, "pay req", vote.PayReq)
+	assert.Equal(t, types.VoteStatusCreated, vote.Status)
+
+	// votes whose invoice cannot be added are expired.
+	lndErr := errors.New("lnd unavailable")
+	b.lnd.HoldInvoiceErr = lndErr
+
+	id, err = Create(ctx, b, nil, 1, 2, 3600, "")
+	require.NoError(t, err)
+	assert.Equal(t, lndErr, AddInvoice(ctx, b, id, 10, 3600, "note"))
+
+	vote, err = b.votes.Lookup(ctx, nil, id)
+	require.NoError(t, err)
+	assert.Equal(t, types.VoteStatusExpired, vote.Status)
+}
+
+func TestExpireVotesWithoutInvoice(t *testing.T) {
+	setPreimageSeed(t, testPreimageSeed)
+	ctx := context.Background()
+	b := &memBackends{votes: NewMemRepository(), lnd: &lnd.MockLND{}}
+
+	// a vote which expired before its invoice was added is expired without
+	// looking up its invoice, which LND may not have.
+	id, err := Create(ctx, b, nil, 1, 2, -60, "")
+	require.NoError(t, err)
+
+	require.NoError(t, expireVotes(ctx, b))
+
+	vote, err := b.votes.Lookup(ctx, nil, id)
+	require.NoError(t, err)
+	assert.Equal(t, types.VoteStatusExpired, vote.Status)
+	assert.Equal(t, []string{vote.PayHash}, b.lnd.Canceled)
+}
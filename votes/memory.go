@@ -0,0 +1,327 @@
+package votes
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/carlaKC/lightning-poll/db"
+	"github.com/carlaKC/lightning-poll/votes/internal/db/changes"
+	votes_db "github.com/carlaKC/lightning-poll/votes/internal/db/votes"
+	"github.com/carlaKC/lightning-poll/votes/internal/types"
+)
+
+var errDuplicateIdentity = errors.New("votes: identity already has a vote in this poll")
+
+// NewMemRepository returns a vote repository which stores votes in memory,
+// for use in tests. The handle passed to its methods is ignored, so changes
+// are not rolled back with the transaction they are made in.
+func NewMemRepository() Repository {
+	return &memVotes{votes: make(map[int64]*votes_db.DBVote)}
+}
+
+type memVotes struct {
+	mu      sync.Mutex
+	votes   map[int64]*votes_db.DBVote
+	order   []int64
+	changes []*changes.DBChange
+}
+
+// Create returns an error if a vote with the ID provided exists, as inserting
+// a duplicate key into the database would.
+func (m *memVotes) Create(_ context.Context, _ db.Handle, id, pollID, optionID, expirySeconds, closesInSeconds int64,
+	payReq, payHash, voterKey string, preimage []byte) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.votes[id]; ok {
+		return db.ErrUnexpectedRowCount
+	}
+	now := time.Now()
+
+	m.votes[id] = &votes_db.DBVote{
+		ID:        id,
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Duration(expirySeconds) * time.Second),
+		PollID:    pollID,
+		OptionID:  optionID,
+		PayReq:    payReq,
+		PayHash:   payHash,
+		Preimage:  append([]byte{}, preimage...),
+		Status:    types.VoteStatusCreated,
+		VoterKey:  voterKey,
+		ClosesAt:  now.Add(time.Duration(closesInSeconds) * time.Second),
+	}
+	m.order = append(m.order, id)
+
+	return nil
+}
+
+// copyVote returns a copy of a vote, so that callers cannot modify the stored
+// vote.
+func copyVote(vote *votes_db.DBVote) *votes_db.DBVote {
+	v := *vote
+	v.Preimage = append([]byte{}, vote.Preimage...)
+	return &v
+}
+
+// Lookup returns sql.ErrNoRows if a vote is not found, like votes_db.Lookup.
+func (m *memVotes) Lookup(_ context.Context, _ db.Handle, id int64) (*votes_db.DBVote, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	vote, ok := m.votes[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	return copyVote(vote), nil
+}
+
+func (m *memVotes) LookupByHash(_ context.Context, _ db.Handle, paymentHash string) (*votes_db.DBVote, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, id := range m.order {
+		if m.votes[id].PayHash == paymentHash {
+			return copyVote(m.votes[id]), nil
+		}
+	}
+
+	return nil, sql.ErrNoRows
+}
+
+func (m *memVotes) LookupByIdentity(_ context.Context, _ db.Handle, pollID int64,
+	identity string) (*votes_db.DBVote, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, id := range m.order {
+		if m.votes[id].PollID == pollID && m.votes[id].Identity == identity {
+			return copyVote(m.votes[id]), nil
+		}
+	}
+
+	return nil, sql.ErrNoRows
+}
+
+// list returns copies of the votes that match filter, in the order that they
+// were created.
+func (m *memVotes) list(filter func(*votes_db.DBVote) bool) []*votes_db.DBVote {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var votes []*votes_db.DBVote
+	for _, id := range m.order {
+		if filter(m.votes[id]) {
+			votes = append(votes, copyVote(m.votes[id]))
+		}
+	}
+
+	return votes
+}
+
+func (m *memVotes) ListByPollAndStatus(_ context.Context, _ db.Handle, pollID int64,
+	status types.VoteStatus) ([]*votes_db.DBVote, error) {
+
+	return m.list(func(v *votes_db.DBVote) bool {
+		return v.PollID == pollID && v.Status == status
+	}), nil
+}
+
+func (m *memVotes) ListByStatus(_ context.Context, _ db.Handle, status types.VoteStatus) ([]*votes_db.DBVote, error) {
+	return m.list(func(v *votes_db.DBVote) bool {
+		return v.Status == status
+	}), nil
+}
+
+func (m *memVotes) ListExpired(_ context.Context, _ db.Handle) ([]*votes_db.DBVote, error) {
+	now := time.Now()
+
+	return m.list(func(v *votes_db.DBVote) bool {
+		return v.Status == types.VoteStatusCreated && v.ExpiresAt.Before(now)
+	}), nil
+}
+
+func (m *memVotes) ListByVoter(_ context.Context, _ db.Handle, voterKey string) ([]*votes_db.DBVote, error) {
+	return m.list(func(v *votes_db.DBVote) bool {
+		return v.VoterKey == voterKey
+	}), nil
+}
+
+func (m *memVotes) CountByStatus(_ context.Context, _ db.Handle) (map[types.VoteStatus]int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counts := make(map[types.VoteStatus]int64)
+	for _, v := range m.votes {
+		counts[v.Status]++
+	}
+
+	return counts, nil
+}
+
+func (m *memVotes) CountByPollAndStatus(_ context.Context, _ db.Handle, pollID int64,
+	status types.VoteStatus) (int64, error) {
+
+	return int64(len(m.list(func(v *votes_db.DBVote) bool {
+		return v.PollID == pollID && v.Status == status
+	}))), nil
+}
+
+func (m *memVotes) UpdateStatus(_ context.Context, _ db.Handle, id int64, fromStatus, toStatus types.VoteStatus) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	vote, ok := m.votes[id]
+	if !ok || vote.Status != fromStatus {
+		return db.ErrUnexpectedRowCount
+	}
+
+	vote.Status = toStatus
+	return nil
+}
+
+func (m *memVotes) MarkPaid(_ context.Context, _ db.Handle, id, settleAmount int64, settleIndex uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	vote, ok := m.votes[id]
+	if !ok || vote.Status != types.VoteStatusCreated {
+		return db.ErrUnexpectedRowCount
+	}
+
+	vote.Status = types.VoteStatusPaid
+	vote.SettleAmount = settleAmount
+	vote.SettleIndex = int64(settleIndex)
+	return nil
+}
+
+func (m *memVotes) Cancel(_ context.Context, _ db.Handle, id int64, reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	vote, ok := m.votes[id]
+	if !ok || vote.Status != types.VoteStatusPaid {
+		return db.ErrUnexpectedRowCount
+	}
+
+	vote.Status = types.VoteStatusCanceled
+	vote.CancelReason = reason
+	return nil
+}
+
+func (m *memVotes) ListPlaintextPreimages(_ context.Context, _ db.Handle) ([]*votes_db.DBVote, error) {
+	return m.list(func(v *votes_db.DBVote) bool {
+		return len(v.Preimage) == 32
+	}), nil
+}
+
+func (m *memVotes) UpdatePreimage(_ context.Context, _ db.Handle, id int64, from, to []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	vote, ok := m.votes[id]
+	if !ok || !bytes.Equal(vote.Preimage, from) {
+		return db.ErrUnexpectedRowCount
+	}
+
+	vote.Preimage = append([]byte{}, to...)
+	return nil
+}
+
+func (m *memVotes) SetPayReq(_ context.Context, _ db.Handle, id int64, payReq string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	vote, ok := m.votes[id]
+	if !ok || vote.PayReq != "" {
+		return db.ErrUnexpectedRowCount
+	}
+
+	vote.PayReq = payReq
+	return nil
+}
+
+// ClaimIdentity returns an error if the identity has a vote in the poll, as
+// the database's unique constraint would.
+func (m *memVotes) ClaimIdentity(_ context.Context, _ db.Handle, id int64, identity string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	vote, ok := m.votes[id]
+	if !ok || vote.Identity != "" {
+		return db.ErrUnexpectedRowCount
+	}
+
+	for _, v := range m.votes {
+		if v.PollID == vote.PollID && v.Identity == identity {
+			return errDuplicateIdentity
+		}
+	}
+
+	vote.Identity = identity
+	return nil
+}
+
+func (m *memVotes) ReleaseIdentity(_ context.Context, _ db.Handle, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	vote, ok := m.votes[id]
+	if !ok || vote.Identity == "" {
+		return db.ErrUnexpectedRowCount
+	}
+
+	vote.Identity = ""
+	return nil
+}
+
+func (m *memVotes) ChangeOption(_ context.Context, _ db.Handle, id, fromOption, toOption int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	vote, ok := m.votes[id]
+	if !ok || vote.OptionID != fromOption || (vote.Status != types.VoteStatusCreated &&
+		vote.Status != types.VoteStatusPaid) {
+		return db.ErrUnexpectedRowCount
+	}
+
+	vote.OptionID = toOption
+	return nil
+}
+
+func (m *memVotes) CreateChange(_ context.Context, _ db.Handle, voteID, fromOption, toOption int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.changes = append(m.changes, &changes.DBChange{
+		ID:           rand.Int63(),
+		VoteID:       voteID,
+		CreatedAt:    time.Now(),
+		FromOptionID: fromOption,
+		ToOptionID:   toOption,
+	})
+	return nil
+}
+
+func (m *memVotes) ListChanges(_ context.Context, _ db.Handle, voteID int64) ([]*changes.DBChange, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var list []*changes.DBChange
+	for _, c := range m.changes {
+		if c.VoteID == voteID {
+			change := *c
+			list = append(list, &change)
+		}
+	}
+
+	return list, nil
+}
@@ -0,0 +1,79 @@
+package votes
+
+import (
+	"context"
+
+	"github.com/carlaKC/lightning-poll/health"
+	"github.com/carlaKC/lightning-poll/logging"
+	"github.com/carlaKC/lightning-poll/votes/internal/types"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var voteCount = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "main",
+	Subsystem: "votes",
+	Name:      "count",
+	Help:      "Count of votes by status.",
+}, []string{"status"})
+
+var invoiceCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "main",
+	Subsystem: "invoices",
+	Name:      "total",
+	Help:      "Count of vote hold invoices by event.",
+}, []string{"event"})
+
+var invoiceSats = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "main",
+	Subsystem: "invoices",
+	Name:      "sats_total",
+	Help:      "Satoshis held, refunded and settled for vote hold invoices.",
+}, []string{"event"})
+
+func init() {
+	prometheus.MustRegister(voteCount)
+	prometheus.MustRegister(invoiceCount)
+	prometheus.MustRegister(invoiceSats)
+}
+
+const (
+	invoiceCreated  = "created"
+	invoiceAccepted = "accepted"
+	invoiceCanceled = "canceled"
+	invoiceExpired  = "expired"
+	invoiceSettled  = "settled"
+)
+
+// recordInvoice counts an event for a vote's hold invoice, and the amount of
+// satoshis that moved because of it.
+func recordInvoice(event string, sats int64) {
+	invoiceCount.WithLabelValues(event).Inc()
+	invoiceSats.WithLabelValues(event).Add(float64(sats))
+}
+
+func updateMetricsForever(ctx context.Context, b Backends) {
+	for {
+		if err := updateVoteMetrics(context.Background(), b); err != nil {
+			logging.From(ctx).Error("update vote metrics failed", "error", err)
+		} else {
+			health.Beat(metricsLoop)
+		}
+
+		if !health.Wait(ctx, metricsInterval) {
+			return
+		}
+	}
+}
+
+func updateVoteMetrics(ctx context.Context, b Backends) error {
+	counts, err := b.GetVotes().CountByStatus(ctx, b.GetConn())
+	if err != nil {
+		return err
+	}
+
+	for s := types.VoteStatus(1); s.Valid(); s++ {
+		voteCount.WithLabelValues(s.String()).Set(float64(counts[s]))
+	}
+
+	return nil
+}
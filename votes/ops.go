@@ -2,44 +2,158 @@ package votes
 
 import (
 	"context"
-	"database/sql"
+	"crypto/sha256"
 	"encoding/hex"
-	"log"
+	"flag"
+	"math/rand"
+	"sort"
+	"time"
 
+	"github.com/carlaKC/lightning-poll/db"
+	"github.com/carlaKC/lightning-poll/ledger"
 	"github.com/carlaKC/lightning-poll/lnd"
+	"github.com/carlaKC/lightning-poll/logging"
 	ext_types "github.com/carlaKC/lightning-poll/types"
 	votes_db "github.com/carlaKC/lightning-poll/votes/internal/db/votes"
 	"github.com/carlaKC/lightning-poll/votes/internal/types"
 	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/pkg/errors"
 )
 
+var (
+	maxOpenVotes = flag.Int64("max_open_votes", 100, "Maximum number of unpaid vote "+
+		"invoices that a poll may have open at once, 0 for no limit")
+	paymentWindow = flag.Duration("vote_payment_window", time.Minute*10, "Time that "+
+		"voters have to pay a vote's invoice before it expires")
+)
+
+var ErrTooManyOpenVotes = errors.New("Poll has too many unpaid votes, please try again later")
+
 type Backends interface {
-	GetDB() *sql.DB
+	GetConn() db.Conn
+	GetVotes() Repository
 	GetLND() lnd.Client
 }
 
-// Create initiates the process of voting for an option. It queries LND for
-// an invoice, saved it in the votes DB and returns it to the user.
-func Create(ctx context.Context, b Backends, pollID, optionID, sats, expiry int64, note string) (int64, error) {
-	resp, err := b.GetLND().AddHoldInvoice(ctx, sats, expiry, note)
-	if err != nil {
+// Create initiates the process of voting for an option by saving a vote
+// without an invoice, which AddInvoice adds once the vote is committed. The
+// expiry provided is the number of seconds until the poll closes, and votes
+// are refused for polls which close beyond the horizon that HTLCs can be held
+// for. The vote expires at the end of the payment window, or when the poll
+// closes if that is sooner, so that unpaid votes do not stay open for long.
+// The vote is saved using the handle provided, so that callers can create it
+// in the same transaction as checking that the poll is open. The voter key
+// links the vote to a logged in voter, and is empty for anonymous votes.
+func Create(ctx context.Context, b Backends, h db.Handle, pollID, optionID, expiry int64,
+	voterKey string) (int64, error) {
+
+	if _, err := voteCLTV(time.Duration(expiry) * time.Second); err != nil {
 		return 0, err
 	}
 
-	id, err := votes_db.Create(ctx, b.GetDB(), pollID, optionID, expiry,
-		resp.PayReq, resp.PayHash, resp.Preimage)
+	// limit the number of unpaid invoices a poll can have, so that it cannot
+	// be used to flood our node with invoices.
+	if *maxOpenVotes > 0 {
+		open, err := b.GetVotes().CountByPollAndStatus(ctx, h, pollID,
+			types.VoteStatusCreated)
+		if err != nil {
+			return 0, err
+		}
+
+		if open >= *maxOpenVotes {
+			return 0, ErrTooManyOpenVotes
+		}
+	}
+
+	// the vote's preimage is derived from its ID, so that it does not need to
+	// be stored where anyone who can read the database could settle the vote.
+	id := rand.Int63()
+	preimage, err := DerivePreimage(id)
 	if err != nil {
 		return 0, err
 	}
+	hash := sha256.Sum256(preimage)
 
-	log.Printf("votes/ops: Created vote: %v", id)
-	go subscribeIndividualInvoice(context.Background(), b, id, resp.PayHash)
+	if err := b.GetVotes().Create(ctx, h, id, pollID, optionID, paymentExpiry(expiry),
+		expiry, "", hex.EncodeToString(hash[:]), voterKey, nil); err != nil {
+		return 0, err
+	}
 
 	return id, nil
 }
 
+// AddInvoice adds the hold invoice for a vote saved by Create. It must only be
+// called once the vote has been committed, so that LND is not called while its
+// poll is locked and every invoice has a vote. If the invoice cannot be added
+// the vote is expired. The expiry is the number of seconds until the poll
+// closes.
+func AddInvoice(ctx context.Context, b Backends, id, sats, expiry int64, note string) error {
+	vote, err := b.GetVotes().Lookup(ctx, b.GetConn(), id)
+	if err != nil {
+		return err
+	}
+
+	ctx = logging.With(ctx, logging.FieldPollID, vote.PollID, logging.FieldVoteID, id,
+		logging.FieldPaymentHash, vote.PayHash)
+
+	cltv, err := voteCLTV(time.Duration(expiry) * time.Second)
+	if err != nil {
+		return expireVote(ctx, b, id, err)
+	}
+
+	preimage, err := DerivePreimage(id)
+	if err != nil {
+		return expireVote(ctx, b, id, err)
+	}
+	hash := sha256.Sum256(preimage)
+
+	resp, err := b.GetLND().AddHoldInvoice(ctx, hash[:], sats, paymentExpiry(expiry), cltv,
+		note)
+	if err != nil {
+		return expireVote(ctx, b, id, err)
+	}
+
+	// if the payment request cannot be saved the voter never sees it, and the
+	// invoice is canceled when the vote expires.
+	if err := b.GetVotes().SetPayReq(ctx, b.GetConn(), id, resp.PayReq); err != nil {
+		return err
+	}
+
+	logging.From(ctx).Info("created vote", "option_id", vote.OptionID)
+	recordInvoice(invoiceCreated, 0)
+
+	// the subscription outlives the request that created the vote, but keeps
+	// its logging fields.
+	go subscribeIndividualInvoice(context.WithoutCancel(ctx), b, id, resp.PayHash)
+
+	return nil
+}
+
+// expireVote expires a vote whose invoice could not be added, and returns the
+// error that prevented it.
+func expireVote(ctx context.Context, b Backends, id int64, cause error) error {
+	if err := b.GetVotes().UpdateStatus(ctx, b.GetConn(), id, types.VoteStatusCreated,
+		types.VoteStatusExpired); err != nil {
+		logging.From(ctx).Error("expire vote without invoice failed", "error", err)
+	}
+
+	return cause
+}
+
+// paymentExpiry returns the number of seconds that a vote's invoice can be
+// paid for, which is the payment window capped at the time until the poll
+// closes.
+func paymentExpiry(closesIn int64) int64 {
+	window := int64(*paymentWindow / time.Second)
+	if window > 0 && window < closesIn {
+		return window
+	}
+
+	return closesIn
+}
+
 func Lookup(ctx context.Context, b Backends, id int64) (*Vote, error) {
-	vote, err := votes_db.Lookup(ctx, b.GetDB(), id)
+	vote, err := b.GetVotes().Lookup(ctx, b.GetConn(), id)
 	if err != nil {
 		return nil, err
 	}
@@ -56,7 +170,7 @@ func Lookup(ctx context.Context, b Backends, id int64) (*Vote, error) {
 func subscribeIndividualInvoice(ctx context.Context, b Backends, id int64, payHash string) {
 	cl, err := b.GetLND().SubscribeInvoice(ctx, id, payHash)
 	if err != nil {
-		log.Printf("subscribeIndividualInvoice error:%v", err)
+		logging.From(ctx).Error("subscribe to vote invoice failed", "error", err)
 		return
 	}
 
@@ -66,30 +180,31 @@ func subscribeIndividualInvoice(ctx context.Context, b Backends, id int64, payHa
 		// just a sanity check so that these goroutines don't spiral off into infinity
 		count++
 		if count == maxIterations {
-			log.Printf("subscribeIndividualInvoice breaking out to prevent leak:%v", err)
+			logging.From(ctx).Warn("vote invoice subscription reached max iterations")
 		}
 
 		if ctx.Err() != nil {
-			log.Printf("subscribeIndividualInvoice error:%v", err)
+			logging.From(ctx).Error("vote invoice subscription canceled", "error", ctx.Err())
 			return
 		}
 
 		inv, err := cl.Recv()
 		if err != nil {
-			log.Printf("subscribeIndividualInvoice error:%v", err)
+			logging.From(ctx).Error("vote invoice subscription failed", "error", err)
 			return
 		}
 
 		if inv.State != lnrpc.Invoice_ACCEPTED {
-			log.Printf("votes/ops: settleInvoices stream received a non-settled invoice")
+			logging.From(ctx).Debug("vote invoice subscription received update",
+				"state", inv.State.String())
 			continue
 		}
 
 		if err := markInvoicePaid(ctx, b, hex.EncodeToString(inv.RHash), inv.AmtPaidSat, inv.SettleIndex); err != nil {
-			log.Printf("subscribeIndividualInvoice error:%v", err)
+			logging.From(ctx).Error("mark vote paid failed", "error", err)
 			return
 		}
-		log.Printf("votes/ops: marked invoice %v as paid", id)
+		logging.From(ctx).Info("marked vote paid", "amount", inv.AmtPaidSat)
 		return
 	}
 }
@@ -110,28 +225,40 @@ func GetResults(ctx context.Context, b Backends, pollID int64) (map[int64]int64,
 	return v, nil
 }
 
-func getVotes(ctx context.Context, b Backends, pollID int64) ([]*votes_db.DBVote, error) {
-	votes, err := votes_db.ListByPollAndStatus(ctx, b.GetDB(), pollID, types.VoteStatusPaid)
-	if err != nil {
-		return nil, err
-	}
+// countedStatuses are the statuses of votes which count towards a poll's
+// results.
+var countedStatuses = []types.VoteStatus{
+	types.VoteStatusReturned,
+	types.VoteStatusPaid,
+	types.VoteStatusSettled,
+}
 
-	returned, err := votes_db.ListByPollAndStatus(ctx, b.GetDB(), pollID, types.VoteStatusReturned)
-	if err != nil {
-		return nil, err
+// CountedStatuses returns the statuses of votes which count towards a poll's
+// results, for queries which total votes by poll.
+func CountedStatuses() []int {
+	statuses := make([]int, 0, len(countedStatuses))
+	for _, s := range countedStatuses {
+		statuses = append(statuses, int(s))
 	}
-	returned = append(returned, votes...)
 
-	settled, err := votes_db.ListByPollAndStatus(ctx, b.GetDB(), pollID, types.VoteStatusSettled)
-	if err != nil {
-		return nil, err
+	return statuses
+}
+
+func getVotes(ctx context.Context, b Backends, pollID int64) ([]*votes_db.DBVote, error) {
+	var votes []*votes_db.DBVote
+	for _, status := range countedStatuses {
+		list, err := b.GetVotes().ListByPollAndStatus(ctx, b.GetConn(), pollID, status)
+		if err != nil {
+			return nil, err
+		}
+		votes = append(votes, list...)
 	}
 
-	return append(returned, settled...), nil
+	return votes, nil
 }
 
 func GetVotes(ctx context.Context, b Backends, pollID int64) ([]*Vote, error) {
-	votes, err := votes_db.ListByPollAndStatus(ctx, b.GetDB(), pollID, types.VoteStatusPaid)
+	votes, err := b.GetVotes().ListByPollAndStatus(ctx, b.GetConn(), pollID, types.VoteStatusPaid)
 	if err != nil {
 		return nil, err
 	}
@@ -140,6 +267,7 @@ func GetVotes(ctx context.Context, b Backends, pollID int64) ([]*Vote, error) {
 	for _, vote := range votes {
 		voteList = append(voteList, &Vote{
 			ID:       vote.ID,
+			PollID:   vote.PollID,
 			OptionID: vote.OptionID,
 			Preimage: vote.Preimage,
 			Hash:     vote.PayHash,
@@ -150,6 +278,40 @@ func GetVotes(ctx context.Context, b Backends, pollID int64) ([]*Vote, error) {
 	return voteList, nil
 }
 
+// ListByVoter returns the votes made by a logged in voter, most recent first.
+func ListByVoter(ctx context.Context, b Backends, voterKey string) ([]*Vote, error) {
+	votes, err := b.GetVotes().ListByVoter(ctx, b.GetConn(), voterKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var voteList []*Vote
+	for _, vote := range votes {
+		voteList = append(voteList, &Vote{
+			ID:        vote.ID,
+			PollID:    vote.PollID,
+			OptionID:  vote.OptionID,
+			Hash:      vote.PayHash,
+			Amount:    vote.SettleAmount,
+			PayReq:    vote.PayReq,
+			CreatedAt: vote.CreatedAt,
+			Outcome:   outcomes[vote.Status],
+			Receipt:   counted(vote.Status),
+		})
+	}
+
+	sort.Slice(voteList, func(i, j int) bool {
+		return voteList[i].CreatedAt.After(voteList[j].CreatedAt)
+	})
+
+	return voteList, nil
+}
+
+// ReleaseVotesForPoll settles or returns each of a poll's paid votes according
+// to its repay scheme, and returns the total of its settled votes. Votes that
+// were released by an earlier call are left as they are but still counted, so
+// that a poll which failed part way through being released can be released
+// again.
 func ReleaseVotesForPoll(ctx context.Context, b Backends, pollID int64, shouldRepay ext_types.RepaySchemeFunc) (int64, error) {
 	results, err := GetResults(ctx, b, pollID)
 	if err != nil {
@@ -161,44 +323,73 @@ func ReleaseVotesForPoll(ctx context.Context, b Backends, pollID int64, shouldRe
 		return 0, err
 	}
 
-	var amount int64 = 0
-
 	for _, vote := range votes {
 		if shouldRepay(results, vote.OptionID) {
-			if err := releaseVote(ctx, b, vote.ID, vote.Hash); err != nil {
+			if err := releaseVote(ctx, b, vote); err != nil {
 				return 0, err
 			}
 		} else {
-			amount = amount + vote.Amount
-			if err := settleVote(ctx, b, vote.ID, vote.Preimage); err != nil {
+			if err := settleVote(ctx, b, vote); err != nil {
 				return 0, err
 			}
 		}
 	}
 
+	settled, err := b.GetVotes().ListByPollAndStatus(ctx, b.GetConn(), pollID,
+		types.VoteStatusSettled)
+	if err != nil {
+		return 0, err
+	}
+
+	var amount int64
+	for _, vote := range settled {
+		amount += vote.SettleAmount
+	}
+
 	return amount, nil
 }
 
-func releaseVote(ctx context.Context, b Backends, id int64, hash string) error {
-	if err := b.GetLND().CancelHoldInvoice(ctx, hash); err != nil {
+func releaseVote(ctx context.Context, b Backends, vote *Vote) error {
+	if err := b.GetLND().CancelHoldInvoice(ctx, vote.Hash); err != nil {
 		return err
 	}
-	if err := votes_db.UpdateStatus(ctx, b.GetDB(), id, types.VoteStatusPaid,
-		types.VoteStatusReturned); err != nil {
+	err := db.WithTx(ctx, b.GetConn(), func(tx db.Handle) error {
+		if err := b.GetVotes().UpdateStatus(ctx, tx, vote.ID, types.VoteStatusPaid,
+			types.VoteStatusReturned); err != nil {
+			return err
+		}
+
+		return ledger.RecordVoteCanceled(ctx, tx, vote.PollID, vote.Amount)
+	})
+	if err != nil {
 		return err
 	}
+	recordInvoice(invoiceCanceled, vote.Amount)
 
 	return nil
 }
 
-func settleVote(ctx context.Context, b Backends, id int64, preimage []byte) error {
+func settleVote(ctx context.Context, b Backends, vote *Vote) error {
+	preimage, err := votePreimage(vote)
+	if err != nil {
+		return err
+	}
+
 	if err := b.GetLND().SettleHoldInvoice(ctx, preimage); err != nil {
 		return err
 	}
-	if err := votes_db.UpdateStatus(ctx, b.GetDB(), id, types.VoteStatusPaid,
-		types.VoteStatusSettled); err != nil {
+	err = db.WithTx(ctx, b.GetConn(), func(tx db.Handle) error {
+		if err := b.GetVotes().UpdateStatus(ctx, tx, vote.ID, types.VoteStatusPaid,
+			types.VoteStatusSettled); err != nil {
+			return err
+		}
+
+		return ledger.RecordVoteSettled(ctx, tx, vote.PollID, vote.Amount)
+	})
+	if err != nil {
 		return err
 	}
+	recordInvoice(invoiceSettled, vote.Amount)
 
 	return nil
 }
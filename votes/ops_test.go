@@ -2,7 +2,7 @@ package votes_test
 
 import (
 	"context"
-	"database/sql"
+	"flag"
 	"testing"
 
 	"github.com/carlaKC/lightning-poll/db"
@@ -19,15 +19,21 @@ var (
 	testSats     = int64(10)
 	testExpiry   = int64(100)
 	testNote     = "test note"
+
+	testPreimageSeed = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
 )
 
 type testBackends struct {
-	dbc *sql.DB
-	lnd *lnd.MockLND
+	conn db.Conn
+	lnd  *lnd.MockLND
+}
+
+func (b *testBackends) GetConn() db.Conn {
+	return b.conn
 }
 
-func (b *testBackends) GetDB() *sql.DB {
-	return b.dbc
+func (b *testBackends) GetVotes() votes.Repository {
+	return votes.NewSQLRepository()
 }
 
 func (b *testBackends) GetLND() lnd.Client {
@@ -35,14 +41,28 @@ func (b *testBackends) GetLND() lnd.Client {
 }
 
 func setup(t *testing.T) (context.Context, votes.Backends) {
-	return context.Background(), &testBackends{dbc: db.ConnectForTesting(t), lnd: &lnd.MockLND{}}
+	if err := flag.Set("preimage_seed", testPreimageSeed); err != nil {
+		t.Fatal(err)
+	}
+
+	return context.Background(), &testBackends{
+		conn: db.ConnectForTesting(t),
+		lnd:  &lnd.MockLND{},
+	}
 }
 
 func TestCreate(t *testing.T) {
 	ctx, b := setup(t)
 
-	_, err := votes.Create(ctx, b, testPollID, testOptionID, testSats, testExpiry, testNote)
+	id, err := votes.Create(ctx, b, b.GetConn(), testPollID, testOptionID, testExpiry, "")
+	assert.NoError(t, err)
+
+	err = votes.AddInvoice(ctx, b, id, testSats, testExpiry, testNote)
+	assert.NoError(t, err)
+
+	vote, err := votes.Lookup(ctx, b, id)
 	assert.NoError(t, err)
+	assert.NotEmpty(t, vote.PayReq)
 }
 
 func TestGetVotes(t *testing.T) {
@@ -50,21 +70,21 @@ func TestGetVotes(t *testing.T) {
 
 	testOptionID2 := int64(876)
 
-	id1, err := votes.Create(ctx, b, testPollID, testOptionID, testSats, testExpiry, testNote)
+	id1, err := votes.Create(ctx, b, b.GetConn(), testPollID, testOptionID, testExpiry, "")
 	assert.NoError(t, err)
-	err = votes_db.UpdateStatus(ctx, b.GetDB(), id1, types.VoteStatusCreated, types.VoteStatusPaid)
+	err = votes_db.UpdateStatus(ctx, b.GetConn(), id1, types.VoteStatusCreated, types.VoteStatusPaid)
 	assert.NoError(t, err)
 
-	id2, err := votes.Create(ctx, b, testPollID, testOptionID, testSats, testExpiry, testNote)
+	id2, err := votes.Create(ctx, b, b.GetConn(), testPollID, testOptionID, testExpiry, "")
 	assert.NoError(t, err)
-	err = votes_db.UpdateStatus(ctx, b.GetDB(), id2, types.VoteStatusCreated, types.VoteStatusPaid)
+	err = votes_db.UpdateStatus(ctx, b.GetConn(), id2, types.VoteStatusCreated, types.VoteStatusPaid)
 	assert.NoError(t, err)
 
-	id3, err := votes.Create(ctx, b, testPollID, testOptionID2, testSats, testExpiry, testNote)
+	id3, err := votes.Create(ctx, b, b.GetConn(), testPollID, testOptionID2, testExpiry, "")
 	assert.NoError(t, err)
-	err = votes_db.UpdateStatus(ctx, b.GetDB(), id3, types.VoteStatusCreated, types.VoteStatusPaid)
+	err = votes_db.UpdateStatus(ctx, b.GetConn(), id3, types.VoteStatusCreated, types.VoteStatusPaid)
 	assert.NoError(t, err)
-	_, err = votes.Create(ctx, b, testPollID, testOptionID2, testSats, testExpiry, testNote)
+	_, err = votes.Create(ctx, b, b.GetConn(), testPollID, testOptionID2, testExpiry, "")
 	assert.NoError(t, err)
 
 	v, err := votes.GetResults(ctx, b, testPollID)
@@ -75,9 +95,9 @@ func TestGetVotes(t *testing.T) {
 	_, err = votes.GetResults(ctx, b, testPollID)
 	assert.NoError(t, err)
 
-	err = votes_db.UpdateStatus(ctx, b.GetDB(), id1, types.VoteStatusPaid, types.VoteStatusReturned)
+	err = votes_db.UpdateStatus(ctx, b.GetConn(), id1, types.VoteStatusPaid, types.VoteStatusReturned)
 	assert.NoError(t, err)
-	err = votes_db.UpdateStatus(ctx, b.GetDB(), id2, types.VoteStatusPaid, types.VoteStatusReturned)
+	err = votes_db.UpdateStatus(ctx, b.GetConn(), id2, types.VoteStatusPaid, types.VoteStatusReturned)
 	assert.NoError(t, err)
 
 	v, err = votes.GetResults(ctx, b, testPollID)
@@ -0,0 +1,211 @@
+package votes
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/carlaKC/lightning-poll/logging"
+)
+
+var (
+	preimageSeed = flag.String("preimage_seed", "", "Hex encoded secret of at least "+
+		"32 bytes which vote preimages are derived from")
+	preimageKey = flag.String("preimage_key", "", "Hex encoded 32 byte key "+
+		"used to encrypt the preimages of votes created before preimages were derived")
+)
+
+var (
+	ErrNoPreimageSeed      = errors.New("votes: preimage_seed is not set")
+	ErrInvalidPreimageSeed = errors.New("votes: preimage_seed must be at least 32 hex encoded bytes")
+	ErrNoPreimageKey       = errors.New("votes: preimage_key is not set")
+	ErrInvalidPreimageKey  = errors.New("votes: preimage_key must be 32 hex encoded bytes")
+	ErrPreimageMismatch    = errors.New("votes: preimage does not match payment hash")
+)
+
+const (
+	// preimageLength is the length of a hold invoice preimage. Preimages of
+	// this length in the database were stored before they were encrypted.
+	preimageLength = 32
+
+	// preimageVersionAESGCM prefixes preimages encrypted with AES-GCM, followed
+	// by the nonce and ciphertext.
+	preimageVersionAESGCM byte = 1
+)
+
+// CheckPreimageSecrets returns an error if the preimage seed is not
+// configured, or if either of the seed or key are invalid, so that the server
+// can refuse to start rather than fail to create or settle votes.
+func CheckPreimageSecrets() error {
+	if _, err := seed(); err != nil {
+		return err
+	}
+
+	if *preimageKey == "" {
+		return nil
+	}
+
+	return CheckPreimageKey()
+}
+
+// CheckPreimageKey returns an error if the preimage key is not configured.
+func CheckPreimageKey() error {
+	_, err := preimageCipher()
+	return err
+}
+
+func seed() ([]byte, error) {
+	if *preimageSeed == "" {
+		return nil, ErrNoPreimageSeed
+	}
+
+	s, err := hex.DecodeString(*preimageSeed)
+	if err != nil || len(s) < 32 {
+		return nil, ErrInvalidPreimageSeed
+	}
+
+	return s, nil
+}
+
+// DerivePreimage returns the preimage for a vote, which is derived from the
+// preimage seed and the vote's ID so that it never needs to be stored.
+func DerivePreimage(voteID int64) ([]byte, error) {
+	s, err := seed()
+	if err != nil {
+		return nil, err
+	}
+
+	var id [8]byte
+	binary.BigEndian.PutUint64(id[:], uint64(voteID))
+
+	mac := hmac.New(sha256.New, s)
+	mac.Write([]byte("lightning-poll vote preimage"))
+	mac.Write(id[:])
+
+	return mac.Sum(nil), nil
+}
+
+// votePreimage returns the preimage that settles a vote. Votes created before
+// preimages were derived have their preimage stored, and are opened instead.
+func votePreimage(vote *Vote) ([]byte, error) {
+	if len(vote.Preimage) != 0 {
+		return openPreimage(vote.Preimage, vote.Hash)
+	}
+
+	preimage, err := DerivePreimage(vote.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return preimage, checkPreimage(preimage, vote.Hash)
+}
+
+func preimageCipher() (cipher.AEAD, error) {
+	if *preimageKey == "" {
+		return nil, ErrNoPreimageKey
+	}
+
+	key, err := hex.DecodeString(*preimageKey)
+	if err != nil || len(key) != 32 {
+		return nil, ErrInvalidPreimageKey
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// sealPreimage encrypts a preimage to be stored in the database. It is only
+// used to migrate votes created before preimages were derived. The payment
+// hash is authenticated with it, so that an encrypted preimage cannot be
+// copied to another vote.
+func sealPreimage(preimage []byte, payHash string) ([]byte, error) {
+	aead, err := preimageCipher()
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	sealed := append([]byte{preimageVersionAESGCM}, nonce...)
+	return aead.Seal(sealed, nonce, preimage, []byte(payHash)), nil
+}
+
+// openPreimage returns the preimage for a vote from its stored value, and
+// checks that it matches the vote's payment hash. Preimages which have not
+// been encrypted yet are returned as they are.
+func openPreimage(stored []byte, payHash string) ([]byte, error) {
+	preimage := stored
+	if len(stored) != preimageLength {
+		aead, err := preimageCipher()
+		if err != nil {
+			return nil, err
+		}
+
+		if len(stored) < 1+aead.NonceSize() || stored[0] != preimageVersionAESGCM {
+			return nil, errors.New("votes: unknown preimage format")
+		}
+		nonce := stored[1 : 1+aead.NonceSize()]
+
+		preimage, err = aead.Open(nil, nonce, stored[1+aead.NonceSize():], []byte(payHash))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return preimage, checkPreimage(preimage, payHash)
+}
+
+// checkPreimage returns ErrPreimageMismatch if preimage does not hash to the
+// payment hash provided.
+func checkPreimage(preimage []byte, payHash string) error {
+	hash := sha256.Sum256(preimage)
+	if hex.EncodeToString(hash[:]) != payHash {
+		return ErrPreimageMismatch
+	}
+
+	return nil
+}
+
+// EncryptPreimages encrypts the preimages of votes which were stored before
+// preimages were encrypted, and returns the number of votes updated.
+func EncryptPreimages(ctx context.Context, b Backends) (int, error) {
+	votes, err := b.GetVotes().ListPlaintextPreimages(ctx, b.GetConn())
+	if err != nil {
+		return 0, err
+	}
+
+	for i, vote := range votes {
+		if _, err := openPreimage(vote.Preimage, vote.PayHash); err != nil {
+			return i, fmt.Errorf("vote %v: %v", vote.ID, err)
+		}
+
+		sealed, err := sealPreimage(vote.Preimage, vote.PayHash)
+		if err != nil {
+			return i, err
+		}
+
+		if err := b.GetVotes().UpdatePreimage(ctx, b.GetConn(), vote.ID, vote.Preimage,
+			sealed); err != nil {
+			return i, fmt.Errorf("vote %v: %v", vote.ID, err)
+		}
+
+		logging.From(ctx).Debug("encrypted vote preimage", logging.FieldVoteID, vote.ID)
+	}
+
+	return len(votes), nil
+}
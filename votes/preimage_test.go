@@ -0,0 +1,211 @@
+package votes
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	mrand "math/rand"
+	"testing"
+
+	"github.com/carlaKC/lightning-poll/db"
+	"github.com/carlaKC/lightning-poll/lnd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPreimageKey = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+
+func setPreimageKey(t *testing.T, key string) {
+	old := *preimageKey
+	require.NoError(t, flag.Set("preimage_key", key))
+	t.Cleanup(func() {
+		*preimageKey = old
+	})
+}
+
+func testPreimage() ([]byte, string) {
+	preimage := make([]byte, 32)
+	rand.Read(preimage)
+	hash := sha256.Sum256(preimage)
+	return preimage, hex.EncodeToString(hash[:])
+}
+
+func TestPreimageKey(t *testing.T) {
+	setPreimageKey(t, "")
+	assert.Equal(t, ErrNoPreimageKey, CheckPreimageKey())
+
+	setPreimageKey(t, "abcd")
+	assert.Equal(t, ErrInvalidPreimageKey, CheckPreimageKey())
+
+	setPreimageKey(t, testPreimageKey)
+	assert.NoError(t, CheckPreimageKey())
+}
+
+func TestSealPreimage(t *testing.T) {
+	setPreimageKey(t, testPreimageKey)
+	preimage, hash := testPreimage()
+
+	sealed, err := sealPreimage(preimage, hash)
+	require.NoError(t, err)
+	assert.NotContains(t, string(sealed), string(preimage))
+
+	opened, err := openPreimage(sealed, hash)
+	require.NoError(t, err)
+	assert.Equal(t, preimage, opened)
+
+	// sealed preimages cannot be opened for another vote's payment hash.
+	_, otherHash := testPreimage()
+	_, err = openPreimage(sealed, otherHash)
+	assert.Error(t, err)
+
+	// or with another key.
+	setPreimageKey(t, "ff"+testPreimageKey[2:])
+	_, err = openPreimage(sealed, hash)
+	assert.Error(t, err)
+}
+
+func TestOpenPlaintextPreimage(t *testing.T) {
+	setPreimageKey(t, "")
+	preimage, hash := testPreimage()
+
+	// preimages stored before encryption are returned as they are.
+	opened, err := openPreimage(preimage, hash)
+	require.NoError(t, err)
+	assert.Equal(t, preimage, opened)
+
+	_, otherHash := testPreimage()
+	_, err = openPreimage(preimage, otherHash)
+	assert.Equal(t, ErrPreimageMismatch, err)
+}
+
+type memBackends struct {
+	votes Repository
+	lnd   *lnd.MockLND
+}
+
+func (m *memBackends) GetConn() db.Conn {
+	return nil
+}
+
+func (m *memBackends) GetVotes() Repository {
+	return m.votes
+}
+
+func (m *memBackends) GetLND() lnd.Client {
+	return m.lnd
+}
+
+func TestEncryptPreimages(t *testing.T) {
+	setPreimageKey(t, testPreimageKey)
+	ctx := context.Background()
+	b := &memBackends{votes: NewMemRepository()}
+
+	preimage, hash := testPreimage()
+	plaintextID := mrand.Int63()
+	err := b.votes.Create(ctx, nil, plaintextID, 1, 2, 60, 60, "lnbc1", hash, "", preimage)
+	require.NoError(t, err)
+
+	sealed, err := sealPreimage(preimage, hash)
+	require.NoError(t, err)
+	err = b.votes.Create(ctx, nil, mrand.Int63(), 1, 2, 60, 60, "lnbc1", hash, "", sealed)
+	require.NoError(t, err)
+
+	// votes with derived preimages are not encrypted.
+	err = b.votes.Create(ctx, nil, mrand.Int63(), 1, 2, 60, 60, "lnbc1", hash, "", nil)
+	require.NoError(t, err)
+
+	n, err := EncryptPreimages(ctx, b)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	vote, err := b.votes.Lookup(ctx, nil, plaintextID)
+	require.NoError(t, err)
+	assert.NotEqual(t, preimage, vote.Preimage)
+
+	opened, err := openPreimage(vote.Preimage, hash)
+	require.NoError(t, err)
+	assert.Equal(t, preimage, opened)
+
+	// running the migration again has nothing to do.
+	n, err = EncryptPreimages(ctx, b)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
+
+const testPreimageSeed = "1f1e1d1c1b1a191817161514131211100f0e0d0c0b0a09080706050403020100"
+
+func setPreimageSeed(t *testing.T, seed string) {
+	old := *preimageSeed
+	require.NoError(t, flag.Set("preimage_seed", seed))
+	t.Cleanup(func() {
+		*preimageSeed = old
+	})
+}
+
+func TestPreimageSecrets(t *testing.T) {
+	setPreimageSeed(t, "")
+	setPreimageKey(t, "")
+	assert.Equal(t, ErrNoPreimageSeed, CheckPreimageSecrets())
+
+	setPreimageSeed(t, "abcd")
+	assert.Equal(t, ErrInvalidPreimageSeed, CheckPreimageSecrets())
+
+	// the key is only needed for votes created before preimages were derived.
+	setPreimageSeed(t, testPreimageSeed)
+	assert.NoError(t, CheckPreimageSecrets())
+
+	setPreimageKey(t, "abcd")
+	assert.Equal(t, ErrInvalidPreimageKey, CheckPreimageSecrets())
+}
+
+func TestDerivePreimage(t *testing.T) {
+	setPreimageSeed(t, testPreimageSeed)
+
+	preimage, err := DerivePreimage(1)
+	require.NoError(t, err)
+	assert.Len(t, preimage, 32)
+
+	// preimages are deterministic, and unique to each vote.
+	again, err := DerivePreimage(1)
+	require.NoError(t, err)
+	assert.Equal(t, preimage, again)
+
+	other, err := DerivePreimage(2)
+	require.NoError(t, err)
+	assert.NotEqual(t, preimage, other)
+
+	// and to each seed.
+	setPreimageSeed(t, "00"+testPreimageSeed[2:])
+	otherSeed, err := DerivePreimage(1)
+	require.NoError(t, err)
+	assert.NotEqual(t, preimage, otherSeed)
+}
+
+func TestVotePreimage(t *testing.T) {
+	setPreimageSeed(t, testPreimageSeed)
+	setPreimageKey(t, testPreimageKey)
+
+	derived, err := DerivePreimage(1)
+	require.NoError(t, err)
+	hash := sha256.Sum256(derived)
+
+	preimage, err := votePreimage(&Vote{ID: 1, Hash: hex.EncodeToString(hash[:])})
+	require.NoError(t, err)
+	assert.Equal(t, derived, preimage)
+
+	// derived preimages are checked against the vote's payment hash, in case
+	// the seed has changed.
+	_, err = votePreimage(&Vote{ID: 2, Hash: hex.EncodeToString(hash[:])})
+	assert.Equal(t, ErrPreimageMismatch, err)
+
+	// votes created before preimages were derived use their stored preimage.
+	stored, storedHash := testPreimage()
+	sealed, err := sealPreimage(stored, storedHash)
+	require.NoError(t, err)
+
+	preimage, err = votePreimage(&Vote{ID: 1, Hash: storedHash, Preimage: sealed})
+	require.NoError(t, err)
+	assert.Equal(t, stored, preimage)
+}
@@ -0,0 +1,181 @@
+package votes
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	votes_db "github.com/carlaKC/lightning-poll/votes/internal/db/votes"
+	"github.com/carlaKC/lightning-poll/votes/internal/types"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrInvalidReceipt = errors.New("Receipt was not signed by this node")
+	ErrVoteNotPaid    = errors.New("Receipts are only issued once a vote has been paid")
+)
+
+// Outcomes of a vote, shown on its receipt.
+const (
+	OutcomeUnpaid   = "unpaid"
+	OutcomeExpired  = "expired"
+	OutcomeHeld     = "held until the poll closes"
+	OutcomeRefunded = "refunded"
+	OutcomeSettled  = "settled"
+	OutcomeChanged  = "changed to another option"
+)
+
+var outcomes = map[types.VoteStatus]string{
+	types.VoteStatusCreated:  OutcomeUnpaid,
+	types.VoteStatusExpired:  OutcomeExpired,
+	types.VoteStatusPaid:     OutcomeHeld,
+	types.VoteStatusReturned: OutcomeRefunded,
+	types.VoteStatusCanceled: OutcomeRefunded,
+	types.VoteStatusSettled:  OutcomeSettled,
+}
+
+const receiptPrefix = "lightning-poll vote receipt:"
+
+// Receipt is a statement signed by our node's identity key that a vote was
+// made for an option in a poll, which voters can keep as proof of their vote.
+type Receipt struct {
+	PollID      int64
+	OptionID    int64
+	PaymentHash string
+	Timestamp   time.Time
+
+	// Signature is the zbase32 signature of the receipt's message, made by
+	// the node with public key Pubkey.
+	Signature string
+	Pubkey    string
+
+	// Outcome is the current outcome of the vote, which is not signed.
+	Outcome string
+}
+
+// Message returns the message that is signed for a receipt.
+func (r *Receipt) Message() string {
+	return fmt.Sprintf("%v poll=%v option=%v payment_hash=%v time=%v", receiptPrefix,
+		r.PollID, r.OptionID, r.PaymentHash, r.Timestamp.Unix())
+}
+
+// ParseReceipt reads a receipt from its message and signature.
+func ParseReceipt(message, signature string) (*Receipt, error) {
+	var (
+		r    = &Receipt{Signature: signature}
+		unix int64
+	)
+	_, err := fmt.Sscanf(message, receiptPrefix+" poll=%d option=%d payment_hash=%s time=%d",
+		&r.PollID, &r.OptionID, &r.PaymentHash, &unix)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid receipt message")
+	}
+	r.Timestamp = time.Unix(unix, 0)
+
+	if r.Message() != message {
+		return nil, errors.New("invalid receipt message")
+	}
+
+	return r, nil
+}
+
+// IssueReceipt returns a signed receipt for a vote. Signatures are
+// deterministic, so receipts are signed each time they are requested rather
+// than stored. Receipts are only issued for votes which have been paid and
+// count towards their poll's results, otherwise ErrVoteNotPaid is returned,
+// because the vote's payment state is not part of the signed message.
+func IssueReceipt(ctx context.Context, b Backends, voteID int64) (*Receipt, error) {
+	vote, err := b.GetVotes().Lookup(ctx, b.GetConn(), voteID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !counted(vote.Status) {
+		return nil, ErrVoteNotPaid
+	}
+
+	r := &Receipt{
+		PollID:      vote.PollID,
+		OptionID:    vote.OptionID,
+		PaymentHash: vote.PayHash,
+		Timestamp:   vote.CreatedAt,
+		Outcome:     outcomes[vote.Status],
+	}
+
+	r.Signature, err = b.GetLND().SignMessage(ctx, []byte(r.Message()))
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := b.GetLND().GetInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.Pubkey = info.IdentityPubkey
+
+	return r, nil
+}
+
+// VerifyReceipt checks that a receipt was signed by our node, and sets its
+// pubkey and the vote's current outcome. It returns ErrInvalidReceipt if the
+// signature is not valid.
+func VerifyReceipt(ctx context.Context, b Backends, r *Receipt) error {
+	pubkey, valid, err := b.GetLND().VerifyMessage(ctx, []byte(r.Message()), r.Signature)
+	if err != nil {
+		return err
+	}
+
+	info, err := b.GetLND().GetInfo(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !valid || pubkey != info.IdentityPubkey {
+		return ErrInvalidReceipt
+	}
+	r.Pubkey = pubkey
+
+	vote, err := b.GetVotes().LookupByHash(ctx, b.GetConn(), r.PaymentHash)
+	if err != nil {
+		return err
+	}
+
+	if !matchesReceipt(vote, r) {
+		return fmt.Errorf("receipt does not match vote %v", vote.ID)
+	}
+	r.Outcome = outcomes[vote.Status]
+
+	if vote.OptionID == r.OptionID {
+		return nil
+	}
+
+	// receipts issued before a vote was changed are still valid, but no
+	// longer count towards the option that they name.
+	changed, err := changedFrom(ctx, b, vote.ID, r.OptionID)
+	if err != nil {
+		return err
+	}
+
+	if !changed {
+		return fmt.Errorf("receipt does not match vote %v", vote.ID)
+	}
+	r.Outcome = OutcomeChanged
+
+	return nil
+}
+
+func matchesReceipt(vote *votes_db.DBVote, r *Receipt) bool {
+	return vote.PollID == r.PollID && vote.CreatedAt.Unix() == r.Timestamp.Unix()
+}
+
+// counted returns true if a vote with the status provided counts towards its
+// poll's results.
+func counted(status types.VoteStatus) bool {
+	for _, s := range countedStatuses {
+		if s == status {
+			return true
+		}
+	}
+
+	return false
+}
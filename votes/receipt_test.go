@@ -0,0 +1,79 @@
+package votes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/carlaKC/lightning-poll/lnd"
+	"github.com/carlaKC/lightning-poll/votes/internal/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseReceipt(t *testing.T) {
+	r := &Receipt{
+		PollID:      1,
+		OptionID:    2,
+		PaymentHash: "abcd",
+		Timestamp:   time.Unix(1700000000, 0),
+		Signature:   "sig",
+	}
+
+	parsed, err := ParseReceipt(r.Message(), "sig")
+	require.NoError(t, err)
+	assert.Equal(t, r, parsed)
+
+	_, err = ParseReceipt("poll=1", "sig")
+	assert.Error(t, err)
+
+	// messages must be exactly as they were signed.
+	_, err = ParseReceipt(r.Message()+" extra", "sig")
+	assert.Error(t, err)
+}
+
+func TestReceipts(t *testing.T) {
+	ctx := context.Background()
+	b := &memBackends{
+		votes: NewMemRepository(),
+		lnd:   &lnd.MockLND{Pubkey: "node"},
+	}
+
+	err := b.votes.Create(ctx, nil, 1, 10, 20, 3600, 3600, "lnbc1", "hash", "", nil)
+	require.NoError(t, err)
+
+	// unpaid votes do not get receipts.
+	_, err = IssueReceipt(ctx, b, 1)
+	assert.Equal(t, ErrVoteNotPaid, err)
+
+	err = b.votes.MarkPaid(ctx, nil, 1, 100, 1)
+	require.NoError(t, err)
+
+	r, err := IssueReceipt(ctx, b, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), r.PollID)
+	assert.Equal(t, int64(20), r.OptionID)
+	assert.Equal(t, "hash", r.PaymentHash)
+	assert.Equal(t, "node", r.Pubkey)
+	assert.Equal(t, OutcomeHeld, r.Outcome)
+
+	// once the vote is settled, verifying its receipt reports the outcome.
+	err = b.votes.UpdateStatus(ctx, nil, 1, types.VoteStatusPaid, types.VoteStatusSettled)
+	require.NoError(t, err)
+
+	parsed, err := ParseReceipt(r.Message(), r.Signature)
+	require.NoError(t, err)
+	require.NoError(t, VerifyReceipt(ctx, b, parsed))
+	assert.Equal(t, OutcomeSettled, parsed.Outcome)
+	assert.Equal(t, "node", parsed.Pubkey)
+
+	// receipts which have been altered are rejected.
+	parsed.OptionID = 21
+	assert.Equal(t, ErrInvalidReceipt, VerifyReceipt(ctx, b, parsed))
+
+	// as are receipts signed by another node.
+	other := &memBackends{votes: b.votes, lnd: &lnd.MockLND{Pubkey: "other"}}
+	r, err = IssueReceipt(ctx, other, 1)
+	require.NoError(t, err)
+	assert.Equal(t, ErrInvalidReceipt, VerifyReceipt(ctx, b, r))
+}
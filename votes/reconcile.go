@@ -0,0 +1,115 @@
+package votes
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/carlaKC/lightning-poll/db"
+	"github.com/carlaKC/lightning-poll/ledger"
+	ext_types "github.com/carlaKC/lightning-poll/types"
+	votes_db "github.com/carlaKC/lightning-poll/votes/internal/db/votes"
+	"github.com/carlaKC/lightning-poll/votes/internal/types"
+	"github.com/lightningnetwork/lnd/lnrpc"
+)
+
+// Reconcile compares every vote that has not reached a terminal state with the
+// state of its invoice in LND. If repair is true, discrepancies that are safe
+// to fix are repaired.
+func Reconcile(ctx context.Context, b Backends, repair bool) ([]*ext_types.Discrepancy, error) {
+	var discrepancies []*ext_types.Discrepancy
+	for _, status := range []types.VoteStatus{types.VoteStatusCreated, types.VoteStatusPaid} {
+		votes, err := b.GetVotes().ListByStatus(ctx, b.GetConn(), status)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, vote := range votes {
+			d, err := reconcileVote(ctx, b, vote, repair)
+			if err != nil {
+				return nil, err
+			}
+			if d != nil {
+				discrepancies = append(discrepancies, d)
+			}
+		}
+	}
+
+	return discrepancies, nil
+}
+
+// reconcileVote returns a discrepancy if the vote's status does not match
+// its invoice's state, or nil if they are in sync.
+func reconcileVote(ctx context.Context, b Backends, vote *votes_db.DBVote,
+	repair bool) (*ext_types.Discrepancy, error) {
+
+	d := &ext_types.Discrepancy{Kind: "vote", ID: vote.ID}
+
+	inv, err := b.GetLND().LookupInvoice(ctx, vote.PayHash)
+	if err != nil {
+		d.Description = fmt.Sprintf("invoice lookup failed: %v", err)
+		return d, nil
+	}
+
+	var fix func() error
+	switch {
+	case vote.Status == types.VoteStatusCreated && inv.State == lnrpc.Invoice_ACCEPTED:
+		d.Description = "invoice accepted but vote not marked paid"
+		fix = func() error {
+			return markInvoicePaid(ctx, b, hex.EncodeToString(inv.RHash),
+				inv.AmtPaidSat, inv.SettleIndex)
+		}
+
+	case vote.Status == types.VoteStatusCreated && inv.State == lnrpc.Invoice_CANCELED:
+		d.Description = "invoice canceled but vote not expired"
+		fix = func() error {
+			return b.GetVotes().UpdateStatus(ctx, b.GetConn(), vote.ID,
+				types.VoteStatusCreated, types.VoteStatusExpired)
+		}
+
+	case vote.Status == types.VoteStatusPaid && inv.State == lnrpc.Invoice_SETTLED:
+		d.Description = "invoice settled but vote not marked settled"
+		fix = func() error {
+			return db.WithTx(ctx, b.GetConn(), func(tx db.Handle) error {
+				if err := b.GetVotes().UpdateStatus(ctx, tx, vote.ID,
+					types.VoteStatusPaid, types.VoteStatusSettled); err != nil {
+					return err
+				}
+				return ledger.RecordVoteSettled(ctx, tx, vote.PollID, vote.SettleAmount)
+			})
+		}
+
+	case vote.Status == types.VoteStatusPaid && inv.State == lnrpc.Invoice_CANCELED:
+		d.Description = "invoice canceled but vote not marked returned"
+		fix = func() error {
+			return db.WithTx(ctx, b.GetConn(), func(tx db.Handle) error {
+				if err := b.GetVotes().UpdateStatus(ctx, tx, vote.ID,
+					types.VoteStatusPaid, types.VoteStatusReturned); err != nil {
+					return err
+				}
+				return ledger.RecordVoteCanceled(ctx, tx, vote.PollID, vote.SettleAmount)
+			})
+		}
+
+	case vote.Status == types.VoteStatusCreated && inv.State == lnrpc.Invoice_SETTLED:
+		d.Description = "invoice settled for a vote that was never paid"
+
+	case vote.Status == types.VoteStatusPaid && inv.State == lnrpc.Invoice_OPEN:
+		d.Description = "vote marked paid but invoice is not held"
+
+	default:
+		return nil, nil
+	}
+
+	d.Safe = fix != nil
+	if !repair || fix == nil {
+		return d, nil
+	}
+
+	if err := fix(); err != nil {
+		return nil, err
+	}
+	d.Repaired = true
+
+	return d, nil
+}
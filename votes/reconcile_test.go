@@ -0,0 +1,62 @@
+package votes_test
+
+import (
+	"testing"
+
+	"github.com/carlaKC/lightning-poll/lnd"
+	"github.com/carlaKC/lightning-poll/votes"
+	votes_db "github.com/carlaKC/lightning-poll/votes/internal/db/votes"
+	"github.com/carlaKC/lightning-poll/votes/internal/types"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReconcile(t *testing.T) {
+	ctx, b := setup(t)
+	mock := b.GetLND().(*lnd.MockLND)
+
+	// a vote whose invoice has been canceled can be repaired
+	canceledID, err := votes.Create(ctx, b, b.GetConn(), testPollID, testOptionID, testExpiry, "")
+	assert.NoError(t, err)
+	canceled, err := votes_db.Lookup(ctx, b.GetConn(), canceledID)
+	assert.NoError(t, err)
+
+	// a vote marked paid whose invoice is not held requires investigation
+	openID, err := votes.Create(ctx, b, b.GetConn(), testPollID, testOptionID, testExpiry, "")
+	assert.NoError(t, err)
+	err = votes_db.UpdateStatus(ctx, b.GetConn(), openID, types.VoteStatusCreated, types.VoteStatusPaid)
+	assert.NoError(t, err)
+	open, err := votes_db.Lookup(ctx, b.GetConn(), openID)
+	assert.NoError(t, err)
+
+	mock.Invoices = map[string]*lnrpc.Invoice{
+		canceled.PayHash: {State: lnrpc.Invoice_CANCELED},
+		open.PayHash:     {State: lnrpc.Invoice_OPEN},
+	}
+
+	// discrepancies are only reported if repair is false
+	discrepancies, err := votes.Reconcile(ctx, b, false)
+	assert.NoError(t, err)
+	assert.Len(t, discrepancies, 2)
+	for _, d := range discrepancies {
+		assert.False(t, d.Repaired)
+		assert.Equal(t, d.ID == canceledID, d.Safe)
+	}
+
+	discrepancies, err = votes.Reconcile(ctx, b, true)
+	assert.NoError(t, err)
+	assert.Len(t, discrepancies, 2)
+	for _, d := range discrepancies {
+		assert.Equal(t, d.ID == canceledID, d.Repaired)
+	}
+
+	canceled, err = votes_db.Lookup(ctx, b.GetConn(), canceledID)
+	assert.NoError(t, err)
+	assert.Equal(t, types.VoteStatusExpired, canceled.Status)
+
+	// once repaired, only the unsafe discrepancy remains
+	discrepancies, err = votes.Reconcile(ctx, b, true)
+	assert.NoError(t, err)
+	assert.Len(t, discrepancies, 1)
+	assert.Equal(t, openID, discrepancies[0].ID)
+}
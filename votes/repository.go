@@ -0,0 +1,133 @@
+package votes
+
+import (
+	"context"
+
+	"github.com/carlaKC/lightning-poll/db"
+	"github.com/carlaKC/lightning-poll/votes/internal/db/changes"
+	votes_db "github.com/carlaKC/lightning-poll/votes/internal/db/votes"
+	"github.com/carlaKC/lightning-poll/votes/internal/types"
+)
+
+// Repository stores votes. Each method runs its queries on the handle
+// provided, so that they can be part of a transaction.
+type Repository interface {
+	Create(ctx context.Context, h db.Handle, id, pollID, optionID, expirySeconds, closesInSeconds int64,
+		payReq, payHash, voterKey string, preimage []byte) error
+	Lookup(ctx context.Context, h db.Handle, id int64) (*votes_db.DBVote, error)
+	LookupByHash(ctx context.Context, h db.Handle, paymentHash string) (*votes_db.DBVote, error)
+	LookupByIdentity(ctx context.Context, h db.Handle, pollID int64, identity string) (*votes_db.DBVote, error)
+	ListByPollAndStatus(ctx context.Context, h db.Handle, pollID int64, status types.VoteStatus) ([]*votes_db.DBVote, error)
+	ListByStatus(ctx context.Context, h db.Handle, status types.VoteStatus) ([]*votes_db.DBVote, error)
+	ListExpired(ctx context.Context, h db.Handle) ([]*votes_db.DBVote, error)
+	ListByVoter(ctx context.Context, h db.Handle, voterKey string) ([]*votes_db.DBVote, error)
+	CountByStatus(ctx context.Context, h db.Handle) (map[types.VoteStatus]int64, error)
+	CountByPollAndStatus(ctx context.Context, h db.Handle, pollID int64, status types.VoteStatus) (int64, error)
+	UpdateStatus(ctx context.Context, h db.Handle, id int64, fromStatus, toStatus types.VoteStatus) error
+	MarkPaid(ctx context.Context, h db.Handle, id, settleAmount int64, settleIndex uint64) error
+	Cancel(ctx context.Context, h db.Handle, id int64, reason string) error
+	ListPlaintextPreimages(ctx context.Context, h db.Handle) ([]*votes_db.DBVote, error)
+	UpdatePreimage(ctx context.Context, h db.Handle, id int64, from, to []byte) error
+	SetPayReq(ctx context.Context, h db.Handle, id int64, payReq string) error
+	ClaimIdentity(ctx context.Context, h db.Handle, id int64, identity string) error
+	ReleaseIdentity(ctx context.Context, h db.Handle, id int64) error
+	ChangeOption(ctx context.Context, h db.Handle, id, fromOption, toOption int64) error
+	CreateChange(ctx context.Context, h db.Handle, voteID, fromOption, toOption int64) error
+	ListChanges(ctx context.Context, h db.Handle, voteID int64) ([]*changes.DBChange, error)
+}
+
+// NewSQLRepository returns a vote repository backed by a SQL database.
+func NewSQLRepository() Repository {
+	return sqlVotes{}
+}
+
+type sqlVotes struct{}
+
+func (sqlVotes) Create(ctx context.Context, h db.Handle, id, pollID, optionID, expirySeconds, closesInSeconds int64,
+	payReq, payHash, voterKey string, preimage []byte) error {
+	return votes_db.Create(ctx, h, id, pollID, optionID, expirySeconds, closesInSeconds,
+		payReq, payHash, voterKey, preimage)
+}
+
+func (sqlVotes) Lookup(ctx context.Context, h db.Handle, id int64) (*votes_db.DBVote, error) {
+	return votes_db.Lookup(ctx, h, id)
+}
+
+func (sqlVotes) LookupByHash(ctx context.Context, h db.Handle, paymentHash string) (*votes_db.DBVote, error) {
+	return votes_db.LookupByHash(ctx, h, paymentHash)
+}
+
+func (sqlVotes) LookupByIdentity(ctx context.Context, h db.Handle, pollID int64,
+	identity string) (*votes_db.DBVote, error) {
+	return votes_db.LookupByIdentity(ctx, h, pollID, identity)
+}
+
+func (sqlVotes) ListByPollAndStatus(ctx context.Context, h db.Handle, pollID int64,
+	status types.VoteStatus) ([]*votes_db.DBVote, error) {
+	return votes_db.ListByPollAndStatus(ctx, h, pollID, status)
+}
+
+func (sqlVotes) ListByStatus(ctx context.Context, h db.Handle, status types.VoteStatus) ([]*votes_db.DBVote, error) {
+	return votes_db.ListByStatus(ctx, h, status)
+}
+
+func (sqlVotes) ListExpired(ctx context.Context, h db.Handle) ([]*votes_db.DBVote, error) {
+	return votes_db.ListExpired(ctx, h)
+}
+
+func (sqlVotes) ListByVoter(ctx context.Context, h db.Handle, voterKey string) ([]*votes_db.DBVote, error) {
+	return votes_db.ListByVoter(ctx, h, voterKey)
+}
+
+func (sqlVotes) CountByStatus(ctx context.Context, h db.Handle) (map[types.VoteStatus]int64, error) {
+	return votes_db.CountByStatus(ctx, h)
+}
+
+func (sqlVotes) CountByPollAndStatus(ctx context.Context, h db.Handle, pollID int64,
+	status types.VoteStatus) (int64, error) {
+	return votes_db.CountByPollAndStatus(ctx, h, pollID, status)
+}
+
+func (sqlVotes) UpdateStatus(ctx context.Context, h db.Handle, id int64, fromStatus, toStatus types.VoteStatus) error {
+	return votes_db.UpdateStatus(ctx, h, id, fromStatus, toStatus)
+}
+
+func (sqlVotes) MarkPaid(ctx context.Context, h db.Handle, id, settleAmount int64, settleIndex uint64) error {
+	return votes_db.MarkPaid(ctx, h, id, settleAmount, settleIndex)
+}
+
+func (sqlVotes) Cancel(ctx context.Context, h db.Handle, id int64, reason string) error {
+	return votes_db.Cancel(ctx, h, id, reason)
+}
+
+func (sqlVotes) ListPlaintextPreimages(ctx context.Context, h db.Handle) ([]*votes_db.DBVote, error) {
+	return votes_db.ListPlaintextPreimages(ctx, h)
+}
+
+func (sqlVotes) UpdatePreimage(ctx context.Context, h db.Handle, id int64, from, to []byte) error {
+	return votes_db.UpdatePreimage(ctx, h, id, from, to)
+}
+
+func (sqlVotes) SetPayReq(ctx context.Context, h db.Handle, id int64, payReq string) error {
+	return votes_db.SetPayReq(ctx, h, id, payReq)
+}
+
+func (sqlVotes) ClaimIdentity(ctx context.Context, h db.Handle, id int64, identity string) error {
+	return votes_db.ClaimIdentity(ctx, h, id, identity)
+}
+
+func (sqlVotes) ReleaseIdentity(ctx context.Context, h db.Handle, id int64) error {
+	return votes_db.ReleaseIdentity(ctx, h, id)
+}
+
+func (sqlVotes) ChangeOption(ctx context.Context, h db.Handle, id, fromOption, toOption int64) error {
+	return votes_db.ChangeOption(ctx, h, id, fromOption, toOption)
+}
+
+func (sqlVotes) CreateChange(ctx context.Context, h db.Handle, voteID, fromOption, toOption int64) error {
+	return changes.Create(ctx, h, voteID, fromOption, toOption)
+}
+
+func (sqlVotes) ListChanges(ctx context.Context, h db.Handle, voteID int64) ([]*changes.DBChange, error) {
+	return changes.ListByVote(ctx, h, voteID)
+}
@@ -0,0 +1,344 @@
+package votes_test
+
+import (
+	"context"
+	"database/sql"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/carlaKC/lightning-poll/db"
+	"github.com/carlaKC/lightning-poll/votes"
+	votes_db "github.com/carlaKC/lightning-poll/votes/internal/db/votes"
+	"github.com/carlaKC/lightning-poll/votes/internal/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// repo returns a handle and an empty repository to run a test against.
+type repo func(t *testing.T) (db.Handle, votes.Repository)
+
+func sqlRepo(t *testing.T) (db.Handle, votes.Repository) {
+	dbc := db.ConnectForTesting(t)
+	if dbc == nil {
+		t.FailNow()
+	}
+
+	return dbc, votes.NewSQLRepository()
+}
+
+func memRepo(t *testing.T) (db.Handle, votes.Repository) {
+	return nil, votes.NewMemRepository()
+}
+
+func TestSQLRepository(t *testing.T) {
+	testRepository(t, sqlRepo)
+}
+
+func TestMemRepository(t *testing.T) {
+	testRepository(t, memRepo)
+}
+
+// testRepository is a conformance suite which checks that every repository
+// implementation behaves the same way.
+func testRepository(t *testing.T, setup repo) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, h db.Handle, r votes.Repository)
+	}{
+		{name: "create and lookup", test: testCreateLookup},
+		{name: "update status", test: testUpdateStatus},
+		{name: "mark paid and cancel", test: testMarkPaidCancel},
+		{name: "list and count", test: testListCount},
+		{name: "list expired", test: testListExpired},
+		{name: "list by voter", test: testListByVoter},
+		{name: "preimages", test: testPreimages},
+		{name: "identity", test: testIdentity},
+		{name: "changes", test: testChanges},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h, r := setup(t)
+			test.test(t, h, r)
+		})
+	}
+}
+
+// createVote creates a vote for the poll provided, which expires
+// expirySeconds after it is created.
+func createVote(t *testing.T, h db.Handle, r votes.Repository, pollID, expirySeconds int64,
+	payHash string) int64 {
+
+	id := rand.Int63()
+	err := r.Create(context.Background(), h, id, pollID, testOptionID, expirySeconds, expirySeconds,
+		"lnbc1", payHash, "", []byte{1, 2, 3})
+	require.NoError(t, err)
+	return id
+}
+
+func testCreateLookup(t *testing.T, h db.Handle, r votes.Repository) {
+	ctx := context.Background()
+	id := createVote(t, h, r, testPollID, 3600, "hash")
+
+	for _, lookup := range []func() (*votes_db.DBVote, error){
+		func() (*votes_db.DBVote, error) { return r.Lookup(ctx, h, id) },
+		func() (*votes_db.DBVote, error) { return r.LookupByHash(ctx, h, "hash") },
+	} {
+		vote, err := lookup()
+		require.NoError(t, err)
+
+		assert.Equal(t, id, vote.ID)
+		assert.Equal(t, testPollID, vote.PollID)
+		assert.Equal(t, testOptionID, vote.OptionID)
+		assert.Equal(t, "lnbc1", vote.PayReq)
+		assert.Equal(t, "hash", vote.PayHash)
+		assert.Equal(t, []byte{1, 2, 3}, vote.Preimage)
+		assert.Equal(t, types.VoteStatusCreated, vote.Status)
+		assert.True(t, vote.ExpiresAt.After(time.Now()))
+		assert.True(t, vote.ClosesAt.After(time.Now()))
+	}
+
+	// votes cannot be created with an existing ID.
+	err := r.Create(ctx, h, id, testPollID, testOptionID, 3600, 3600, "lnbc1", "hash2", "", nil)
+	assert.Error(t, err)
+
+	_, err = r.Lookup(ctx, h, id+1)
+	assert.Error(t, err)
+
+	_, err = r.LookupByHash(ctx, h, "other")
+	assert.Error(t, err)
+}
+
+func testUpdateStatus(t *testing.T, h db.Handle, r votes.Repository) {
+	ctx := context.Background()
+	id := createVote(t, h, r, testPollID, 3600, "hash")
+
+	err := r.UpdateStatus(ctx, h, id, types.VoteStatusCreated, types.VoteStatusExpired)
+	require.NoError(t, err)
+
+	vote, err := r.Lookup(ctx, h, id)
+	require.NoError(t, err)
+	assert.Equal(t, types.VoteStatusExpired, vote.Status)
+
+	// updates from a status that the vote is not in are rejected.
+	err = r.UpdateStatus(ctx, h, id, types.VoteStatusCreated, types.VoteStatusExpired)
+	assert.Equal(t, db.ErrUnexpectedRowCount, err)
+
+	err = r.UpdateStatus(ctx, h, id+1, types.VoteStatusCreated, types.VoteStatusExpired)
+	assert.Equal(t, db.ErrUnexpectedRowCount, err)
+}
+
+func testMarkPaidCancel(t *testing.T, h db.Handle, r votes.Repository) {
+	ctx := context.Background()
+	id := createVote(t, h, r, testPollID, 3600, "hash")
+
+	// only paid votes can be canceled.
+	err := r.Cancel(ctx, h, id, "poll deleted")
+	assert.Equal(t, db.ErrUnexpectedRowCount, err)
+
+	err = r.MarkPaid(ctx, h, id, 100, 7)
+	require.NoError(t, err)
+
+	// a vote is only marked paid once.
+	err = r.MarkPaid(ctx, h, id, 100, 7)
+	assert.Equal(t, db.ErrUnexpectedRowCount, err)
+
+	vote, err := r.Lookup(ctx, h, id)
+	require.NoError(t, err)
+	assert.Equal(t, types.VoteStatusPaid, vote.Status)
+	assert.Equal(t, int64(100), vote.SettleAmount)
+	assert.Equal(t, int64(7), vote.SettleIndex)
+
+	err = r.Cancel(ctx, h, id, "poll deleted")
+	require.NoError(t, err)
+
+	vote, err = r.Lookup(ctx, h, id)
+	require.NoError(t, err)
+	assert.Equal(t, types.VoteStatusCanceled, vote.Status)
+	assert.Equal(t, "poll deleted", vote.CancelReason)
+
+	// canceled votes cannot be moved back to paid.
+	err = r.MarkPaid(ctx, h, id, 100, 8)
+	assert.Equal(t, db.ErrUnexpectedRowCount, err)
+
+	err = r.MarkPaid(ctx, h, id+1, 100, 8)
+	assert.Equal(t, db.ErrUnexpectedRowCount, err)
+}
+
+func testListCount(t *testing.T, h db.Handle, r votes.Repository) {
+	ctx := context.Background()
+	otherPollID := testPollID + 1
+
+	id1 := createVote(t, h, r, testPollID, 3600, "hash1")
+	id2 := createVote(t, h, r, testPollID, 3600, "hash2")
+	id3 := createVote(t, h, r, otherPollID, 3600, "hash3")
+
+	err := r.UpdateStatus(ctx, h, id2, types.VoteStatusCreated, types.VoteStatusPaid)
+	require.NoError(t, err)
+
+	list, err := r.ListByPollAndStatus(ctx, h, testPollID, types.VoteStatusCreated)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []int64{id1}, voteIDs(list))
+
+	list, err = r.ListByStatus(ctx, h, types.VoteStatusCreated)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []int64{id1, id3}, voteIDs(list))
+
+	counts, err := r.CountByStatus(ctx, h)
+	require.NoError(t, err)
+	assert.Equal(t, map[types.VoteStatus]int64{
+		types.VoteStatusCreated: 2,
+		types.VoteStatusPaid:    1,
+	}, counts)
+
+	count, err := r.CountByPollAndStatus(ctx, h, testPollID, types.VoteStatusPaid)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	count, err = r.CountByPollAndStatus(ctx, h, otherPollID, types.VoteStatusPaid)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), count)
+}
+
+func testListExpired(t *testing.T, h db.Handle, r votes.Repository) {
+	ctx := context.Background()
+	expired := createVote(t, h, r, testPollID, -60, "hash1")
+	createVote(t, h, r, testPollID, 3600, "hash2")
+
+	// paid votes are not listed, even if they have expired.
+	paid := createVote(t, h, r, testPollID, -60, "hash3")
+	err := r.MarkPaid(ctx, h, paid, 100, 1)
+	require.NoError(t, err)
+
+	list, err := r.ListExpired(ctx, h)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []int64{expired}, voteIDs(list))
+}
+
+func testListByVoter(t *testing.T, h db.Handle, r votes.Repository) {
+	ctx := context.Background()
+	createVote(t, h, r, testPollID, 3600, "hash1")
+
+	id := rand.Int63()
+	err := r.Create(ctx, h, id, testPollID, testOptionID, 3600, 3600, "lnbc1", "hash2", "voter", nil)
+	require.NoError(t, err)
+
+	vote, err := r.Lookup(ctx, h, id)
+	require.NoError(t, err)
+	assert.Equal(t, "voter", vote.VoterKey)
+
+	list, err := r.ListByVoter(ctx, h, "voter")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []int64{id}, voteIDs(list))
+
+	list, err = r.ListByVoter(ctx, h, "other")
+	require.NoError(t, err)
+	assert.Empty(t, list)
+}
+
+func testPreimages(t *testing.T, h db.Handle, r votes.Repository) {
+	ctx := context.Background()
+	plaintext := make([]byte, 32)
+
+	id := rand.Int63()
+	err := r.Create(ctx, h, id, testPollID, testOptionID, 3600, 3600, "lnbc1", "hash1", "", plaintext)
+	require.NoError(t, err)
+	createVote(t, h, r, testPollID, 3600, "hash2")
+
+	// votes with derived preimages are stored without one.
+	derivedID := rand.Int63()
+	err = r.Create(ctx, h, derivedID, testPollID, testOptionID, 3600, 3600, "lnbc1", "hash3", "", nil)
+	require.NoError(t, err)
+
+	vote, err := r.Lookup(ctx, h, derivedID)
+	require.NoError(t, err)
+	assert.Empty(t, vote.Preimage)
+
+	list, err := r.ListPlaintextPreimages(ctx, h)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []int64{id}, voteIDs(list))
+
+	// updates are rejected if the preimage has changed since it was read.
+	err = r.UpdatePreimage(ctx, h, id, []byte{1}, []byte{2})
+	assert.Equal(t, db.ErrUnexpectedRowCount, err)
+
+	err = r.UpdatePreimage(ctx, h, id, plaintext, []byte{4, 5, 6})
+	require.NoError(t, err)
+
+	vote, err = r.Lookup(ctx, h, id)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{4, 5, 6}, vote.Preimage)
+
+	list, err = r.ListPlaintextPreimages(ctx, h)
+	require.NoError(t, err)
+	assert.Empty(t, list)
+}
+
+func testIdentity(t *testing.T, h db.Handle, r votes.Repository) {
+	ctx := context.Background()
+	id1 := createVote(t, h, r, testPollID, 3600, "hash1")
+	id2 := createVote(t, h, r, testPollID, 3600, "hash2")
+
+	_, err := r.LookupByIdentity(ctx, h, testPollID, "voter")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	require.NoError(t, r.ClaimIdentity(ctx, h, id1, "voter"))
+
+	vote, err := r.LookupByIdentity(ctx, h, testPollID, "voter")
+	require.NoError(t, err)
+	assert.Equal(t, id1, vote.ID)
+
+	// an identity may only hold one vote per poll.
+	assert.Error(t, r.ClaimIdentity(ctx, h, id2, "voter"))
+
+	// but may hold a vote in other polls.
+	id3 := createVote(t, h, r, testPollID+1, 3600, "hash3")
+	require.NoError(t, r.ClaimIdentity(ctx, h, id3, "voter"))
+
+	require.NoError(t, r.ReleaseIdentity(ctx, h, id1))
+	assert.Equal(t, db.ErrUnexpectedRowCount, r.ReleaseIdentity(ctx, h, id1))
+
+	require.NoError(t, r.ClaimIdentity(ctx, h, id2, "voter"))
+
+	vote, err = r.LookupByIdentity(ctx, h, testPollID, "voter")
+	require.NoError(t, err)
+	assert.Equal(t, id2, vote.ID)
+}
+
+func testChanges(t *testing.T, h db.Handle, r votes.Repository) {
+	ctx := context.Background()
+	id := createVote(t, h, r, testPollID, 3600, "hash1")
+
+	// changes are guarded by the vote's current option.
+	assert.Equal(t, db.ErrUnexpectedRowCount, r.ChangeOption(ctx, h, id, testOptionID+1,
+		testOptionID+2))
+
+	require.NoError(t, r.ChangeOption(ctx, h, id, testOptionID, testOptionID+1))
+	require.NoError(t, r.CreateChange(ctx, h, id, testOptionID, testOptionID+1))
+
+	vote, err := r.Lookup(ctx, h, id)
+	require.NoError(t, err)
+	assert.Equal(t, testOptionID+1, vote.OptionID)
+
+	changes, err := r.ListChanges(ctx, h, id)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, id, changes[0].VoteID)
+	assert.Equal(t, testOptionID, changes[0].FromOptionID)
+	assert.Equal(t, testOptionID+1, changes[0].ToOptionID)
+
+	// votes which are no longer open cannot be changed.
+	require.NoError(t, r.UpdateStatus(ctx, h, id, types.VoteStatusCreated,
+		types.VoteStatusExpired))
+	assert.Equal(t, db.ErrUnexpectedRowCount, r.ChangeOption(ctx, h, id, testOptionID+1,
+		testOptionID))
+}
+
+func voteIDs(list []*votes_db.DBVote) []int64 {
+	var ids []int64
+	for _, v := range list {
+		ids = append(ids, v.ID)
+	}
+	return ids
+}
@@ -1,11 +1,19 @@
 package votes
 
+import "time"
+
 type Vote struct {
 	ID       int64
 	PollID   int64
 	OptionID int64
 	Amount   int64
 	Hash     string
-	Preimage []byte
+	Preimage []byte // encrypted, as stored in the database
 	PayReq   string
+
+	// CreatedAt, Outcome and Receipt are only set for votes listed by voter.
+	// Receipt is true if the vote has been paid, so a receipt can be issued.
+	CreatedAt time.Time
+	Outcome   string
+	Receipt   bool
 }